@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	"rinha-with-go-2024/cmd/internal/cli"
+	"rinha-with-go-2024/config/env"
+	"rinha-with-go-2024/internal/domain"
+	"rinha-with-go-2024/internal/infra/cache"
+	"rinha-with-go-2024/internal/infra/events"
+	"rinha-with-go-2024/internal/infra/repository"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+// Accrues the interest and the fees of a date, the ones already posted are skipped,
+// so it can back-fill the past dates. The date defaults to yesterday, in UTC.
+// Usage: go run ./cmd/accrual -date 2024-09-13
+func main() {
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+	value := flag.String("date", yesterday, "date to accrue, as YYYY-MM-DD")
+	flag.Parse()
+
+	date, err := time.Parse(time.DateOnly, *value)
+	if err != nil {
+		log.Fatalf("invalid date: %v", err)
+	}
+
+	logger := cli.InitializeLogger()
+	db := cli.InitializeDatabase()
+	defer db.Close()
+
+	svc := domain.NewAccrualService(logger, repository.NewAccrualRepository(logger, db)).
+		WithClientService(initializeClientService(logger, db))
+	summary, err := svc.Accrue(context.Background(), date)
+	if err != nil {
+		log.Fatalf("error accruing %s: %v", *value, err)
+	}
+
+	fmt.Printf("accounts: %d, posted: %d, skipped: %d\n", summary.Accounts, summary.Posted, summary.Skipped)
+}
+
+// initializeClientService runs the hooks the API runs for the accruals, as enabled in the API:
+// it broadcasts the invalidation of the statements and the events to the API replicas, and
+// enqueues the webhooks, which the replicas deliver.
+func initializeClientService(logger *slog.Logger, db *pgxpool.Pool) *domain.ClientService {
+	svc := domain.NewClientRepository(logger, repository.NewClientRepository(logger, db))
+
+	if env.GetEnvOrSetDefault("STATEMENT_CACHE_ENABLED", "0") == "1" {
+		var shared cache.Shared
+		if addr := env.GetEnvOrSetDefault("STATEMENT_CACHE_REDIS_ADDR", ""); addr != "" {
+			shared = cache.NewRedisCache(redis.NewClient(&redis.Options{Addr: addr}))
+		}
+
+		// No statement is read here, the cache only removes the shared one and notifies the replicas.
+		svc.WithStatementCache(cache.NewStatementCache(logger, 0, 0, shared, cache.NewPostgresNotifier(logger, db), nil))
+	}
+
+	if env.GetEnvOrSetDefault("EVENTS_ENABLED", "0") == "1" {
+		svc.WithObserver(domain.NewEventService(logger, repository.NewClientRepository(logger, db), events.NewPostgresNotifier(logger, db), nil))
+	}
+
+	if env.GetEnvOrSetDefault("WEBHOOKS_ENABLED", "0") == "1" {
+		svc.WithObserver(domain.NewWebhookService(logger, repository.NewWebhookRepository(logger, db), nil))
+	}
+
+	return svc
+}
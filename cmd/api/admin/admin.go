@@ -0,0 +1,124 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"time"
+
+	"rinha-with-go-2024/internal/infra/logger"
+)
+
+// maxProfileSeconds bounds the CPU profiles, since only one runs at a time.
+const maxProfileSeconds = 300
+
+type ProfileResponse struct {
+	Path    string `json:"arquivo"`
+	Seconds int    `json:"segundos"`
+}
+
+type LevelRequest struct {
+	Level  *string  `json:"nivel"`
+	Sample *float64 `json:"amostragem"`
+}
+
+type LevelResponse struct {
+	Level  string  `json:"nivel"`
+	Sample float64 `json:"amostragem"`
+}
+
+// NewHandler serves the net/http/pprof endpoints, including the runtime trace in
+// /debug/pprof/trace, and POST /debug/profiles/cpu?seconds=N, which writes the CPU profile
+// of the next N seconds in the profiler directory. The expvar counters are in /debug/vars.
+// The level of the logger and the sample of its debug lines are in GET and PUT /log/level.
+// It's meant for the admin port only, never behind the nginx.
+func NewHandler(logger *slog.Logger, profiler *Profiler, level *logger.Level) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("POST /debug/profiles/cpu", profileCPU(logger, profiler))
+	mux.HandleFunc("GET /log/level", getLevel(level))
+	mux.HandleFunc("PUT /log/level", setLevel(logger, level))
+
+	return mux
+}
+
+func profileCPU(logger *slog.Logger, profiler *Profiler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seconds := 30
+		if value := r.URL.Query().Get("seconds"); value != "" {
+			var err error
+			seconds, err = strconv.Atoi(value)
+			if err != nil || seconds <= 0 || seconds > maxProfileSeconds {
+				w.WriteHeader(400)
+				return
+			}
+		}
+
+		path, err := profiler.ProfileCPU(time.Duration(seconds) * time.Second)
+		if errors.Is(err, ErrProfileInProgress) {
+			w.WriteHeader(409)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to start the cpu profile", "error", err)
+			w.WriteHeader(500)
+			return
+		}
+
+		logger.Info("cpu profile started", "path", path, "seconds", seconds)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(202)
+		json.NewEncoder(w).Encode(ProfileResponse{Path: path, Seconds: seconds})
+	}
+}
+
+func getLevel(level *logger.Level) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeLevel(w, level)
+	}
+}
+
+// setLevel changes only the fields given, as in {"nivel": "DEBUG", "amostragem": 0.01}.
+func setLevel(logger *slog.Logger, level *logger.Level) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req LevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(422)
+			return
+		}
+
+		var next slog.Level
+		if req.Level != nil {
+			if err := next.UnmarshalText([]byte(*req.Level)); err != nil {
+				w.WriteHeader(422)
+				return
+			}
+		}
+		if req.Sample != nil {
+			if err := level.SetSample(*req.Sample); err != nil {
+				w.WriteHeader(422)
+				return
+			}
+		}
+		if req.Level != nil {
+			level.Set(next)
+		}
+
+		logger.Warn("log level changed", "level", level.Level(), "sample", level.Sample())
+		writeLevel(w, level)
+	}
+}
+
+func writeLevel(w http.ResponseWriter, level *logger.Level) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(LevelResponse{Level: level.Level().String(), Sample: level.Sample()})
+}
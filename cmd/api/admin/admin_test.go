@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/internal/infra/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func initializeProfiler(t *testing.T) *Profiler {
+	return NewProfiler(slog.New(slog.NewTextHandler(io.Discard, nil)), filepath.Join(t.TempDir(), "profiles"))
+}
+
+func TestProfiler_ProfileCPU(t *testing.T) {
+	profiler := initializeProfiler(t)
+
+	path, err := profiler.ProfileCPU(time.Millisecond * 50)
+	assert.NoError(t, err)
+	assert.Equal(t, profiler.dir, filepath.Dir(path))
+
+	_, err = profiler.ProfileCPU(time.Millisecond * 50)
+	assert.ErrorIs(t, err, ErrProfileInProgress)
+
+	assert.Eventually(t, func() bool { return !profiler.running.Load() }, time.Second, time.Millisecond*10)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Size())
+
+	next, err := profiler.ProfileCPU(time.Millisecond * 50)
+	assert.NoError(t, err)
+	assert.NotEqual(t, path, next)
+	assert.Eventually(t, func() bool { return !profiler.running.Load() }, time.Second, time.Millisecond*10)
+}
+
+func initializeAdmin(t *testing.T) (*Profiler, *logger.Level, *httptest.Server) {
+	profiler := initializeProfiler(t)
+	level, err := logger.NewLevel("INFO", 1)
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(NewHandler(profiler.logger, profiler, level))
+	t.Cleanup(server.Close)
+
+	return profiler, level, server
+}
+
+func TestNewHandler_Profiles(t *testing.T) {
+	profiler, _, server := initializeAdmin(t)
+
+	res, err := http.Get(server.URL + "/debug/pprof/")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+
+	for _, seconds := range []string{"0", "-1", "abc", "301"} {
+		res, err := http.Post(server.URL+"/debug/profiles/cpu?seconds="+seconds, "", nil)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, 400, res.StatusCode, seconds)
+	}
+
+	res, err = http.Post(server.URL+"/debug/profiles/cpu?seconds=1", "", nil)
+	assert.NoError(t, err)
+	var profile ProfileResponse
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&profile))
+	res.Body.Close()
+	assert.Equal(t, 202, res.StatusCode)
+	assert.Equal(t, 1, profile.Seconds)
+	assert.Equal(t, profiler.dir, filepath.Dir(profile.Path))
+
+	res, err = http.Post(server.URL+"/debug/profiles/cpu?seconds=1", "", nil)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 409, res.StatusCode)
+
+	assert.Eventually(t, func() bool { return !profiler.running.Load() }, time.Second*3, time.Millisecond*50)
+	_, err = os.Stat(profile.Path)
+	assert.NoError(t, err)
+}
+
+func TestNewHandler_LogLevel(t *testing.T) {
+	_, level, server := initializeAdmin(t)
+
+	setLevel := func(body string) (int, LevelResponse) {
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/log/level", strings.NewReader(body))
+		assert.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		var got LevelResponse
+		if res.StatusCode == 200 {
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+		}
+		return res.StatusCode, got
+	}
+
+	status, got := setLevel(`{"nivel": "DEBUG", "amostragem": 0.25}`)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, LevelResponse{Level: "DEBUG", Sample: 0.25}, got)
+	assert.Equal(t, slog.LevelDebug, level.Level())
+
+	status, got = setLevel(`{"nivel": "warn"}`)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, LevelResponse{Level: "WARN", Sample: 0.25}, got)
+
+	for _, body := range []string{`{"nivel": "LOUD"}`, `{"amostragem": 2}`, `{"nivel": "DEBUG", "amostragem": -1}`, `nivel`} {
+		status, _ := setLevel(body)
+		assert.Equal(t, 422, status, body)
+	}
+	assert.Equal(t, slog.LevelWarn, level.Level())
+
+	res, err := http.Get(server.URL + "/log/level")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+	assert.Equal(t, LevelResponse{Level: "WARN", Sample: 0.25}, got)
+}
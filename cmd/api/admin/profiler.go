@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+var ErrProfileInProgress = errors.New("a cpu profile is already in progress")
+
+// Profiler writes the CPU profiles in dir, named after the host so the replicas can share it.
+type Profiler struct {
+	logger  *slog.Logger
+	dir     string
+	host    string
+	running atomic.Bool
+}
+
+func NewProfiler(logger *slog.Logger, dir string) *Profiler {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return &Profiler{logger: logger, dir: dir, host: host}
+}
+
+// ProfileCPU starts a CPU profile of d in the background and returns the path it's written to.
+// There is a single CPU profile per process, so it fails while another one, including the one
+// of the pprof endpoint, is in progress.
+func (p *Profiler) ProfileCPU(d time.Duration) (string, error) {
+	if !p.running.CompareAndSwap(false, true) {
+		return "", ErrProfileInProgress
+	}
+
+	path, err := p.startCPU(d)
+	if err != nil {
+		p.running.Store(false)
+		return "", err
+	}
+
+	return path, nil
+}
+
+func (p *Profiler) startCPU(d time.Duration) (string, error) {
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("cpu-%s-%s.pprof", p.host, time.Now().UTC().Format("20060102T150405.000"))
+	path := filepath.Join(p.dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", ErrProfileInProgress
+	}
+
+	time.AfterFunc(d, func() {
+		pprof.StopCPUProfile()
+		if err := f.Close(); err != nil {
+			p.logger.Error("failed to write the cpu profile", "path", path, "error", err)
+		} else {
+			p.logger.Info("cpu profile written", "path", path, "duration", d)
+		}
+		p.running.Store(false)
+	})
+
+	return path, nil
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+)
+
+type AccrualHandler struct {
+	logger *slog.Logger
+	svc    *domain.AccrualService
+}
+
+func NewAccrualHandler(logger *slog.Logger, svc *domain.AccrualService) *AccrualHandler {
+	return &AccrualHandler{
+		logger: logger,
+		svc:    svc,
+	}
+}
+
+// PUT /admin/produtos/:produto
+func (h *AccrualHandler) SetProduct(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	request := ProductRequest{}
+	if err := c.DecodeJSON(&request); err != nil {
+		logger.DebugContext(ctx, "invalid request body", "error", err)
+		c.Status(422)
+		return
+	}
+
+	product, err := h.svc.SetProduct(ctx, c.Param("produto"), request.DailyInterestRate.String(), request.MonthlyFee)
+	if errors.Is(err, domain.ErrInvalidProduct) {
+		logger.DebugContext(ctx, "invalid product", "error", err)
+		c.Status(422)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to set the product", "error", err)
+		c.Status(500)
+		return
+	}
+
+	c.JSON(200, newProductResponse(product))
+}
+
+// GET /admin/produtos
+func (h *AccrualHandler) GetProducts(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	products, err := h.svc.GetProducts(ctx)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to get the products", "error", err)
+		c.Status(500)
+		return
+	}
+
+	response := make([]ProductResponse, 0, len(products))
+	for _, product := range products {
+		response = append(response, newProductResponse(&product))
+	}
+
+	c.JSON(200, response)
+}
+
+// PUT /admin/clientes/:id/produto
+func (h *AccrualHandler) SetClientProduct(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	request := ClientProductRequest{}
+	if err := c.DecodeJSON(&request); err != nil {
+		logger.DebugContext(ctx, "invalid request body", "error", err)
+		c.Status(422)
+		return
+	}
+
+	err = h.svc.SetClientProduct(ctx, clientID, request.Product)
+	if errors.Is(err, domain.ErrClientDoesntExist) {
+		logger.DebugContext(ctx, "invalid client id", "id", clientID)
+		c.Status(404)
+		return
+	}
+	if errors.Is(err, domain.ErrProductNotFound) {
+		logger.DebugContext(ctx, "product not found", "product", request.Product)
+		c.Status(422)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to set the client's product", "error", err)
+		c.Status(500)
+		return
+	}
+
+	c.Status(204)
+}
+
+type ProductRequest struct {
+	DailyInterestRate json.Number  `json:"juros_diario"`
+	MonthlyFee        domain.Money `json:"tarifa_mensal"`
+}
+
+type ProductResponse struct {
+	Code              string       `json:"produto"`
+	DailyInterestRate string       `json:"juros_diario"`
+	MonthlyFee        domain.Money `json:"tarifa_mensal"`
+}
+
+func newProductResponse(p *domain.Product) ProductResponse {
+	return ProductResponse{
+		Code:              p.Code,
+		DailyInterestRate: p.InterestRate(),
+		MonthlyFee:        p.MonthlyFee,
+	}
+}
+
+type ClientProductRequest struct {
+	Product string `json:"produto"`
+}
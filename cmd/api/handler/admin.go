@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+)
+
+type AdminHandler struct {
+	logger *slog.Logger
+	auth   *domain.AuthService
+}
+
+func NewAdminHandler(logger *slog.Logger, auth *domain.AuthService) *AdminHandler {
+	return &AdminHandler{
+		logger: logger,
+		auth:   auth,
+	}
+}
+
+// POST /admin/clientes/:id/chaves
+func (h *AdminHandler) CreateAPIKey(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	created, key, err := h.auth.CreateAPIKey(ctx, clientID)
+	if errors.Is(err, domain.ErrClientDoesntExist) {
+		logger.DebugContext(ctx, "invalid client id", "id", clientID)
+		c.Status(404)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to create the api key", "error", err)
+		c.Status(500)
+		return
+	}
+
+	c.JSON(201, APIKeyResponse{ID: created.ID, Key: key})
+}
+
+type APIKeyResponse struct {
+	ID  int    `json:"id"`
+	Key string `json:"chave"`
+}
@@ -0,0 +1,629 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"rinha-with-go-2024/cmd/api/transport"
+)
+
+// The hot endpoints decode and encode their payloads by hand in pooled buffers, instead of the
+// reflection of encoding/json. The output is the same of json.Marshal, and the request accepts
+// the same documents of json.Unmarshal up to maxTransactionBody, so unlike the json.Decoder of
+// gin, the data after the object is rejected.
+
+var (
+	errInvalidJSON  = errors.New("invalid json")
+	errBodyTooLarge = errors.New("request body too large")
+)
+
+// maxTransactionBody is a few times the largest valid transaction, with its metadata full.
+const maxTransactionBody = 8 * 1024
+
+// maxPooledBuffer keeps the buffers of the unusually large bodies out of the pool.
+const maxPooledBuffer = 64 * 1024
+
+// maxJSONDepth is deeper than any valid request, given the metadata is a flat object.
+const maxJSONDepth = 32
+
+var buffers = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+// jsonContentType is shared by the responses, like gin does, so setting it doesn't allocate.
+var jsonContentType = []string{"application/json; charset=utf-8"}
+
+func getBuffer() *[]byte {
+	return buffers.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+	*b = (*b)[:0]
+	buffers.Put(b)
+}
+
+// readBody appends the body to buf, like io.ReadAll does to a new slice.
+func readBody(r io.Reader, buf []byte) ([]byte, error) {
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+}
+
+func bindTransactionRequest(c transport.Context, request *TransactionRequest) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	data, err := readBody(io.LimitReader(c.Request().Body, maxTransactionBody+1), *buf)
+	*buf = data
+	if err != nil {
+		return err
+	}
+	if len(data) > maxTransactionBody {
+		return errBodyTooLarge
+	}
+
+	return request.decodeJSON(data)
+}
+
+// writeJSON must be given the payload already encoded, since it can't fail after the status.
+func writeJSON(c transport.Context, code int, data []byte) {
+	c.Writer().Header()["Content-Type"] = jsonContentType
+	c.Status(code)
+	c.Writer().Write(data)
+}
+
+// decodeJSON gives the amount and the metadata to their own UnmarshalJSON, so the integer
+// amount and the overflow are validated as before, and the kind is validated by the domain.
+func (r *TransactionRequest) decodeJSON(data []byte) error {
+	d := jsonDecoder{data: data}
+	d.skipSpace()
+	if d.literal("null") {
+		return d.end()
+	}
+	if !d.consume('{') {
+		return errInvalidJSON
+	}
+
+	d.skipSpace()
+	if d.consume('}') {
+		return d.end()
+	}
+
+	for {
+		d.skipSpace()
+		key, err := d.stringValue()
+		if err != nil {
+			return err
+		}
+		d.skipSpace()
+		if !d.consume(':') {
+			return errInvalidJSON
+		}
+		d.skipSpace()
+		value, err := d.value(0)
+		if err != nil {
+			return err
+		}
+
+		if err := r.setField(key, value); err != nil {
+			return err
+		}
+
+		d.skipSpace()
+		if d.consume('}') {
+			return d.end()
+		}
+		if !d.consume(',') {
+			return errInvalidJSON
+		}
+	}
+}
+
+// setField matches the keys ignoring the case, as encoding/json does.
+func (r *TransactionRequest) setField(key, value []byte) error {
+	if len(key) > 2 && hasEscape(key[1:len(key)-1]) {
+		name, err := unquote(key)
+		if err != nil {
+			return err
+		}
+		key = []byte(`"` + name + `"`)
+	}
+	key = key[1 : len(key)-1]
+
+	switch {
+	case equalFold(key, "valor"):
+		return r.Amount.UnmarshalJSON(value)
+	case equalFold(key, "tipo"):
+		return decodeKind(value, &r.Kind)
+	case equalFold(key, "descricao"):
+		return decodeString(value, &r.Description)
+	case equalFold(key, "moeda"):
+		return decodeString(value, &r.Currency)
+	case equalFold(key, "categoria"):
+		return decodeString(value, &r.Category)
+	case equalFold(key, "metadados"):
+		return r.Metadata.UnmarshalJSON(value)
+	case equalFold(key, "referencia_externa"):
+		return decodeString(value, &r.Reference)
+	default:
+		return nil
+	}
+}
+
+// decodeKind doesn't allocate for the valid kinds.
+func decodeKind(value []byte, dst *string) error {
+	switch string(value) {
+	case `"c"`:
+		*dst = "c"
+		return nil
+	case `"d"`:
+		*dst = "d"
+		return nil
+	default:
+		return decodeString(value, dst)
+	}
+}
+
+// decodeString leaves dst as is for null, as encoding/json does.
+func decodeString(value []byte, dst *string) error {
+	if string(value) == "null" {
+		return nil
+	}
+	if value[0] != '"' {
+		return errInvalidJSON
+	}
+
+	s, err := unquote(value)
+	if err != nil {
+		return err
+	}
+	*dst = s
+	return nil
+}
+
+func equalFold(key []byte, name string) bool {
+	if len(key) != len(name) {
+		return false
+	}
+	for i := range key {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != name[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonDecoder validates the syntax while slicing the values out of the data.
+type jsonDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *jsonDecoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (d *jsonDecoder) consume(c byte) bool {
+	if d.pos < len(d.data) && d.data[d.pos] == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+func (d *jsonDecoder) literal(s string) bool {
+	if len(d.data)-d.pos >= len(s) && string(d.data[d.pos:d.pos+len(s)]) == s {
+		d.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (d *jsonDecoder) end() error {
+	d.skipSpace()
+	if d.pos != len(d.data) {
+		return errInvalidJSON
+	}
+	return nil
+}
+
+func (d *jsonDecoder) value(depth int) ([]byte, error) {
+	if d.pos >= len(d.data) || depth > maxJSONDepth {
+		return nil, errInvalidJSON
+	}
+
+	start := d.pos
+	var err error
+	switch c := d.data[d.pos]; {
+	case c == '"':
+		_, err = d.stringValue()
+	case c == '{':
+		err = d.object(depth)
+	case c == '[':
+		err = d.array(depth)
+	case c == '-' || ('0' <= c && c <= '9'):
+		err = d.number()
+	case d.literal("true"), d.literal("false"), d.literal("null"):
+	default:
+		err = errInvalidJSON
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return d.data[start:d.pos], nil
+}
+
+func (d *jsonDecoder) object(depth int) error {
+	d.pos++
+	d.skipSpace()
+	if d.consume('}') {
+		return nil
+	}
+
+	for {
+		d.skipSpace()
+		if _, err := d.stringValue(); err != nil {
+			return err
+		}
+		d.skipSpace()
+		if !d.consume(':') {
+			return errInvalidJSON
+		}
+		d.skipSpace()
+		if _, err := d.value(depth + 1); err != nil {
+			return err
+		}
+		d.skipSpace()
+		if d.consume('}') {
+			return nil
+		}
+		if !d.consume(',') {
+			return errInvalidJSON
+		}
+	}
+}
+
+func (d *jsonDecoder) array(depth int) error {
+	d.pos++
+	d.skipSpace()
+	if d.consume(']') {
+		return nil
+	}
+
+	for {
+		d.skipSpace()
+		if _, err := d.value(depth + 1); err != nil {
+			return err
+		}
+		d.skipSpace()
+		if d.consume(']') {
+			return nil
+		}
+		if !d.consume(',') {
+			return errInvalidJSON
+		}
+	}
+}
+
+// stringValue returns the string with the quotes, validating the escapes.
+func (d *jsonDecoder) stringValue() ([]byte, error) {
+	start := d.pos
+	if !d.consume('"') {
+		return nil, errInvalidJSON
+	}
+
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		switch {
+		case c == '"':
+			d.pos++
+			return d.data[start:d.pos], nil
+		case c < 0x20:
+			return nil, errInvalidJSON
+		case c == '\\':
+			d.pos++
+			if d.pos >= len(d.data) {
+				return nil, errInvalidJSON
+			}
+			switch d.data[d.pos] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				d.pos++
+			case 'u':
+				if len(d.data)-d.pos < 5 || !isHex(d.data[d.pos+1:d.pos+5]) {
+					return nil, errInvalidJSON
+				}
+				d.pos += 5
+			default:
+				return nil, errInvalidJSON
+			}
+		default:
+			d.pos++
+		}
+	}
+
+	return nil, errInvalidJSON
+}
+
+func (d *jsonDecoder) number() error {
+	d.consume('-')
+	switch {
+	case d.consume('0'):
+	case d.digits() == 0:
+		return errInvalidJSON
+	}
+	if d.consume('.') && d.digits() == 0 {
+		return errInvalidJSON
+	}
+	if d.consume('e') || d.consume('E') {
+		if !d.consume('+') {
+			d.consume('-')
+		}
+		if d.digits() == 0 {
+			return errInvalidJSON
+		}
+	}
+	return nil
+}
+
+func (d *jsonDecoder) digits() int {
+	start := d.pos
+	for d.pos < len(d.data) && '0' <= d.data[d.pos] && d.data[d.pos] <= '9' {
+		d.pos++
+	}
+	return d.pos - start
+}
+
+func isHex(b []byte) bool {
+	for _, c := range b {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func hasEscape(s []byte) bool {
+	for _, c := range s {
+		if c == '\\' || c >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+// unquote takes a string already validated by the decoder, replacing the invalid UTF-8
+// and the lone surrogates with U+FFFD, as encoding/json does.
+func unquote(quoted []byte) (string, error) {
+	s := quoted[1 : len(quoted)-1]
+	if !hasEscape(s) || (utf8.Valid(s) && !containsByte(s, '\\')) {
+		return string(s), nil
+	}
+
+	b := make([]byte, 0, len(s)+utf8.UTFMax)
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRune(s[i:])
+			b = utf8.AppendRune(b, r)
+			i += size
+			continue
+		}
+		if c != '\\' {
+			b = append(b, c)
+			i++
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'u':
+			r := hexRune(s[i+1 : i+5])
+			i += 4
+			if utf16.IsSurrogate(r) {
+				r2 := rune(-1)
+				if i+6 < len(s) && s[i+1] == '\\' && s[i+2] == 'u' {
+					r2 = hexRune(s[i+3 : i+7])
+				}
+				if dec := utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+					r = dec
+					i += 6
+				} else {
+					r = utf8.RuneError
+				}
+			}
+			b = utf8.AppendRune(b, r)
+		default:
+			b = append(b, s[i])
+		}
+		i++
+	}
+
+	return string(b), nil
+}
+
+func containsByte(s []byte, c byte) bool {
+	for _, b := range s {
+		if b == c {
+			return true
+		}
+	}
+	return false
+}
+
+func hexRune(b []byte) rune {
+	v, _ := strconv.ParseUint(string(b), 16, 32)
+	return rune(v)
+}
+
+func (r TransactionResponse) appendJSON(dst []byte) []byte {
+	dst = append(dst, `{"limite":`...)
+	dst = strconv.AppendInt(dst, int64(r.Limit), 10)
+	dst = append(dst, `,"saldo":`...)
+	dst = strconv.AppendInt(dst, int64(r.Balance), 10)
+	return append(dst, '}')
+}
+
+func (r *StatementResponse) appendJSON(dst []byte) []byte {
+	dst = append(dst, `{"saldo":{"total":`...)
+	dst = strconv.AppendInt(dst, int64(r.Balance.Total), 10)
+	dst = append(dst, `,"data_extrato":`...)
+	dst = appendString(dst, r.Balance.StatementAt)
+	dst = append(dst, `,"limite":`...)
+	dst = strconv.AppendInt(dst, int64(r.Balance.Limit), 10)
+	dst = append(dst, `,"moeda":`...)
+	dst = appendString(dst, r.Balance.Currency)
+	dst = append(dst, `},"ultimas_transacoes":`...)
+
+	if r.Transactions == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '[')
+		for i := range r.Transactions {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = r.Transactions[i].appendJSON(dst)
+		}
+		dst = append(dst, ']')
+	}
+
+	return append(dst, '}')
+}
+
+// appendJSON only falls back to encoding/json for the metadata, which is rarely present.
+func (t *TransactionStatementResponse) appendJSON(dst []byte) []byte {
+	dst = append(dst, `{"valor":`...)
+	dst = strconv.AppendInt(dst, int64(t.Amount), 10)
+	dst = append(dst, `,"tipo":`...)
+	dst = appendString(dst, t.Kind)
+	dst = append(dst, `,"descricao":`...)
+	dst = appendString(dst, t.Description)
+	if t.Currency != "" {
+		dst = append(dst, `,"moeda":`...)
+		dst = appendString(dst, t.Currency)
+	}
+	if t.OriginalAmount != nil {
+		dst = append(dst, `,"valor_original":`...)
+		dst = strconv.AppendInt(dst, int64(*t.OriginalAmount), 10)
+	}
+	if t.Rate != "" {
+		dst = append(dst, `,"taxa":`...)
+		dst = appendString(dst, t.Rate)
+	}
+	if t.Category != "" {
+		dst = append(dst, `,"categoria":`...)
+		dst = appendString(dst, t.Category)
+	}
+	if len(t.Metadata) > 0 {
+		metadata, err := json.Marshal(t.Metadata)
+		if err == nil {
+			dst = append(dst, `,"metadados":`...)
+			dst = append(dst, metadata...)
+		}
+	}
+	if t.Reference != "" {
+		dst = append(dst, `,"referencia_externa":`...)
+		dst = appendString(dst, t.Reference)
+	}
+	dst = append(dst, `,"realizada_em":`...)
+	dst = appendString(dst, t.UpdatedAt)
+	return append(dst, '}')
+}
+
+const hex = "0123456789abcdef"
+
+// appendString escapes as json.Marshal does, including the HTML characters.
+func appendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionRequest_decodeJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{name: "valid", input: `{"valor": 1000, "tipo": "c", "descricao": "descricao"}`, valid: true},
+		{name: "all fields", input: `{"valor":1,"tipo":"d","descricao":"a","moeda":"USD","categoria":"mercado","metadados":{"canal":"pix","parcelas":3},"referencia_externa":"ref-1"}`, valid: true},
+		{name: "escaped description", input: `{"valor": 1, "tipo": "c", "descricao": "a\"b\\c\/\n\u00e9\ud83d\ude00é"}`, valid: true},
+		{name: "lone surrogate", input: `{"valor": 1, "tipo": "c", "descricao": "\ud83d"}`, valid: true},
+		{name: "invalid utf-8", input: "{\"valor\": 1, \"tipo\": \"c\", \"descricao\": \"\xff\"}", valid: true},
+		{name: "unknown fields", input: `{"valor": 1, "outro": {"a": [1, 2.5e3, null, true]}, "tipo": "c"}`, valid: true},
+		{name: "case insensitive keys", input: `{"VALOR": 1, "Tipo": "c"}`, valid: true},
+		{name: "escaped key", input: `{"\u0076alor": 1}`, valid: true},
+		{name: "null fields", input: `{"valor": 1, "tipo": null, "metadados": null}`, valid: true},
+		{name: "null", input: `null`, valid: true},
+		{name: "empty object", input: ` { } `, valid: true},
+		{name: "float amount", input: `{"valor": 1.5, "tipo": "c"}`},
+		{name: "exponent amount", input: `{"valor": 1e3, "tipo": "c"}`},
+		{name: "string amount", input: `{"valor": "1", "tipo": "c"}`},
+		{name: "null amount", input: `{"valor": null, "tipo": "c"}`},
+		{name: "overflow amount", input: `{"valor": 9223372036854775808, "tipo": "c"}`},
+		{name: "number kind", input: `{"valor": 1, "tipo": 1}`},
+		{name: "invalid metadata", input: `{"valor": 1, "metadados": [1]}`},
+		{name: "trailing comma", input: `{"valor": 1,}`},
+		{name: "invalid escape", input: `{"descricao": "\x"}`},
+		{name: "control character", input: "{\"descricao\": \"\t\"}"},
+		{name: "leading zero", input: `{"valor": 01}`},
+		{name: "unclosed", input: `{"valor": 1`},
+		{name: "empty", input: ``},
+		{name: "array", input: `[]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got, want TransactionRequest
+			err := got.decodeJSON([]byte(tt.input))
+			wantErr := json.Unmarshal([]byte(tt.input), &want)
+
+			assert.Equal(t, tt.valid, err == nil, "error: %v", err)
+			assert.Equal(t, wantErr == nil, err == nil, "encoding/json error: %v", wantErr)
+			if err == nil {
+				assert.Equal(t, want, got)
+			}
+		})
+	}
+
+	t.Run("overflow is reported", func(t *testing.T) {
+		var request TransactionRequest
+		err := request.decodeJSON([]byte(`{"valor": 9223372036854775808}`))
+		assert.ErrorIs(t, err, domain.ErrMoneyOverflow)
+	})
+}
+
+func TestStatementResponse_appendJSON(t *testing.T) {
+	originalAmount := domain.Money(20)
+	response := &StatementResponse{
+		Balance: StatementBalanceResponse{Total: -50, StatementAt: "2024-01-02T03:04:05.000000Z", Limit: 1000, Currency: "BRL"},
+		Transactions: []TransactionStatementResponse{
+			{Amount: 100, Kind: "c", Description: "<a&b>\"\\\n\t\x01\u2028", UpdatedAt: "2024-01-02T03:04:05.000000Z"},
+			{
+				Amount:         110,
+				Kind:           "d",
+				Description:    "cambio",
+				Currency:       "USD",
+				OriginalAmount: &originalAmount,
+				Rate:           "5.5",
+				Category:       "viagem",
+				Metadata:       domain.Metadata{"canal": "pix", "parcelas": json.Number("3")},
+				Reference:      "ref-1",
+				UpdatedAt:      "2024-01-02T03:04:05.000000Z",
+			},
+		},
+	}
+
+	want, err := json.Marshal(response)
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), string(response.appendJSON(nil)))
+
+	// Go 1.23 escapes the invalid UTF-8 as \ufffd, the newer releases write the character.
+	invalid := &StatementResponse{Transactions: []TransactionStatementResponse{{Description: "a\xffb"}}}
+	want, err = json.Marshal(invalid)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(want), string(invalid.appendJSON(nil)))
+
+	empty := &StatementResponse{}
+	want, err = json.Marshal(empty)
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), string(empty.appendJSON(nil)))
+}
+
+func TestTransactionResponse_appendJSON(t *testing.T) {
+	response := TransactionResponse{Limit: 100000, Balance: -9098}
+
+	want, err := json.Marshal(response)
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), string(response.appendJSON(nil)))
+}
+
+// The benchmarks compare the codecs with encoding/json, the one used by gin, run them with
+// go test ./cmd/api/handler -run x -bench . -benchmem
+func BenchmarkTransactionRequest(b *testing.B) {
+	data := []byte(`{"valor": 1000, "tipo": "c", "descricao": "descricao"}`)
+
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var request TransactionRequest
+			if err := json.NewDecoder(bytes.NewReader(data)).Decode(&request); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("codec", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var request TransactionRequest
+			buf := getBuffer()
+			body, _ := readBody(bytes.NewReader(data), *buf)
+			*buf = body
+			if err := request.decodeJSON(body); err != nil {
+				b.Fatal(err)
+			}
+			putBuffer(buf)
+		}
+	})
+}
+
+func BenchmarkTransactionResponse(b *testing.B) {
+	response := TransactionResponse{Limit: 100000, Balance: -9098}
+
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := json.Marshal(response); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("codec", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := getBuffer()
+			*buf = response.appendJSON(*buf)
+			putBuffer(buf)
+		}
+	})
+}
+
+func BenchmarkStatementResponse(b *testing.B) {
+	response := &StatementResponse{
+		Balance: StatementBalanceResponse{Total: -9098, StatementAt: "2024-01-17T02:34:41.217753Z", Limit: 100000},
+	}
+	for i := 0; i < 10; i++ {
+		response.Transactions = append(response.Transactions, TransactionStatementResponse{
+			Amount:      10,
+			Kind:        "d",
+			Description: "descricao",
+			UpdatedAt:   "2024-01-17T02:34:38.543030Z",
+		})
+	}
+
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := json.Marshal(response); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("codec", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := getBuffer()
+			*buf = response.appendJSON(*buf)
+			putBuffer(buf)
+		}
+	})
+}
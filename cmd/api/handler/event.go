@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+)
+
+// eventsHeartbeat keeps the idle streams under the read timeout of the proxy, 30s in the nginx.
+const eventsHeartbeat = time.Second * 15
+
+type EventHandler struct {
+	logger *slog.Logger
+	svc    *domain.EventService
+}
+
+func NewEventHandler(logger *slog.Logger, svc *domain.EventService) *EventHandler {
+	return &EventHandler{
+		logger: logger,
+		svc:    svc,
+	}
+}
+
+// GET /clientes/:id/eventos
+// Streams the accepted transactions as Server-Sent Events, resuming after the Last-Event-ID
+// header sent by the EventSource when reconnecting. The stream ends when the subscriber falls
+// behind, or after replaying MaxReplayEvents, so the client resumes from its last event.
+func (h *EventHandler) StreamEvents(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	var lastEventID int
+	if header := c.GetHeader("Last-Event-ID"); header != "" {
+		lastEventID, err = strconv.Atoi(header)
+		if err != nil || lastEventID < 0 {
+			logger.DebugContext(ctx, "invalid last event id", "id", header, "error", err)
+			c.Status(422)
+			return
+		}
+	}
+
+	subscription, err := h.svc.Subscribe(ctx, clientID, lastEventID)
+	if errors.Is(err, domain.ErrClientDoesntExist) {
+		logger.DebugContext(ctx, "invalid client id", "id", clientID)
+		c.Status(404)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to subscribe to the events", "error", err)
+		c.Status(500)
+		return
+	}
+	defer subscription.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+	flush(c.Writer())
+
+	for _, e := range subscription.Replay {
+		if err := h.writeEvent(c, e); err != nil {
+			return
+		}
+	}
+	if subscription.Truncated {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-subscription.Events:
+			if !ok {
+				logger.DebugContext(ctx, "event subscription dropped", "clientID", clientID)
+				return
+			}
+			if !subscription.Fresh(e) {
+				continue
+			}
+			if err := h.writeEvent(c, e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer(), ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flush(c.Writer())
+		}
+	}
+}
+
+func (h *EventHandler) writeEvent(c transport.Context, e domain.TransactionEvent) error {
+	data, err := json.Marshal(EventResponse{
+		Amount:      e.Amount,
+		Kind:        e.Kind,
+		Description: e.Description,
+		Limit:       e.Limit,
+		Balance:     e.Balance,
+		OccurredAt:  e.OccurredAt.Format("2006-01-02T15:04:05.000000Z"),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(c.Writer(), "id: %d\nevent: transacao\ndata: %s\n\n", e.ID, data); err != nil {
+		return err
+	}
+	flush(c.Writer())
+
+	return nil
+}
+
+// flush sends the buffered events, both routers give a writer implementing http.Flusher.
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+type EventResponse struct {
+	Amount      domain.Money `json:"valor"`
+	Kind        string       `json:"tipo"`
+	Description string       `json:"descricao"`
+	Limit       domain.Money `json:"limite"`
+	Balance     domain.Money `json:"saldo"`
+	OccurredAt  string       `json:"realizada_em"`
+}
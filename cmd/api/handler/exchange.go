@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+)
+
+type ExchangeHandler struct {
+	logger *slog.Logger
+	svc    *domain.ExchangeService
+}
+
+func NewExchangeHandler(logger *slog.Logger, svc *domain.ExchangeService) *ExchangeHandler {
+	return &ExchangeHandler{
+		logger: logger,
+		svc:    svc,
+	}
+}
+
+// PUT /admin/cambio/:de/:para
+func (h *ExchangeHandler) SetRate(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+
+	request := ExchangeRateRequest{}
+	if err := c.DecodeJSON(&request); err != nil {
+		logger.DebugContext(ctx, "invalid request body", "error", err)
+		c.Status(422)
+		return
+	}
+
+	rate, err := h.svc.SetRate(ctx, c.Param("de"), c.Param("para"), request.Rate.String())
+	if errors.Is(err, domain.ErrInvalidCurrency) || errors.Is(err, domain.ErrInvalidExchangeRate) {
+		logger.DebugContext(ctx, "invalid exchange rate", "error", err)
+		c.Status(422)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to set the exchange rate", "error", err)
+		c.Status(500)
+		return
+	}
+
+	c.JSON(200, newExchangeRateResponse(rate))
+}
+
+// GET /admin/cambio
+func (h *ExchangeHandler) GetRates(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	rates, err := h.svc.GetRates(ctx)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to get the exchange rates", "error", err)
+		c.Status(500)
+		return
+	}
+
+	response := make([]ExchangeRateResponse, 0, len(rates))
+	for _, rate := range rates {
+		response = append(response, newExchangeRateResponse(&rate))
+	}
+
+	c.JSON(200, response)
+}
+
+type ExchangeRateRequest struct {
+	Rate json.Number `json:"taxa"`
+}
+
+type ExchangeRateResponse struct {
+	From      string `json:"de"`
+	To        string `json:"para"`
+	Rate      string `json:"taxa"`
+	UpdatedAt string `json:"atualizada_em"`
+}
+
+func newExchangeRateResponse(rate *domain.ExchangeRate) ExchangeRateResponse {
+	return ExchangeRateResponse{
+		From:      rate.From,
+		To:        rate.To,
+		Rate:      rate.Decimal(),
+		UpdatedAt: rate.UpdatedAt.Format("2006-01-02T15:04:05.000000Z"),
+	}
+}
@@ -4,10 +4,10 @@ import (
 	"errors"
 	"log/slog"
 	"strconv"
+	"strings"
 
+	"rinha-with-go-2024/cmd/api/transport"
 	"rinha-with-go-2024/internal/domain"
-
-	"github.com/gin-gonic/gin"
 )
 
 type ClientHandler struct {
@@ -23,43 +23,44 @@ func NewClientHandler(logger *slog.Logger, svc *domain.ClientService) *ClientHan
 }
 
 // POST /clientes/:id/transacoes
-func (h *ClientHandler) CreateTransaction(c *gin.Context) {
-	ctx := c.Request.Context()
+func (h *ClientHandler) CreateTransaction(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
 	clientID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		h.logger.Debug("invalid client id", "id", c.Param("id"), "error", err)
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
 		c.Status(404)
 		return
 	}
 
 	request := TransactionRequest{}
-	if err := c.BindJSON(&request); err != nil {
-		h.logger.Debug("invalid request body", "error", err)
-		c.Status(422)
+	if err := bindTransactionRequest(c, &request); err != nil {
+		logger.DebugContext(ctx, "invalid request body", "error", err, "overflow", errors.Is(err, domain.ErrMoneyOverflow))
+		writeUnprocessable(c, err)
 		return
 	}
 
-	t, err := domain.NewTransaction(
-		clientID,
-		request.Amount,
-		request.Kind,
-		request.Description,
-	)
+	t, err := request.toTransaction(clientID)
 	if err != nil {
-		h.logger.Debug("invalid transaction", "error", err)
+		logger.DebugContext(ctx, "invalid transaction", "error", err)
 		c.Status(422)
 		return
 	}
 
 	client, err := h.svc.CreateTransaction(ctx, t)
 	if errors.Is(err, domain.ErrClientDoesntExist) {
-		h.logger.Debug("invalid client id", "id", clientID)
+		logger.DebugContext(ctx, "invalid client id", "id", clientID)
 		c.Status(404)
 		return
 	}
+	if errors.Is(err, domain.ErrDuplicateReference) {
+		logger.DebugContext(ctx, "external reference already used", "id", clientID, "reference", t.ExternalReference)
+		c.Status(409)
+		return
+	}
 	if err != nil {
-		h.logger.Debug("the transaction was not perform correctly", "error", err)
-		c.Status(422)
+		logger.DebugContext(ctx, "the transaction was not perform correctly", "error", err)
+		writeUnprocessable(c, err)
 		return
 	}
 
@@ -67,62 +68,332 @@ func (h *ClientHandler) CreateTransaction(c *gin.Context) {
 		Limit:   client.Limit,
 		Balance: client.Balance,
 	}
-	c.JSON(200, response)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = response.appendJSON(*buf)
+	writeJSON(c, 200, *buf)
 }
 
 type TransactionRequest struct {
-	Amount      uint   `json:"valor"`
-	Kind        string `json:"tipo"`
-	Description string `json:"descricao"`
+	Amount      domain.Money    `json:"valor"`
+	Kind        string          `json:"tipo"`
+	Description string          `json:"descricao"`
+	Currency    string          `json:"moeda"`
+	Category    string          `json:"categoria"`
+	Metadata    domain.Metadata `json:"metadados"`
+	Reference   string          `json:"referencia_externa"`
+}
+
+func (r TransactionRequest) toTransaction(clientID int) (*domain.Transaction, error) {
+	t, err := domain.NewTransaction(
+		clientID,
+		r.Amount,
+		r.Kind,
+		r.Description,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.SetCurrency(r.Currency); err != nil {
+		return nil, err
+	}
+
+	if err := t.SetAnnotations(r.Category, r.Metadata); err != nil {
+		return nil, err
+	}
+
+	if err := t.SetExternalReference(r.Reference); err != nil {
+		return nil, err
+	}
+
+	return t, nil
 }
 
 type TransactionResponse struct {
-	Limit   int `json:"limite"`
-	Balance int `json:"saldo"`
+	Limit   domain.Money `json:"limite"`
+	Balance domain.Money `json:"saldo"`
+}
+
+// ErrorResponse has the same erro of the items of a batch.
+type ErrorResponse struct {
+	Error string `json:"erro"`
+}
+
+// writeUnprocessable responds 422, with the error in the body when the amounts overflow, so
+// it can be told apart from the other invalid transactions, like the items of a batch.
+func writeUnprocessable(c transport.Context, err error) {
+	if errors.Is(err, domain.ErrMoneyOverflow) {
+		c.JSON(422, ErrorResponse{Error: domain.ErrMoneyOverflow.Error()})
+		return
+	}
+
+	c.Status(422)
+}
+
+// POST /clientes/:id/transacoes/lote?atomico=false
+// The batch is all-or-nothing by default, with atomico=false only the failed items are skipped.
+func (h *ClientHandler) CreateTransactions(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	atomic := c.DefaultQuery("atomico", "true") != "false"
+
+	requests := []TransactionRequest{}
+	if err := c.DecodeJSON(&requests); err != nil {
+		logger.DebugContext(ctx, "invalid request body", "error", err)
+		writeUnprocessable(c, err)
+		return
+	}
+
+	items := make([]domain.BatchItem, 0, len(requests))
+	for _, request := range requests {
+		t, err := request.toTransaction(clientID)
+		items = append(items, domain.BatchItem{Transaction: t, Err: err})
+	}
+
+	err = h.svc.CreateTransactions(ctx, clientID, items, atomic)
+	if errors.Is(err, domain.ErrClientDoesntExist) {
+		logger.DebugContext(ctx, "invalid client id", "id", clientID)
+		c.Status(404)
+		return
+	}
+	if err != nil && !errors.Is(err, domain.ErrBatchRejected) {
+		logger.DebugContext(ctx, "the transaction batch was not perform correctly", "error", err)
+		writeUnprocessable(c, err)
+		return
+	}
+
+	rejected := err != nil
+	response := BatchTransactionResponse{
+		Results: make([]BatchItemResponse, 0, len(items)),
+	}
+	for i, item := range items {
+		result := BatchItemResponse{Index: i}
+		switch {
+		case item.Err != nil:
+			result.Error = item.Err.Error()
+		case rejected:
+			result.Error = domain.ErrBatchRejected.Error()
+		default:
+			result.Success = true
+			result.Limit = &item.Client.Limit
+			result.Balance = &item.Client.Balance
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	if rejected {
+		c.JSON(422, response)
+		return
+	}
+	c.JSON(200, response)
+}
+
+type BatchTransactionResponse struct {
+	Results []BatchItemResponse `json:"resultados"`
+}
+
+type BatchItemResponse struct {
+	Index   int           `json:"indice"`
+	Success bool          `json:"sucesso"`
+	Limit   *domain.Money `json:"limite,omitempty"`
+	Balance *domain.Money `json:"saldo,omitempty"`
+	Error   string        `json:"erro,omitempty"`
 }
 
 // GET /clientes/:id/extrato
-func (h *ClientHandler) GetStatement(c *gin.Context) {
-	ctx := c.Request.Context()
+func (h *ClientHandler) GetStatement(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
 	clientID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		h.logger.Debug("invalid client id", "id", c.Param("id"), "error", err)
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
 		c.Status(404)
 		return
 	}
 
 	client, transactions, err := h.svc.GetStatement(ctx, clientID)
 	if errors.Is(err, domain.ErrClientDoesntExist) {
-		h.logger.Debug("invalid client id", "id", clientID)
+		logger.DebugContext(ctx, "invalid client id", "id", clientID)
 		c.Status(404)
 		return
 	}
 	if err != nil {
-		h.logger.Error("error getting statement, maybe because of concorrent updates", "error", err)
+		logger.ErrorContext(ctx, "error getting statement, maybe because of concorrent updates", "error", err)
 		c.Status(422)
 		return
 	}
 
-	transactionsResponse := make([]TransactionStatementResponse, 0, len(transactions))
-	for _, t := range transactions {
-		transactionsResponse = append(transactionsResponse, TransactionStatementResponse{
-			Amount:      t.Amount,
-			Kind:        t.Kind,
-			Description: t.Description,
-			UpdatedAt:   t.UpdatedAt.Format("2006-01-02T15:04:05.000000Z"),
-		})
-	}
-
 	response := &StatementResponse{
 		Balance: StatementBalanceResponse{
 			Total:       client.Balance,
 			StatementAt: client.UpdatedAt.Format("2006-01-02T15:04:05.000000Z"),
 			Limit:       client.Limit,
+			Currency:    client.Currency,
 		},
-		Transactions: transactionsResponse,
+		Transactions: newTransactionsResponse(transactions),
 	}
 
-	c.JSON(200, response)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = response.appendJSON(*buf)
+	writeJSON(c, 200, *buf)
+}
+
+// PUT /admin/clientes/:id/moeda
+func (h *ClientHandler) SetCurrency(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	request := ClientCurrencyRequest{}
+	if err := c.DecodeJSON(&request); err != nil {
+		logger.DebugContext(ctx, "invalid request body", "error", err)
+		c.Status(422)
+		return
+	}
+
+	err = h.svc.SetCurrency(ctx, clientID, request.Currency)
+	if errors.Is(err, domain.ErrInvalidCurrency) {
+		logger.DebugContext(ctx, "invalid currency", "currency", request.Currency)
+		c.Status(422)
+		return
+	}
+	if errors.Is(err, domain.ErrClientDoesntExist) {
+		logger.DebugContext(ctx, "invalid client id", "id", clientID)
+		c.Status(404)
+		return
+	}
+	if errors.Is(err, domain.ErrCurrencyInUse) {
+		logger.DebugContext(ctx, "client already has transactions", "id", clientID, "currency", request.Currency)
+		c.Status(409)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to set the client's currency", "error", err)
+		c.Status(500)
+		return
+	}
+
+	c.Status(204)
+}
+
+type ClientCurrencyRequest struct {
+	Currency string `json:"moeda"`
+}
+
+// GET /clientes/:id/transacoes?categoria=mercado&metadados.canal=pix&limite=10
+// The metadata filters are compared as text, so metadados.parcelas=3 matches the number 3.
+func (h *ClientHandler) GetTransactions(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limite", "10"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid limit", "limit", c.Query("limite"), "error", err)
+		c.Status(422)
+		return
+	}
+
+	metadata := map[string]string{}
+	for key, values := range c.Request().URL.Query() {
+		if name, ok := strings.CutPrefix(key, "metadados."); ok && len(values) > 0 {
+			metadata[name] = values[0]
+		}
+	}
+
+	filter, err := domain.NewTransactionFilter(c.Query("categoria"), metadata, limit)
+	if err != nil {
+		logger.DebugContext(ctx, "invalid transaction filter", "error", err)
+		c.Status(422)
+		return
+	}
+
+	transactions, err := h.svc.GetTransactions(ctx, clientID, filter)
+	if errors.Is(err, domain.ErrClientDoesntExist) {
+		logger.DebugContext(ctx, "invalid client id", "id", clientID)
+		c.Status(404)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to get the transactions", "error", err)
+		c.Status(500)
+		return
+	}
+
+	c.JSON(200, TransactionsResponse{Transactions: newTransactionsResponse(transactions)})
+}
+
+// GET /clientes/:id/transacoes/por-referencia/:ref
+func (h *ClientHandler) GetTransactionByReference(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	t, err := h.svc.GetTransactionByReference(ctx, clientID, c.Param("ref"))
+	if errors.Is(err, domain.ErrTransactionNotFound) {
+		logger.DebugContext(ctx, "transaction not found", "id", clientID, "reference", c.Param("ref"))
+		c.Status(404)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to get the transaction", "error", err)
+		c.Status(500)
+		return
+	}
+
+	c.JSON(200, newTransactionsResponse([]domain.Transaction{*t})[0])
+}
+
+type TransactionsResponse struct {
+	Transactions []TransactionStatementResponse `json:"transacoes"`
+}
+
+func newTransactionsResponse(transactions []domain.Transaction) []TransactionStatementResponse {
+	response := make([]TransactionStatementResponse, 0, len(transactions))
+	for _, t := range transactions {
+		transaction := TransactionStatementResponse{
+			Amount:      t.Amount,
+			Kind:        t.Kind,
+			Description: t.Description,
+			Rate:        t.Rate,
+			Category:    t.Category,
+			Metadata:    t.Metadata,
+			Reference:   t.ExternalReference,
+			UpdatedAt:   t.UpdatedAt.Format("2006-01-02T15:04:05.000000Z"),
+		}
+		if t.Rate != "" {
+			transaction.Currency = t.Currency
+			transaction.OriginalAmount = &t.OriginalAmount
+		}
+		response = append(response, transaction)
+	}
+
+	return response
 }
 
 type StatementResponse struct {
@@ -131,14 +402,23 @@ type StatementResponse struct {
 }
 
 type StatementBalanceResponse struct {
-	Total       int    `json:"total"`
-	StatementAt string `json:"data_extrato"`
-	Limit       int    `json:"limite"`
+	Total       domain.Money `json:"total"`
+	StatementAt string       `json:"data_extrato"`
+	Limit       domain.Money `json:"limite"`
+	Currency    string       `json:"moeda"`
 }
 
+// The currency, the original amount and the rate are only present for the transactions converted
+// from another currency, and the category, the metadata and the reference when they were given.
 type TransactionStatementResponse struct {
-	Amount      uint   `json:"valor"`
-	Kind        string `json:"tipo"`
-	Description string `json:"descricao"`
-	UpdatedAt   string `json:"realizada_em"`
+	Amount         domain.Money    `json:"valor"`
+	Kind           string          `json:"tipo"`
+	Description    string          `json:"descricao"`
+	Currency       string          `json:"moeda,omitempty"`
+	OriginalAmount *domain.Money   `json:"valor_original,omitempty"`
+	Rate           string          `json:"taxa,omitempty"`
+	Category       string          `json:"categoria,omitempty"`
+	Metadata       domain.Metadata `json:"metadados,omitempty"`
+	Reference      string          `json:"referencia_externa,omitempty"`
+	UpdatedAt      string          `json:"realizada_em"`
 }
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+)
+
+type ScheduleHandler struct {
+	logger *slog.Logger
+	svc    *domain.ScheduleService
+}
+
+func NewScheduleHandler(logger *slog.Logger, svc *domain.ScheduleService) *ScheduleHandler {
+	return &ScheduleHandler{
+		logger: logger,
+		svc:    svc,
+	}
+}
+
+// POST /clientes/:id/agendamentos
+func (h *ScheduleHandler) CreateSchedule(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	request := ScheduleRequest{}
+	if err := c.DecodeJSON(&request); err != nil {
+		logger.DebugContext(ctx, "invalid request body", "error", err)
+		c.Status(422)
+		return
+	}
+
+	t, err := request.toTransaction(clientID)
+	if err != nil {
+		logger.DebugContext(ctx, "invalid transaction", "error", err)
+		c.Status(422)
+		return
+	}
+
+	var runAt time.Time
+	if request.RunAt != nil {
+		runAt = *request.RunAt
+	}
+
+	schedule, err := domain.NewScheduledTransaction(t, runAt, request.Recurrence, time.Now())
+	if err != nil {
+		logger.DebugContext(ctx, "invalid schedule", "error", err)
+		c.Status(422)
+		return
+	}
+
+	err = h.svc.CreateSchedule(ctx, schedule)
+	if errors.Is(err, domain.ErrClientDoesntExist) {
+		logger.DebugContext(ctx, "invalid client id", "id", clientID)
+		c.Status(404)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to create the schedule", "error", err)
+		c.Status(500)
+		return
+	}
+
+	c.JSON(201, newScheduleResponse(schedule))
+}
+
+// GET /clientes/:id/agendamentos
+func (h *ScheduleHandler) GetSchedules(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	schedules, err := h.svc.GetSchedules(ctx, clientID)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to get the schedules", "error", err)
+		c.Status(500)
+		return
+	}
+
+	response := make([]ScheduleResponse, 0, len(schedules))
+	for _, schedule := range schedules {
+		response = append(response, newScheduleResponse(&schedule))
+	}
+
+	c.JSON(200, response)
+}
+
+// DELETE /clientes/:id/agendamentos/:agendamento
+func (h *ScheduleHandler) CancelSchedule(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("agendamento"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid schedule id", "id", c.Param("agendamento"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	err = h.svc.CancelSchedule(ctx, clientID, scheduleID)
+	if errors.Is(err, domain.ErrScheduleNotFound) {
+		logger.DebugContext(ctx, "schedule not found", "id", scheduleID)
+		c.Status(404)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to cancel the schedule", "error", err)
+		c.Status(500)
+		return
+	}
+
+	c.Status(204)
+}
+
+// ScheduleRequest runs once at executar_em, or on every occurrence of the cron
+// expression in recorrencia, starting at executar_em when it is given.
+type ScheduleRequest struct {
+	TransactionRequest
+	RunAt      *time.Time `json:"executar_em"`
+	Recurrence string     `json:"recorrencia"`
+}
+
+type ScheduleResponse struct {
+	ID          int          `json:"id"`
+	Amount      domain.Money `json:"valor"`
+	Kind        string       `json:"tipo"`
+	Description string       `json:"descricao"`
+	Currency    string       `json:"moeda,omitempty"`
+	Recurrence  string       `json:"recorrencia,omitempty"`
+	NextRunAt   string       `json:"proxima_execucao"`
+	Status      string       `json:"status"`
+	Runs        int          `json:"execucoes"`
+	Failures    int          `json:"falhas"`
+	LastRunAt   string       `json:"ultima_execucao,omitempty"`
+	LastError   string       `json:"ultimo_erro,omitempty"`
+}
+
+func newScheduleResponse(s *domain.ScheduledTransaction) ScheduleResponse {
+	response := ScheduleResponse{
+		ID:          s.ID,
+		Amount:      s.Transaction.Amount,
+		Kind:        s.Transaction.Kind,
+		Description: s.Transaction.Description,
+		Currency:    s.Transaction.Currency,
+		Recurrence:  s.Recurrence,
+		NextRunAt:   s.NextRunAt.Format("2006-01-02T15:04:05.000000Z"),
+		Status:      s.Status,
+		Runs:        s.Runs,
+		Failures:    s.Failures,
+		LastError:   s.LastError,
+	}
+	if !s.LastRunAt.IsZero() {
+		response.LastRunAt = s.LastRunAt.Format("2006-01-02T15:04:05.000000Z")
+	}
+
+	return response
+}
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+)
+
+type WebhookHandler struct {
+	logger *slog.Logger
+	svc    *domain.WebhookService
+}
+
+func NewWebhookHandler(logger *slog.Logger, svc *domain.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		logger: logger,
+		svc:    svc,
+	}
+}
+
+// POST /clientes/:id/webhooks
+// The secret used to sign the payloads is only returned here.
+func (h *WebhookHandler) CreateSubscription(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	request := WebhookRequest{}
+	if err := c.DecodeJSON(&request); err != nil {
+		logger.DebugContext(ctx, "invalid request body", "error", err)
+		c.Status(422)
+		return
+	}
+
+	subscription, err := h.svc.CreateSubscription(ctx, clientID, request.URL, request.Events, request.Threshold)
+	if errors.Is(err, domain.ErrInvalidWebhook) {
+		logger.DebugContext(ctx, "invalid webhook", "error", err)
+		c.Status(422)
+		return
+	}
+	if errors.Is(err, domain.ErrClientDoesntExist) {
+		logger.DebugContext(ctx, "invalid client id", "id", clientID)
+		c.Status(404)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to create the webhook", "error", err)
+		c.Status(500)
+		return
+	}
+
+	response := newWebhookResponse(subscription)
+	response.Secret = subscription.Secret
+	c.JSON(201, response)
+}
+
+// GET /clientes/:id/webhooks
+func (h *WebhookHandler) GetSubscriptions(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	subscriptions, err := h.svc.GetSubscriptions(ctx, clientID)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to get the webhooks", "error", err)
+		c.Status(500)
+		return
+	}
+
+	response := make([]WebhookResponse, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		response = append(response, newWebhookResponse(&subscription))
+	}
+
+	c.JSON(200, response)
+}
+
+// DELETE /clientes/:id/webhooks/:webhook
+func (h *WebhookHandler) DeleteSubscription(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	subscriptionID, err := strconv.Atoi(c.Param("webhook"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid webhook id", "id", c.Param("webhook"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	err = h.svc.DeleteSubscription(ctx, clientID, subscriptionID)
+	if errors.Is(err, domain.ErrWebhookNotFound) {
+		logger.DebugContext(ctx, "webhook not found", "id", subscriptionID)
+		c.Status(404)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to delete the webhook", "error", err)
+		c.Status(500)
+		return
+	}
+
+	c.Status(204)
+}
+
+// GET /clientes/:id/webhooks/:webhook/entregas?limite=20
+func (h *WebhookHandler) GetDeliveries(c transport.Context) {
+	ctx := c.Request().Context()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	subscriptionID, err := strconv.Atoi(c.Param("webhook"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid webhook id", "id", c.Param("webhook"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limite", "20"))
+	if err != nil {
+		logger.DebugContext(ctx, "invalid limit", "limit", c.Query("limite"), "error", err)
+		c.Status(422)
+		return
+	}
+
+	deliveries, err := h.svc.GetDeliveries(ctx, clientID, subscriptionID, limit)
+	if errors.Is(err, domain.ErrInvalidWebhook) {
+		logger.DebugContext(ctx, "invalid limit", "limit", limit)
+		c.Status(422)
+		return
+	}
+	if errors.Is(err, domain.ErrWebhookNotFound) {
+		logger.DebugContext(ctx, "webhook not found", "id", subscriptionID)
+		c.Status(404)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to get the webhook deliveries", "error", err)
+		c.Status(500)
+		return
+	}
+
+	response := make([]DeliveryResponse, 0, len(deliveries))
+	for _, d := range deliveries {
+		response = append(response, newDeliveryResponse(&d))
+	}
+
+	c.JSON(200, response)
+}
+
+// WebhookRequest subscribes the url to the events in eventos, limiar is
+// the balance threshold required by the saldo_limiar event.
+type WebhookRequest struct {
+	URL       string        `json:"url"`
+	Events    []string      `json:"eventos"`
+	Threshold *domain.Money `json:"limiar"`
+}
+
+type WebhookResponse struct {
+	ID        int           `json:"id"`
+	URL       string        `json:"url"`
+	Events    []string      `json:"eventos"`
+	Threshold *domain.Money `json:"limiar,omitempty"`
+	Secret    string        `json:"segredo,omitempty"`
+	CreatedAt string        `json:"criado_em"`
+}
+
+func newWebhookResponse(s *domain.WebhookSubscription) WebhookResponse {
+	return WebhookResponse{
+		ID:        s.ID,
+		URL:       s.URL,
+		Events:    s.Events,
+		Threshold: s.Threshold,
+		CreatedAt: s.CreatedAt.Format("2006-01-02T15:04:05.000000Z"),
+	}
+}
+
+type DeliveryResponse struct {
+	ID             int             `json:"id"`
+	Event          string          `json:"evento"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"tentativas"`
+	NextAttemptAt  string          `json:"proxima_tentativa,omitempty"`
+	LastStatusCode int             `json:"ultimo_status,omitempty"`
+	LastError      string          `json:"ultimo_erro,omitempty"`
+	DeliveredAt    string          `json:"entregue_em,omitempty"`
+	CreatedAt      string          `json:"criado_em"`
+}
+
+func newDeliveryResponse(d *domain.WebhookDelivery) DeliveryResponse {
+	response := DeliveryResponse{
+		ID:             d.ID,
+		Event:          d.Event,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt.Format("2006-01-02T15:04:05.000000Z"),
+	}
+	if d.Status == domain.DeliveryPending {
+		response.NextAttemptAt = d.NextAttemptAt.Format("2006-01-02T15:04:05.000000Z")
+	}
+	if !d.DeliveredAt.IsZero() {
+		response.DeliveredAt = d.DeliveredAt.Format("2006-01-02T15:04:05.000000Z")
+	}
+
+	return response
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+
+	"golang.org/x/net/websocket"
+)
+
+// The messages of a connection are processed concurrently, up to socketMaxInFlight, after
+// which the connection isn't read, so TCP slows down the sender. While the pool is saturated,
+// the next message waits up to socketSaturationWait before being rejected as overloaded.
+const (
+	socketMaxInFlight    = 32
+	socketMaxMessageSize = 64 * 1024
+	socketMessageTimeout = time.Second * 30
+	socketSaturationWait = time.Second
+)
+
+var ErrOriginNotAllowed = errors.New("websocket origin not allowed")
+
+// The codes of the errors sent in the socket, with the status the HTTP API responds for them.
+const (
+	SocketInvalidRequest     = "requisicao_invalida"
+	SocketInvalidTransaction = "transacao_invalida"
+	SocketOverLimit          = "limite_excedido"
+	SocketClientNotFound     = "cliente_inexistente"
+	SocketDuplicateReference = "referencia_duplicada"
+	SocketOverloaded         = "sobrecarga"
+	SocketInternalError      = "erro_interno"
+)
+
+// LoadGauge tells whether new work would wait for a database connection, and waits for one
+// to be released, returning the error of the context when it is done before.
+type LoadGauge interface {
+	Saturated() bool
+	Wait(ctx context.Context) error
+}
+
+type SocketHandler struct {
+	logger  *slog.Logger
+	svc     *domain.ClientService
+	load    LoadGauge
+	origins []string
+}
+
+// NewSocketHandler accepts the browsers of the origins, like "https://parceiro.com.br", besides
+// the ones in the host of the API. The clients that aren't browsers send no origin.
+func NewSocketHandler(logger *slog.Logger, svc *domain.ClientService, load LoadGauge, origins []string) *SocketHandler {
+	return &SocketHandler{
+		logger:  logger,
+		svc:     svc,
+		load:    load,
+		origins: origins,
+	}
+}
+
+// GET /clientes/:id/ws
+// Each message is a TransactionRequest with a correlacao, answered with the same correlacao and
+// either the limite and saldo or the erro. The answers follow the completion order, not the
+// order of the messages. A browser from another origin is rejected with 403, so a page can't
+// use the credentials the browser keeps for the API.
+func (h *SocketHandler) Serve(c transport.Context) {
+	ctx := c.Request().Context()
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		domain.LoggerFromContext(ctx, h.logger).DebugContext(ctx, "invalid client id", "id", c.Param("id"), "error", err)
+		c.Status(404)
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			return h.checkOrigin(ctx, r)
+		},
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = socketMaxMessageSize
+			h.serve(ctx, ws, clientID)
+		},
+	}
+	server.ServeHTTP(c.Writer(), c.Request())
+}
+
+func (h *SocketHandler) serve(ctx context.Context, ws *websocket.Conn, clientID int) {
+	defer ws.Close()
+	logger := domain.LoggerFromContext(ctx, h.logger)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	inFlight := make(chan struct{}, socketMaxInFlight)
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			logger.DebugContext(ctx, "websocket closed", "clientID", clientID, "error", err)
+			return
+		}
+
+		request := SocketRequest{}
+		if err := json.Unmarshal(data, &request); err != nil {
+			logger.DebugContext(ctx, "invalid websocket message", "error", err)
+			h.send(ctx, ws, SocketResponse{
+				CorrelationID: request.CorrelationID,
+				Error:         &SocketError{Code: SocketInvalidRequest, Status: 422, Message: err.Error()},
+			})
+			continue
+		}
+
+		inFlight <- struct{}{}
+		if !h.waitForCapacity(ctx) {
+			h.send(ctx, ws, SocketResponse{
+				CorrelationID: request.CorrelationID,
+				Error:         &SocketError{Code: SocketOverloaded, Status: 503, Message: "database pool saturated"},
+			})
+			<-inFlight
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			h.send(ctx, ws, h.createTransaction(ctx, clientID, request))
+		}()
+	}
+}
+
+func (h *SocketHandler) checkOrigin(ctx context.Context, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil && u.Host == r.Host {
+		return nil
+	}
+	if slices.Contains(h.origins, origin) {
+		return nil
+	}
+
+	domain.LoggerFromContext(ctx, h.logger).DebugContext(ctx, "websocket origin not allowed", "origin", origin)
+	return ErrOriginNotAllowed
+}
+
+// waitForCapacity returns false when the pool is still saturated after socketSaturationWait.
+func (h *SocketHandler) waitForCapacity(ctx context.Context) bool {
+	if h.load == nil || !h.load.Saturated() {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, socketSaturationWait)
+	defer cancel()
+
+	return h.load.Wait(ctx) == nil
+}
+
+func (h *SocketHandler) createTransaction(ctx context.Context, clientID int, request SocketRequest) SocketResponse {
+	logger := domain.LoggerFromContext(ctx, h.logger)
+	response := SocketResponse{CorrelationID: request.CorrelationID}
+
+	t, err := request.toTransaction(clientID)
+	if err != nil {
+		logger.DebugContext(ctx, "invalid transaction", "error", err)
+		response.Error = newSocketError(err)
+		return response
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, socketMessageTimeout)
+	defer cancel()
+
+	client, err := h.svc.CreateTransaction(ctx, t)
+	if err != nil {
+		logger.DebugContext(ctx, "the transaction was not perform correctly", "error", err)
+		response.Error = newSocketError(err)
+		return response
+	}
+
+	response.TransactionResponse = &TransactionResponse{
+		Limit:   client.Limit,
+		Balance: client.Balance,
+	}
+	return response
+}
+
+// send is safe to call concurrently, since the frames are written under the lock of the connection.
+func (h *SocketHandler) send(ctx context.Context, ws *websocket.Conn, response SocketResponse) {
+	if err := websocket.JSON.Send(ws, response); err != nil {
+		domain.LoggerFromContext(ctx, h.logger).DebugContext(ctx, "failed to send the websocket response", "correlation", response.CorrelationID, "error", err)
+	}
+}
+
+type SocketRequest struct {
+	TransactionRequest
+	CorrelationID string `json:"correlacao"`
+}
+
+type SocketResponse struct {
+	CorrelationID string `json:"correlacao"`
+	*TransactionResponse
+	Error *SocketError `json:"erro,omitempty"`
+}
+
+type SocketError struct {
+	Code    string `json:"codigo"`
+	Status  int    `json:"status"`
+	Message string `json:"mensagem"`
+}
+
+func newSocketError(err error) *SocketError {
+	switch {
+	case errors.Is(err, domain.ErrTransactionOverClientLimit):
+		return &SocketError{Code: SocketOverLimit, Status: 422, Message: err.Error()}
+	case errors.Is(err, domain.ErrClientDoesntExist):
+		return &SocketError{Code: SocketClientNotFound, Status: 404, Message: err.Error()}
+	case errors.Is(err, domain.ErrDuplicateReference):
+		return &SocketError{Code: SocketDuplicateReference, Status: 409, Message: err.Error()}
+	case errors.Is(err, domain.ErrInvalidTransaction),
+		errors.Is(err, domain.ErrInvalidMetadata),
+		errors.Is(err, domain.ErrMoneyOverflow),
+		errors.Is(err, domain.ErrInvalidCurrency),
+		errors.Is(err, domain.ErrExchangeRateNotFound):
+		return &SocketError{Code: SocketInvalidTransaction, Status: 422, Message: err.Error()}
+	default:
+		return &SocketError{Code: SocketInternalError, Status: 500, Message: "internal error"}
+	}
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+type fakeClientRepository struct {
+	domain.ClientRepository
+	mu     sync.Mutex
+	client domain.Client
+}
+
+func (r *fakeClientRepository) ExecuteTransaction(ctx context.Context, t *domain.Transaction) (*domain.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t.ClientID != r.client.ID {
+		return nil, domain.ErrClientDoesntExist
+	}
+	if err := r.client.Apply(t); err != nil {
+		return nil, err
+	}
+
+	snapshot := r.client
+	return &snapshot, nil
+}
+
+// fakeLoadGauge is saturated until released, and its Wait fails unless released.
+type fakeLoadGauge struct {
+	mu        sync.Mutex
+	saturated bool
+	release   bool
+}
+
+func (g *fakeLoadGauge) Saturated() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.saturated
+}
+
+func (g *fakeLoadGauge) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.release {
+		return context.DeadlineExceeded
+	}
+	g.saturated = false
+	return nil
+}
+
+func initializeSocketServer(t *testing.T, load LoadGauge, origins []string) *httptest.Server {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000}}
+	h := NewSocketHandler(logger, domain.NewClientRepository(logger, repo), load, origins)
+
+	r := transport.NewServeMux()
+	r.Handle(http.MethodGet, "/clientes/:id/ws", h.Serve)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dialSocket(server *httptest.Server, origin string) (*websocket.Conn, error) {
+	return websocket.Dial(strings.Replace(server.URL, "http", "ws", 1)+"/clientes/1/ws", "", origin)
+}
+
+func roundTrip(t *testing.T, ws *websocket.Conn, message string) string {
+	assert.NoError(t, websocket.Message.Send(ws, message))
+
+	var response string
+	assert.NoError(t, websocket.Message.Receive(ws, &response))
+	return response
+}
+
+func TestSocketHandler_Serve(t *testing.T) {
+	t.Run("transactions are answered with their correlation", func(t *testing.T) {
+		server := initializeSocketServer(t, nil, nil)
+		ws, err := dialSocket(server, server.URL)
+		assert.NoError(t, err)
+		defer ws.Close()
+
+		response := roundTrip(t, ws, `{"correlacao": "1", "valor": 100, "tipo": "d", "descricao": "teste"}`)
+		assert.JSONEq(t, `{"correlacao":"1","limite":1000,"saldo":-100}`, response)
+
+		response = roundTrip(t, ws, `{"correlacao": "2", "valor": 1000, "tipo": "d", "descricao": "teste"}`)
+		assert.Contains(t, response, `"codigo":"limite_excedido","status":422`)
+	})
+
+	t.Run("invalid messages are answered without closing the socket", func(t *testing.T) {
+		server := initializeSocketServer(t, nil, nil)
+		ws, err := dialSocket(server, server.URL)
+		assert.NoError(t, err)
+		defer ws.Close()
+
+		response := roundTrip(t, ws, `{"correlacao": "1", "valor": `)
+		assert.Contains(t, response, `"codigo":"requisicao_invalida","status":422`)
+
+		response = roundTrip(t, ws, `{"correlacao": "2", "valor": 100, "tipo": "x", "descricao": "teste"}`)
+		assert.Contains(t, response, `"correlacao":"2"`)
+		assert.Contains(t, response, `"codigo":"transacao_invalida","status":422`)
+
+		response = roundTrip(t, ws, `{"correlacao": "3", "valor": 100, "tipo": "c", "descricao": "teste"}`)
+		assert.JSONEq(t, `{"correlacao":"3","limite":1000,"saldo":100}`, response)
+	})
+
+	t.Run("messages are rejected while the pool stays saturated", func(t *testing.T) {
+		load := &fakeLoadGauge{saturated: true}
+		server := initializeSocketServer(t, load, nil)
+		ws, err := dialSocket(server, server.URL)
+		assert.NoError(t, err)
+		defer ws.Close()
+
+		response := roundTrip(t, ws, `{"correlacao": "1", "valor": 100, "tipo": "c", "descricao": "teste"}`)
+		assert.Contains(t, response, `"codigo":"sobrecarga","status":503`)
+
+		load.mu.Lock()
+		load.release = true
+		load.mu.Unlock()
+
+		response = roundTrip(t, ws, `{"correlacao": "2", "valor": 100, "tipo": "c", "descricao": "teste"}`)
+		assert.JSONEq(t, `{"correlacao":"2","limite":1000,"saldo":100}`, response)
+	})
+
+	t.Run("browsers of other origins are rejected", func(t *testing.T) {
+		server := initializeSocketServer(t, nil, []string{"https://parceiro.com.br"})
+
+		_, err := dialSocket(server, "https://outro.com.br")
+		var dialErr *websocket.DialError
+		if assert.ErrorAs(t, err, &dialErr) {
+			assert.Equal(t, websocket.ErrBadStatus, dialErr.Err)
+		}
+
+		ws, err := dialSocket(server, "https://parceiro.com.br")
+		assert.NoError(t, err)
+		ws.Close()
+	})
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+)
+
+const PrincipalKey = "principal"
+
+// maxSignedBodySize bounds the body read to check the signature, above the largest batch of
+// transactions with their metadata.
+const maxSignedBodySize = 8 << 20
+
+type TokenValidator interface {
+	Validate(token string) (*domain.Principal, error)
+}
+
+// APIKeyAuthMiddleware authenticates the requests signed with HMAC using the client's API key.
+// It expects the headers X-Api-Key-Id, X-Timestamp, X-Nonce and X-Signature, requests without
+// the X-Api-Key-Id are left for the other authentication methods. Bodies over maxSignedBodySize
+// are rejected with 413.
+func APIKeyAuthMiddleware(logger *slog.Logger, svc *domain.AuthService) transport.Middleware {
+	return func(next transport.HandlerFunc) transport.HandlerFunc {
+		return func(c transport.Context) {
+			if c.GetHeader("X-Api-Key-Id") == "" {
+				next(c)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(c.Writer(), c.Request().Body, maxSignedBodySize))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				logger.DebugContext(c.Request().Context(), "request body too large", "limit", tooLarge.Limit)
+				c.Status(413)
+				return
+			}
+			if err != nil {
+				logger.DebugContext(c.Request().Context(), "failed to read the request body", "error", err)
+				c.Status(422)
+				return
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			clientID, err := svc.Authenticate(c.Request().Context(), domain.SignedRequest{
+				KeyID:     c.GetHeader("X-Api-Key-Id"),
+				Method:    c.Request().Method,
+				Path:      c.Request().URL.Path,
+				Query:     c.Request().URL.RawQuery,
+				Body:      body,
+				Timestamp: c.GetHeader("X-Timestamp"),
+				Nonce:     c.GetHeader("X-Nonce"),
+				Signature: c.GetHeader("X-Signature"),
+			})
+			if err != nil {
+				abortUnauthenticated(c, logger, err)
+				return
+			}
+
+			c.Set(PrincipalKey, &domain.Principal{ClientID: clientID, Scopes: domain.ClientScopes})
+			next(c)
+		}
+	}
+}
+
+// JWTAuthMiddleware authenticates the requests with a bearer token in the Authorization header,
+// requests without it are left for the other authentication methods.
+func JWTAuthMiddleware(logger *slog.Logger, v TokenValidator) transport.Middleware {
+	return func(next transport.HandlerFunc) transport.HandlerFunc {
+		return func(c transport.Context) {
+			tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if !ok {
+				next(c)
+				return
+			}
+
+			principal, err := v.Validate(tokenString)
+			if err != nil {
+				abortUnauthenticated(c, logger, err)
+				return
+			}
+
+			c.Set(PrincipalKey, principal)
+			next(c)
+		}
+	}
+}
+
+// RequireScope must run after the authentication middlewares, it rejects anonymous requests
+// with 401 and requests without the scope or to another client's path with 403.
+func RequireScope(logger *slog.Logger, scope string) transport.Middleware {
+	return func(next transport.HandlerFunc) transport.HandlerFunc {
+		return func(c transport.Context) {
+			value, ok := c.Get(PrincipalKey)
+			if !ok {
+				logger.DebugContext(c.Request().Context(), "request without credentials", "path", c.Request().URL.Path)
+				c.Status(401)
+				return
+			}
+			principal := value.(*domain.Principal)
+
+			if !principal.HasScope(scope) {
+				logger.DebugContext(c.Request().Context(), "principal without the required scope", "scope", scope, "clientID", principal.ClientID)
+				c.Status(403)
+				return
+			}
+
+			if id := c.Param("id"); id != "" {
+				clientID, err := strconv.Atoi(id)
+				if err != nil || !principal.CanAccessClient(clientID) {
+					logger.DebugContext(c.Request().Context(), "client id doesn't match the principal", "id", id, "clientID", principal.ClientID)
+					c.Status(403)
+					return
+				}
+			}
+
+			next(c)
+		}
+	}
+}
+
+func abortUnauthenticated(c transport.Context, logger *slog.Logger, err error) {
+	if errors.Is(err, domain.ErrUnauthorized) ||
+		errors.Is(err, domain.ErrRequestReplayed) ||
+		errors.Is(err, domain.ErrRequestOutOfTime) {
+		logger.DebugContext(c.Request().Context(), "request not authenticated", "error", err)
+		c.Status(401)
+		return
+	}
+
+	logger.ErrorContext(c.Request().Context(), "failed to authenticate the request", "error", err)
+	c.Status(500)
+}
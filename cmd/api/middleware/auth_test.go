@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAuthRepository struct {
+	keys   map[int]*domain.APIKey
+	nonces map[string]bool
+}
+
+func (r *fakeAuthRepository) CreateAPIKey(ctx context.Context, clientID int, hash string) (*domain.APIKey, error) {
+	key := &domain.APIKey{ID: len(r.keys) + 1, ClientID: clientID, Hash: hash}
+	r.keys[key.ID] = key
+	return key, nil
+}
+
+func (r *fakeAuthRepository) GetAPIKey(ctx context.Context, id int) (*domain.APIKey, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, domain.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (r *fakeAuthRepository) RegisterNonce(ctx context.Context, apiKeyID int, nonce string) error {
+	id := strconv.Itoa(apiKeyID) + ":" + nonce
+	if r.nonces[id] {
+		return domain.ErrRequestReplayed
+	}
+	r.nonces[id] = true
+	return nil
+}
+
+func (r *fakeAuthRepository) PurgeNonces(ctx context.Context, olderThan time.Duration) error {
+	return nil
+}
+
+type fakeTokenValidator map[string]*domain.Principal
+
+func (v fakeTokenValidator) Validate(token string) (*domain.Principal, error) {
+	principal, ok := v[token]
+	if !ok {
+		return nil, domain.ErrUnauthorized
+	}
+	return principal, nil
+}
+
+func TestAuthMiddlewares(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := domain.NewAuthService(logger, &fakeAuthRepository{keys: map[int]*domain.APIKey{}, nonces: map[string]bool{}}, time.Minute)
+	created, key, err := svc.CreateAPIKey(context.Background(), 1)
+	assert.NoError(t, err)
+
+	tokens := fakeTokenValidator{
+		"reader": {ClientID: 1, Scopes: []string{domain.ScopeStatementRead}},
+		"writer": {ClientID: 1, Scopes: domain.ClientScopes},
+		"admin":  {Scopes: []string{domain.ScopeAdmin}},
+	}
+
+	r := transport.NewServeMux()
+	auth := []transport.Middleware{APIKeyAuthMiddleware(logger, svc), JWTAuthMiddleware(logger, tokens)}
+	echo := func(c transport.Context) {
+		body, _ := io.ReadAll(c.Request().Body)
+		c.Writer().WriteHeader(200)
+		c.Writer().Write(body)
+	}
+	r.Handle(http.MethodPost, "/clientes/:id/transacoes",
+		transport.Chain(echo, append(auth, RequireScope(logger, domain.ScopeTransactionsWrite))...))
+
+	body := `{"valor": 10, "tipo": "c", "descricao": "teste"}`
+	signed := func(path, nonce, signatureKey string, at time.Time) *http.Request {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("X-Api-Key-Id", strconv.Itoa(created.ID))
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Nonce", nonce)
+		req.Header.Set("X-Signature", domain.SignRequest(signatureKey, http.MethodPost, req.URL.Path, req.URL.RawQuery, []byte(body), timestamp, nonce))
+		return req
+	}
+	tampered := func(path, nonce, query string) *http.Request {
+		req := signed(path, nonce, key, time.Now())
+		req.URL.RawQuery = query
+		return req
+	}
+	bearer := func(path, token string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{name: "valid signature", req: signed("/clientes/1/transacoes", "nonce-1", key, time.Now()), status: 200},
+		{name: "replayed nonce", req: signed("/clientes/1/transacoes", "nonce-1", key, time.Now()), status: 401},
+		{name: "valid signature with a query", req: signed("/clientes/1/transacoes?atomico=true", "nonce-5", key, time.Now()), status: 200},
+		{name: "tampered query", req: tampered("/clientes/1/transacoes?atomico=true", "nonce-6", "atomico=false"), status: 401},
+		{name: "query added after signed", req: tampered("/clientes/1/transacoes", "nonce-7", "atomico=false"), status: 401},
+		{name: "bad signature", req: signed("/clientes/1/transacoes", "nonce-2", "another key", time.Now()), status: 401},
+		{name: "clock skew", req: signed("/clientes/1/transacoes", "nonce-3", key, time.Now().Add(-time.Hour)), status: 401},
+		{name: "nonce longer than the column", req: signed("/clientes/1/transacoes", strings.Repeat("n", domain.MaxNonceLength+1), key, time.Now()), status: 401},
+		{name: "api key of another client", req: signed("/clientes/2/transacoes", "nonce-4", key, time.Now()), status: 403},
+		{name: "without credentials", req: httptest.NewRequest(http.MethodPost, "/clientes/1/transacoes", strings.NewReader(body)), status: 401},
+		{name: "unknown token", req: bearer("/clientes/1/transacoes", "unknown"), status: 401},
+		{name: "token without the scope", req: bearer("/clientes/1/transacoes", "reader"), status: 403},
+		{name: "token with the scope", req: bearer("/clientes/1/transacoes", "writer"), status: 200},
+		{name: "token of another client", req: bearer("/clientes/2/transacoes", "writer"), status: 403},
+		{name: "admin token on any client", req: bearer("/clientes/2/transacoes", "admin"), status: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, tt.req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == 200 {
+				assert.Equal(t, body, w.Body.String(), "the body is still readable after authenticated")
+			}
+		})
+	}
+
+	t.Run("body over the limit", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/clientes/1/transacoes", strings.NewReader(strings.Repeat(" ", maxSignedBodySize+1)))
+		req.Header.Set("X-Api-Key-Id", strconv.Itoa(created.ID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, 413, w.Code)
+	})
+}
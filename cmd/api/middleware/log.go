@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+	"rinha-with-go-2024/internal/infra/logger"
+)
+
+const (
+	DebugHeader     = "X-Log-Debug"
+	RequestIDHeader = "X-Request-ID"
+)
+
+// maxRequestID limits the request IDs accepted from the clients, longer ones are replaced.
+const maxRequestID = 128
+
+// DebugLogMiddleware logs every debug line of the requests with the X-Log-Debug: 1 header,
+// whatever the level and the sample of the logger, to follow a single request in production.
+func DebugLogMiddleware() transport.Middleware {
+	return func(next transport.HandlerFunc) transport.HandlerFunc {
+		return func(c transport.Context) {
+			if c.GetHeader(DebugHeader) == "1" {
+				c.SetRequest(c.Request().WithContext(logger.WithDebug(c.Request().Context())))
+			}
+
+			next(c)
+		}
+	}
+}
+
+// RequestIDMiddleware keeps the X-Request-ID of the request, or generates one, and echoes it
+// in the response. The handlers, the services and the repositories log with the logger in
+// the context, which has the request ID, the client ID and the route of the request.
+func RequestIDMiddleware(log *slog.Logger) transport.Middleware {
+	return func(next transport.HandlerFunc) transport.HandlerFunc {
+		return func(c transport.Context) {
+			id := c.GetHeader(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			c.Header(RequestIDHeader, id)
+
+			attrs := make([]slog.Attr, 3, 4)
+			attrs[0] = slog.String("requestID", id)
+			attrs[1] = slog.String("method", c.Request().Method)
+			attrs[2] = slog.String("route", c.Route())
+			if clientID, err := strconv.Atoi(c.Param("id")); err == nil {
+				attrs = append(attrs, slog.Int("clientID", clientID))
+			}
+
+			ctx := domain.ContextWithLogger(c.Request().Context(), logger.WithRecordAttrs(log, attrs...))
+			c.SetRequest(c.Request().WithContext(ctx))
+			next(c)
+		}
+	}
+}
+
+func newRequestID() string {
+	var id [8]byte
+	binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	return hex.EncodeToString(id[:])
+}
+
+// validRequestID accepts the usual formats, as UUIDs, without letting a client forge the log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		switch b := id[i]; {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9', b == '-', b == '_', b == '.', b == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -2,21 +2,89 @@ package router
 
 import (
 	"log/slog"
+	"net/http"
+	"slices"
+
 	"rinha-with-go-2024/cmd/api/handler"
+	"rinha-with-go-2024/cmd/api/middleware"
+	"rinha-with-go-2024/cmd/api/transport"
 	"rinha-with-go-2024/internal/domain"
-
-	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(logger *slog.Logger, r *gin.Engine, svc *domain.ClientService) {
-	h := handler.NewClientHandler(logger, svc)
+type Services struct {
+	Client   *domain.ClientService
+	Auth     *domain.AuthService
+	Exchange *domain.ExchangeService
+	Schedule *domain.ScheduleService
+	Accrual  *domain.AccrualService
+	Webhook  *domain.WebhookService
+	Events   *domain.EventService
+	Load     handler.LoadGauge
+	Origins  []string
+}
+
+// SetupRoutes keeps the client routes anonymous when there are no authentication
+// middlewares, given the Rinha load test doesn't authenticate. The admin routes always
+// require the admin scope. The event stream and the webhooks are only served when their
+// services are given, and the webhooks always require the client's credentials, since
+// they send its balances to any URL.
+func SetupRoutes(logger *slog.Logger, r transport.Router, s Services, auth ...transport.Middleware) {
+	h := handler.NewClientHandler(logger, s.Client)
+	ah := handler.NewAdminHandler(logger, s.Auth)
+	eh := handler.NewExchangeHandler(logger, s.Exchange)
+	sh := handler.NewScheduleHandler(logger, s.Schedule)
+	ach := handler.NewAccrualHandler(logger, s.Accrual)
+	wsh := handler.NewSocketHandler(logger, s.Client, s.Load, s.Origins)
 
-	r.GET("/ping", func(c *gin.Context) {
-		c.JSON(200, gin.H{
+	client := func(method, path, scope string, h transport.HandlerFunc) {
+		middlewares := auth
+		if len(auth) > 0 {
+			middlewares = append(slices.Clip(auth), middleware.RequireScope(logger, scope))
+		}
+		r.Handle(method, "/clientes/:id"+path, transport.Chain(h, middlewares...))
+	}
+
+	authenticated := func(method, path, scope string, h transport.HandlerFunc) {
+		r.Handle(method, "/clientes/:id"+path, transport.Chain(h, append(slices.Clip(auth), middleware.RequireScope(logger, scope))...))
+	}
+
+	adminAuth := append(slices.Clip(auth), middleware.RequireScope(logger, domain.ScopeAdmin))
+	admin := func(method, path string, h transport.HandlerFunc) {
+		r.Handle(method, "/admin"+path, transport.Chain(h, adminAuth...))
+	}
+
+	r.Handle(http.MethodGet, "/ping", func(c transport.Context) {
+		c.JSON(200, map[string]string{
 			"message": "pong",
 		})
 	})
 
-	r.POST("/clientes/:id/transacoes", h.CreateTransaction)
-	r.GET("/clientes/:id/extrato", h.GetStatement)
+	client(http.MethodPost, "/transacoes", domain.ScopeTransactionsWrite, h.CreateTransaction)
+	client(http.MethodGet, "/transacoes", domain.ScopeStatementRead, h.GetTransactions)
+	client(http.MethodGet, "/transacoes/por-referencia/:ref", domain.ScopeStatementRead, h.GetTransactionByReference)
+	client(http.MethodPost, "/transacoes/lote", domain.ScopeTransactionsWrite, h.CreateTransactions)
+	client(http.MethodGet, "/ws", domain.ScopeTransactionsWrite, wsh.Serve)
+	client(http.MethodGet, "/extrato", domain.ScopeStatementRead, h.GetStatement)
+	client(http.MethodPost, "/agendamentos", domain.ScopeTransactionsWrite, sh.CreateSchedule)
+	client(http.MethodGet, "/agendamentos", domain.ScopeStatementRead, sh.GetSchedules)
+	client(http.MethodDelete, "/agendamentos/:agendamento", domain.ScopeTransactionsWrite, sh.CancelSchedule)
+	if s.Webhook != nil {
+		wh := handler.NewWebhookHandler(logger, s.Webhook)
+		authenticated(http.MethodPost, "/webhooks", domain.ScopeTransactionsWrite, wh.CreateSubscription)
+		authenticated(http.MethodGet, "/webhooks", domain.ScopeStatementRead, wh.GetSubscriptions)
+		authenticated(http.MethodDelete, "/webhooks/:webhook", domain.ScopeTransactionsWrite, wh.DeleteSubscription)
+		authenticated(http.MethodGet, "/webhooks/:webhook/entregas", domain.ScopeStatementRead, wh.GetDeliveries)
+	}
+	if s.Events != nil {
+		evh := handler.NewEventHandler(logger, s.Events)
+		client(http.MethodGet, "/eventos", domain.ScopeStatementRead, evh.StreamEvents)
+	}
+
+	admin(http.MethodPost, "/clientes/:id/chaves", ah.CreateAPIKey)
+	admin(http.MethodPut, "/clientes/:id/moeda", h.SetCurrency)
+	admin(http.MethodGet, "/cambio", eh.GetRates)
+	admin(http.MethodPut, "/cambio/:de/:para", eh.SetRate)
+	admin(http.MethodGet, "/produtos", ach.GetProducts)
+	admin(http.MethodPut, "/produtos/:produto", ach.SetProduct)
+	admin(http.MethodPut, "/clientes/:id/produto", ach.SetClientProduct)
 }
@@ -0,0 +1,343 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/cmd/api/middleware"
+	"rinha-with-go-2024/cmd/api/transport"
+	"rinha-with-go-2024/internal/domain"
+	"rinha-with-go-2024/internal/infra/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClientRepository struct {
+	domain.ClientRepository
+	mu     sync.Mutex
+	client domain.Client
+}
+
+func (r *fakeClientRepository) ExecuteTransaction(ctx context.Context, t *domain.Transaction) (*domain.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t.ClientID != r.client.ID {
+		return nil, domain.ErrClientDoesntExist
+	}
+	if err := r.client.Apply(t); err != nil {
+		return nil, err
+	}
+
+	snapshot := r.client
+	return &snapshot, nil
+}
+
+func (r *fakeClientRepository) GetStatement(ctx context.Context, clientID int) (*domain.Statement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if clientID != r.client.ID {
+		return nil, domain.ErrClientDoesntExist
+	}
+
+	snapshot := r.client
+	transactions := []domain.Transaction{
+		{Amount: 100, Kind: "c", Description: "deposito", UpdatedAt: snapshot.UpdatedAt},
+		{Amount: 50, Kind: "d", Description: "mercado", Currency: domain.DefaultCurrency, UpdatedAt: snapshot.UpdatedAt},
+	}
+	return &domain.Statement{Client: &snapshot, Transactions: transactions}, nil
+}
+
+func initializeRouters() map[string]transport.Router {
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	routers := map[string]transport.Router{
+		"gin":     transport.NewGinRouter(gin.New()),
+		"nethttp": transport.NewServeMux(),
+	}
+	for _, r := range routers {
+		repo := &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000, UpdatedAt: time.Unix(0, 0).UTC()}}
+		SetupRoutes(logger, r, Services{Client: domain.NewClientRepository(logger, repo)})
+	}
+
+	return routers
+}
+
+func TestSetupRoutes(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		json   string
+	}{
+		{
+			name:   "ping",
+			method: http.MethodGet,
+			path:   "/ping",
+			status: 200,
+			json:   `{"message":"pong"}`,
+		},
+		{
+			name:   "valid transaction",
+			method: http.MethodPost,
+			path:   "/clientes/1/transacoes",
+			body:   `{"valor": 100, "tipo": "d", "descricao": "teste"}`,
+			status: 200,
+			json:   `{"limite":1000,"saldo":-100}`,
+		},
+		{
+			name:   "over the limit",
+			method: http.MethodPost,
+			path:   "/clientes/1/transacoes",
+			body:   `{"valor": 1000, "tipo": "d", "descricao": "teste"}`,
+			status: 422,
+		},
+		{
+			name:   "invalid body",
+			method: http.MethodPost,
+			path:   "/clientes/1/transacoes",
+			body:   `{"valor": 1.5, "tipo": "d", "descricao": "teste"}`,
+			status: 422,
+		},
+		{
+			name:   "amount overflows",
+			method: http.MethodPost,
+			path:   "/clientes/1/transacoes",
+			body:   `{"valor": 9223372036854775808, "tipo": "c", "descricao": "teste"}`,
+			status: 422,
+			json:   `{"erro":"money overflow"}`,
+		},
+		{
+			name:   "batch amount overflows",
+			method: http.MethodPost,
+			path:   "/clientes/1/transacoes/lote",
+			body:   `[{"valor": 9223372036854775808, "tipo": "c", "descricao": "teste"}]`,
+			status: 422,
+			json:   `{"erro":"money overflow"}`,
+		},
+		{
+			name:   "body over the limit",
+			method: http.MethodPost,
+			path:   "/clientes/1/transacoes",
+			body:   `{"valor": 100, "tipo": "c", "descricao": "teste"}` + strings.Repeat(" ", 8*1024),
+			status: 422,
+		},
+		{
+			name:   "data after the object",
+			method: http.MethodPost,
+			path:   "/clientes/1/transacoes",
+			body:   `{"valor": 100, "tipo": "c", "descricao": "teste"} {}`,
+			status: 422,
+		},
+		{
+			name:   "client doesn't exist",
+			method: http.MethodPost,
+			path:   "/clientes/6/transacoes",
+			body:   `{"valor": 100, "tipo": "c", "descricao": "teste"}`,
+			status: 404,
+		},
+		{
+			name:   "invalid client id",
+			method: http.MethodGet,
+			path:   "/clientes/abc/extrato",
+			status: 404,
+		},
+		{
+			name:   "statement",
+			method: http.MethodGet,
+			path:   "/clientes/1/extrato",
+			status: 200,
+			json: `{"saldo":{"total":-100,"data_extrato":"1970-01-01T00:00:00.000000Z","limite":1000,"moeda":""},"ultimas_transacoes":[` +
+				`{"valor":100,"tipo":"c","descricao":"deposito","realizada_em":"1970-01-01T00:00:00.000000Z"},` +
+				`{"valor":50,"tipo":"d","descricao":"mercado","realizada_em":"1970-01-01T00:00:00.000000Z"}]}`,
+		},
+	}
+
+	for name, r := range initializeRouters() {
+		t.Run(name, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					w := httptest.NewRecorder()
+					r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+					assert.Equal(t, tt.status, w.Code)
+					if tt.json != "" {
+						assert.JSONEq(t, tt.json, w.Body.String())
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestDebugLogMiddleware(t *testing.T) {
+	level, err := logger.NewLevel("ERROR", 0)
+	assert.NoError(t, err)
+
+	for name, r := range initializeRouters() {
+		t.Run(name, func(t *testing.T) {
+			var out strings.Builder
+			log := slog.New(logger.NewHandler(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}), level))
+
+			transport.Use(r, middleware.DebugLogMiddleware()).Handle(http.MethodGet, "/debug/:id", func(c transport.Context) {
+				log.DebugContext(c.Request().Context(), "debugging", "id", c.Param("id"))
+				c.Status(204)
+			})
+
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/debug/1", nil))
+			assert.Empty(t, out.String())
+
+			req := httptest.NewRequest(http.MethodGet, "/debug/2", nil)
+			req.Header.Set(middleware.DebugHeader, "1")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, 204, w.Code)
+			assert.Contains(t, out.String(), `"id":"2"`)
+		})
+	}
+}
+
+func TestSetupRoutes_Webhooks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	clients := domain.NewClientRepository(logger, &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000}})
+	webhooks := domain.NewWebhookService(logger, nil, nil)
+
+	// asClient2 stands for the authentication middlewares, as a client authenticated with its credentials.
+	asClient2 := func(next transport.HandlerFunc) transport.HandlerFunc {
+		return func(c transport.Context) {
+			if c.GetHeader("Authorization") != "" {
+				c.Set(middleware.PrincipalKey, &domain.Principal{ClientID: 2, Scopes: domain.ClientScopes})
+			}
+			next(c)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		services Services
+		auth     []transport.Middleware
+		header   string
+		status   int
+	}{
+		{name: "not served when disabled", services: Services{Client: clients}, status: 404},
+		{name: "anonymous without authentication enabled", services: Services{Client: clients, Webhook: webhooks}, status: 401},
+		{name: "anonymous with authentication enabled", services: Services{Client: clients, Webhook: webhooks}, auth: []transport.Middleware{asClient2}, status: 401},
+		{name: "another client", services: Services{Client: clients, Webhook: webhooks}, auth: []transport.Middleware{asClient2}, header: "Bearer token", status: 403},
+	}
+
+	for _, tt := range tests {
+		routers := map[string]transport.Router{
+			"gin":     transport.NewGinRouter(gin.New()),
+			"nethttp": transport.NewServeMux(),
+		}
+		for name, r := range routers {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				SetupRoutes(logger, r, tt.services, tt.auth...)
+
+				req := httptest.NewRequest(http.MethodPost, "/clientes/1/webhooks", strings.NewReader(`{"url": "http://localhost:9090", "eventos": ["debito_recusado"]}`))
+				req.Header.Set("Authorization", tt.header)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.status, w.Code)
+			})
+		}
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	routers := map[string]transport.Router{
+		"gin":     transport.NewGinRouter(gin.New()),
+		"nethttp": transport.NewServeMux(),
+	}
+
+	for name, r := range routers {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			log := slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			repo := &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000}}
+			SetupRoutes(log, transport.Use(r, middleware.RequestIDMiddleware(log)), Services{Client: domain.NewClientRepository(log, repo)})
+
+			t.Run("every line of a failed debit has the request id", func(t *testing.T) {
+				out.Reset()
+				req := httptest.NewRequest(http.MethodPost, "/clientes/1/transacoes", strings.NewReader(`{"valor": 5000, "tipo": "d", "descricao": "teste"}`))
+				req.Header.Set(middleware.RequestIDHeader, "0b7c1f6e-5d2a-4c11-9f0e-3a1d2b4c5e6f")
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				assert.Equal(t, 422, w.Code)
+				assert.Equal(t, "0b7c1f6e-5d2a-4c11-9f0e-3a1d2b4c5e6f", w.Header().Get(middleware.RequestIDHeader))
+
+				lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+				assert.Len(t, lines, 2)
+				for _, line := range lines {
+					var record map[string]any
+					assert.NoError(t, json.Unmarshal([]byte(line), &record))
+					assert.Equal(t, "0b7c1f6e-5d2a-4c11-9f0e-3a1d2b4c5e6f", record["requestID"], line)
+					assert.Equal(t, "/clientes/:id/transacoes", record["route"], line)
+					assert.Equal(t, float64(1), record["clientID"], line)
+				}
+			})
+
+			t.Run("a missing or invalid request id is generated", func(t *testing.T) {
+				for _, id := range []string{"", "forged\nline", strings.Repeat("a", 129)} {
+					req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+					req.Header.Set(middleware.RequestIDHeader, id)
+					w := httptest.NewRecorder()
+					r.ServeHTTP(w, req)
+
+					assert.Regexp(t, "^[0-9a-f]{16}$", w.Header().Get(middleware.RequestIDHeader), id)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkRouters compares the allocations per request of the routers, run it with
+// go test ./cmd/api/router -bench . -benchmem
+func BenchmarkRouters(b *testing.B) {
+	requests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "transaction", method: http.MethodPost, path: "/clientes/1/transacoes", body: `{"valor": 1, "tipo": "c", "descricao": "teste"}`},
+		{name: "statement", method: http.MethodGet, path: "/clientes/1/extrato"},
+	}
+
+	routers := initializeRouters()
+	for _, name := range slices.Sorted(maps.Keys(routers)) {
+		r := routers[name]
+		for _, request := range requests {
+			b.Run(name+"/"+request.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					w := httptest.NewRecorder()
+					r.ServeHTTP(w, httptest.NewRequest(request.method, request.path, strings.NewReader(request.body)))
+					if w.Code != 200 {
+						b.Fatalf("unexpected status %d", w.Code)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"rinha-with-go-2024/cmd/api/rpc/pb"
+	"rinha-with-go-2024/internal/domain"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type TokenValidator interface {
+	Validate(token string) (*domain.Principal, error)
+}
+
+// scopes are the scopes required by each method, like the ones of the HTTP routes.
+var scopes = map[string]string{
+	pb.Clients_CreateTransaction_FullMethodName: domain.ScopeTransactionsWrite,
+	pb.Clients_GetStatement_FullMethodName:      domain.ScopeStatementRead,
+	pb.Clients_WatchBalance_FullMethodName:      domain.ScopeStatementRead,
+}
+
+// Authenticator takes the same credentials of the HTTP API in the metadata, either a bearer
+// token in authorization, or the x-api-key-id, x-timestamp, x-nonce and x-signature. The
+// signature covers POST, the full method and the request marshalled deterministically.
+// Either of the services may be nil, when its authentication is disabled.
+type Authenticator struct {
+	logger  *slog.Logger
+	apiKeys *domain.AuthService
+	tokens  TokenValidator
+}
+
+func NewAuthenticator(logger *slog.Logger, apiKeys *domain.AuthService, tokens TokenValidator) *Authenticator {
+	return &Authenticator{logger: logger, apiKeys: apiKeys, tokens: tokens}
+}
+
+// authorize rejects the calls without credentials with Unauthenticated, and the ones without
+// the scope of the method or to another client with PermissionDenied.
+func (a *Authenticator) authorize(ctx context.Context, method string, req proto.Message) error {
+	principal, err := a.authenticate(ctx, method, req)
+	if err != nil {
+		if errors.Is(err, domain.ErrUnauthorized) ||
+			errors.Is(err, domain.ErrRequestReplayed) ||
+			errors.Is(err, domain.ErrRequestOutOfTime) {
+			a.logger.DebugContext(ctx, "call not authenticated", "method", method, "error", err)
+			return status.Error(codes.Unauthenticated, "unauthenticated")
+		}
+
+		a.logger.ErrorContext(ctx, "failed to authenticate the call", "method", method, "error", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	scope, ok := scopes[method]
+	if !ok || !principal.HasScope(scope) {
+		a.logger.DebugContext(ctx, "principal without the required scope", "method", method, "clientID", principal.ClientID)
+		return status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	if r, ok := req.(interface{ GetClientId() int32 }); ok && !principal.CanAccessClient(int(r.GetClientId())) {
+		a.logger.DebugContext(ctx, "client id doesn't match the principal", "id", r.GetClientId(), "clientID", principal.ClientID)
+		return status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	return nil
+}
+
+func (a *Authenticator) authenticate(ctx context.Context, method string, req proto.Message) (*domain.Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	if keyID := get("x-api-key-id"); keyID != "" && a.apiKeys != nil {
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+
+		clientID, err := a.apiKeys.Authenticate(ctx, domain.SignedRequest{
+			KeyID:     keyID,
+			Method:    "POST",
+			Path:      method,
+			Body:      body,
+			Timestamp: get("x-timestamp"),
+			Nonce:     get("x-nonce"),
+			Signature: get("x-signature"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &domain.Principal{ClientID: clientID, Scopes: domain.ClientScopes}, nil
+	}
+
+	if token, ok := strings.CutPrefix(get("authorization"), "Bearer "); ok && a.tokens != nil {
+		return a.tokens.Validate(token)
+	}
+
+	return nil, domain.ErrUnauthorized
+}
+
+func AuthUnaryInterceptor(a *Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		message, ok := req.(proto.Message)
+		if !ok {
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+		if err := a.authorize(ctx, info.FullMethod, message); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor authorizes the streams on their request, received before the handler runs.
+func AuthStreamInterceptor(a *Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &authorizedStream{ServerStream: ss, authenticator: a, method: info.FullMethod})
+	}
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	authenticator *Authenticator
+	method        string
+}
+
+func (s *authorizedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	message, ok := m.(proto.Message)
+	if !ok {
+		return status.Error(codes.Internal, "internal error")
+	}
+	return s.authenticator.authorize(s.Context(), s.method, message)
+}
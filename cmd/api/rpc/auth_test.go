@@ -0,0 +1,179 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/cmd/api/rpc/pb"
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+type fakeAuthRepository struct {
+	mu     sync.Mutex
+	keys   map[int]*domain.APIKey
+	nonces map[string]bool
+}
+
+func (r *fakeAuthRepository) CreateAPIKey(ctx context.Context, clientID int, hash string) (*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := &domain.APIKey{ID: len(r.keys) + 1, ClientID: clientID, Hash: hash}
+	r.keys[key.ID] = key
+	return key, nil
+}
+
+func (r *fakeAuthRepository) GetAPIKey(ctx context.Context, id int) (*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, domain.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (r *fakeAuthRepository) RegisterNonce(ctx context.Context, apiKeyID int, nonce string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := strconv.Itoa(apiKeyID) + ":" + nonce
+	if r.nonces[id] {
+		return domain.ErrRequestReplayed
+	}
+	r.nonces[id] = true
+	return nil
+}
+
+func (r *fakeAuthRepository) PurgeNonces(ctx context.Context, olderThan time.Duration) error {
+	return nil
+}
+
+type fakeTokenValidator map[string]*domain.Principal
+
+func (v fakeTokenValidator) Validate(token string) (*domain.Principal, error) {
+	principal, ok := v[token]
+	if !ok {
+		return nil, domain.ErrUnauthorized
+	}
+	return principal, nil
+}
+
+func initializeAuthClient(t *testing.T, auth *Authenticator) pb.ClientsClient {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := domain.NewClientRepository(logger, &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000}})
+	server := NewServer(logger, svc, nil, time.Second, auth)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewClientsClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestAuthenticator(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	authSvc := domain.NewAuthService(logger, &fakeAuthRepository{keys: map[int]*domain.APIKey{}, nonces: map[string]bool{}}, time.Minute)
+	created, key, err := authSvc.CreateAPIKey(context.Background(), 1)
+	assert.NoError(t, err)
+
+	tokens := fakeTokenValidator{
+		"reader": {ClientID: 1, Scopes: []string{domain.ScopeStatementRead}},
+		"other":  {ClientID: 2, Scopes: domain.ClientScopes},
+	}
+	client := initializeAuthClient(t, NewAuthenticator(logger, authSvc, tokens))
+
+	signed := func(req proto.Message, nonce, signatureKey string) context.Context {
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+		assert.NoError(t, err)
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+		return metadata.AppendToOutgoingContext(context.Background(),
+			"x-api-key-id", strconv.Itoa(created.ID),
+			"x-timestamp", timestamp,
+			"x-nonce", nonce,
+			"x-signature", domain.SignRequest(signatureKey, "POST", pb.Clients_CreateTransaction_FullMethodName, "", body, timestamp, nonce),
+		)
+	}
+
+	debit := &pb.CreateTransactionRequest{ClientId: 1, Amount: 10, Kind: "d", Description: "teste", Metadata: map[string]string{"a": "1", "b": "2"}}
+
+	t.Run("calls without credentials are unauthenticated", func(t *testing.T) {
+		_, err := client.GetStatement(context.Background(), &pb.GetStatementRequest{ClientId: 1})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		_, err = client.GetStatement(withToken("unknown"), &pb.GetStatementRequest{ClientId: 1})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("tokens need the scope and the client of the method", func(t *testing.T) {
+		_, err := client.GetStatement(withToken("reader"), &pb.GetStatementRequest{ClientId: 1})
+		assert.NoError(t, err)
+
+		_, err = client.CreateTransaction(withToken("reader"), debit)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		_, err = client.CreateTransaction(withToken("other"), debit)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("api keys sign the request", func(t *testing.T) {
+		ctx := signed(debit, "nonce-1", key)
+		_, err := client.CreateTransaction(ctx, debit)
+		assert.NoError(t, err)
+
+		_, err = client.CreateTransaction(ctx, debit)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "replayed nonce")
+
+		_, err = client.CreateTransaction(signed(debit, "nonce-2", "another key"), debit)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "bad signature")
+
+		changed := proto.Clone(debit).(*pb.CreateTransactionRequest)
+		changed.Amount = 1000
+		_, err = client.CreateTransaction(signed(debit, "nonce-3", key), changed)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "request changed after signed")
+	})
+
+	t.Run("streams are authorized on their request", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(withToken("other"), time.Second)
+		defer cancel()
+
+		stream, err := client.WatchBalance(ctx, &pb.WatchBalanceRequest{ClientId: 1})
+		assert.NoError(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		stream, err = client.WatchBalance(withToken("reader"), &pb.WatchBalanceRequest{ClientId: 1})
+		assert.NoError(t, err)
+		balance, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1000), balance.Limit)
+	})
+}
@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatus maps the domain errors to the gRPC codes, like the HTTP API maps them to the status.
+// The errors already with a code are kept, and the unexpected ones are hidden as Internal.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, domain.ErrClientDoesntExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, domain.ErrTransactionOverClientLimit):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, domain.ErrDuplicateReference):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, domain.ErrInvalidTransaction),
+		errors.Is(err, domain.ErrInvalidMetadata),
+		errors.Is(err, domain.ErrMoneyOverflow),
+		errors.Is(err, domain.ErrInvalidCurrency),
+		errors.Is(err, domain.ErrExchangeRateNotFound):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// DeadlineUnaryInterceptor bounds the unary calls to timeout, keeping the
+// deadline of the caller when it is earlier.
+func DeadlineUnaryInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return handler(ctx, req)
+	}
+}
+
+func LoggingUnaryInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+		logCall(logger, info.FullMethod, start, err)
+
+		return res, err
+	}
+}
+
+func LoggingStreamInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(logger, info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+// logCall only logs as an error the calls failing on our side.
+func logCall(logger *slog.Logger, method string, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelDebug
+	if code == codes.Internal || code == codes.Unknown {
+		level = slog.LevelError
+	}
+
+	logger.Log(context.Background(), level, "grpc call",
+		"method", method,
+		"code", code.String(),
+		"duration", time.Since(start),
+		"error", err)
+}
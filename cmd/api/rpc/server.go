@@ -0,0 +1,231 @@
+package rpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"rinha-with-go-2024/cmd/api/rpc/pb"
+	"rinha-with-go-2024/internal/domain"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// NewServer serves the Clients service with the logging and the deadline interceptors,
+// the unary calls taking at most timeout. The events are optional, see WatchBalance.
+// Without the authenticator the calls are anonymous, like the client routes without auth.
+func NewServer(
+	logger *slog.Logger,
+	svc *domain.ClientService,
+	events *domain.EventService,
+	timeout time.Duration,
+	auth *Authenticator,
+) *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{LoggingUnaryInterceptor(logger), DeadlineUnaryInterceptor(timeout)}
+	stream := []grpc.StreamServerInterceptor{LoggingStreamInterceptor(logger)}
+	if auth != nil {
+		unary = append(unary, AuthUnaryInterceptor(auth))
+		stream = append(stream, AuthStreamInterceptor(auth))
+	}
+
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+	pb.RegisterClientsServer(server, NewClientServer(logger, svc, events))
+
+	return server
+}
+
+type ClientServer struct {
+	pb.UnimplementedClientsServer
+	logger       *slog.Logger
+	svc          *domain.ClientService
+	events       *domain.EventService
+	pollInterval time.Duration
+}
+
+func NewClientServer(logger *slog.Logger, svc *domain.ClientService, events *domain.EventService) *ClientServer {
+	return &ClientServer{
+		logger:       logger,
+		svc:          svc,
+		events:       events,
+		pollInterval: time.Second,
+	}
+}
+
+func (s *ClientServer) CreateTransaction(ctx context.Context, req *pb.CreateTransactionRequest) (*pb.CreateTransactionResponse, error) {
+	t, err := toTransaction(req)
+	if err != nil {
+		domain.LoggerFromContext(ctx, s.logger).DebugContext(ctx, "invalid transaction", "error", err)
+		return nil, toStatus(err)
+	}
+
+	client, err := s.svc.CreateTransaction(ctx, t)
+	if err != nil {
+		domain.LoggerFromContext(ctx, s.logger).DebugContext(ctx, "the transaction was not perform correctly", "error", err)
+		return nil, toStatus(err)
+	}
+
+	return &pb.CreateTransactionResponse{
+		Limit:   int64(client.Limit),
+		Balance: int64(client.Balance),
+	}, nil
+}
+
+func (s *ClientServer) GetStatement(ctx context.Context, req *pb.GetStatementRequest) (*pb.GetStatementResponse, error) {
+	client, transactions, err := s.svc.GetStatement(ctx, int(req.ClientId))
+	if err != nil {
+		domain.LoggerFromContext(ctx, s.logger).DebugContext(ctx, "failed to get the statement", "error", err)
+		return nil, toStatus(err)
+	}
+
+	response := &pb.GetStatementResponse{
+		Balance:          toBalance(client),
+		LastTransactions: make([]*pb.Transaction, 0, len(transactions)),
+	}
+	for _, t := range transactions {
+		transaction := &pb.Transaction{
+			Amount:            int64(t.Amount),
+			Kind:              t.Kind,
+			Description:       t.Description,
+			PerformedAt:       timestamppb.New(t.UpdatedAt),
+			Category:          t.Category,
+			ExternalReference: t.ExternalReference,
+		}
+		if t.Rate != "" {
+			transaction.Currency = t.Currency
+		}
+		response.LastTransactions = append(response.LastTransactions, transaction)
+	}
+
+	return response, nil
+}
+
+// WatchBalance follows the transaction events when they are enabled, resubscribing from the
+// current balance when the subscriber falls behind. Otherwise, it polls the balance.
+func (s *ClientServer) WatchBalance(req *pb.WatchBalanceRequest, stream pb.Clients_WatchBalanceServer) error {
+	ctx := stream.Context()
+	clientID := int(req.ClientId)
+
+	if s.events == nil {
+		return s.pollBalance(ctx, clientID, stream)
+	}
+
+	for {
+		subscription, err := s.events.Subscribe(ctx, clientID, 0)
+		if err != nil {
+			return toStatus(err)
+		}
+
+		err = s.watchEvents(ctx, clientID, subscription, stream)
+		subscription.Close()
+		if err != nil {
+			return toStatus(err)
+		}
+		domain.LoggerFromContext(ctx, s.logger).DebugContext(ctx, "balance watcher fell behind", "clientID", clientID)
+	}
+}
+
+// watchEvents returns nil when the subscription is dropped.
+func (s *ClientServer) watchEvents(
+	ctx context.Context,
+	clientID int,
+	subscription *domain.EventSubscription,
+	stream pb.Clients_WatchBalanceServer,
+) error {
+	client, err := s.svc.GetClientBalance(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(toBalance(client)); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-subscription.Events:
+			if !ok {
+				return nil
+			}
+			// The events buffered since subscribing may be already in the balance sent.
+			if !e.After(client) {
+				continue
+			}
+
+			balance := &pb.Balance{
+				Limit:         int64(e.Limit),
+				Balance:       int64(e.Balance),
+				UpdatedAt:     timestamppb.New(e.OccurredAt),
+				TransactionId: int64(e.ID),
+			}
+			if err := stream.Send(balance); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// pollBalance sends the balance every time it changes.
+func (s *ClientServer) pollBalance(ctx context.Context, clientID int, stream pb.Clients_WatchBalanceServer) error {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	var last *domain.Client
+	for {
+		client, err := s.svc.GetClientBalance(ctx, clientID)
+		if err != nil {
+			return toStatus(err)
+		}
+
+		if last == nil || client.Balance != last.Balance || !client.UpdatedAt.Equal(last.UpdatedAt) {
+			if err := stream.Send(toBalance(client)); err != nil {
+				return err
+			}
+			last = client
+		}
+
+		select {
+		case <-ctx.Done():
+			return toStatus(ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func toTransaction(req *pb.CreateTransactionRequest) (*domain.Transaction, error) {
+	t, err := domain.NewTransaction(int(req.ClientId), domain.Money(req.Amount), req.Kind, req.Description)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.SetCurrency(req.Currency); err != nil {
+		return nil, err
+	}
+
+	var metadata domain.Metadata
+	if len(req.Metadata) > 0 {
+		metadata = domain.Metadata{}
+		for key, value := range req.Metadata {
+			metadata[key] = value
+		}
+	}
+
+	if err := t.SetAnnotations(req.Category, metadata); err != nil {
+		return nil, err
+	}
+
+	if err := t.SetExternalReference(req.ExternalReference); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func toBalance(client *domain.Client) *pb.Balance {
+	return &pb.Balance{
+		Limit:     int64(client.Limit),
+		Balance:   int64(client.Balance),
+		UpdatedAt: timestamppb.New(client.UpdatedAt),
+	}
+}
@@ -0,0 +1,203 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/cmd/api/rpc/pb"
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeClientRepository struct {
+	domain.ClientRepository
+	mu     sync.Mutex
+	client domain.Client
+}
+
+func (r *fakeClientRepository) ExecuteTransaction(ctx context.Context, t *domain.Transaction) (*domain.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t.ClientID != r.client.ID {
+		return nil, domain.ErrClientDoesntExist
+	}
+	if err := r.client.Apply(t); err != nil {
+		return nil, err
+	}
+	r.client.UpdatedAt = time.Now()
+
+	snapshot := r.client
+	return &snapshot, nil
+}
+
+func (r *fakeClientRepository) GetClientBalance(ctx context.Context, clientID int) (*domain.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if clientID != r.client.ID {
+		return nil, domain.ErrClientDoesntExist
+	}
+
+	snapshot := r.client
+	return &snapshot, nil
+}
+
+func (r *fakeClientRepository) GetStatement(ctx context.Context, clientID int) (*domain.Statement, error) {
+	client, err := r.GetClientBalance(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Statement{Client: client}, nil
+}
+
+type fakeEventRepository struct{}
+
+func (r fakeEventRepository) GetEventsAfter(ctx context.Context, clientID int, afterID int, limit int) ([]domain.TransactionEvent, error) {
+	return nil, nil
+}
+
+type fakeEventStream chan domain.TransactionEvent
+
+func (s fakeEventStream) Subscribe(clientID int) (<-chan domain.TransactionEvent, func()) {
+	return s, func() {}
+}
+
+func initializeClient(t *testing.T, repo domain.ClientRepository, events *domain.EventService) pb.ClientsClient {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := domain.NewClientRepository(logger, repo)
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(LoggingUnaryInterceptor(logger), DeadlineUnaryInterceptor(time.Second)),
+		grpc.ChainStreamInterceptor(LoggingStreamInterceptor(logger)),
+	)
+	clientServer := NewClientServer(logger, svc, events)
+	clientServer.pollInterval = time.Millisecond * 10
+	pb.RegisterClientsServer(server, clientServer)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewClientsClient(conn)
+}
+
+func TestClientServer_CreateTransaction(t *testing.T) {
+	ctx := context.Background()
+	client := initializeClient(t, &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000}}, nil)
+
+	tests := []struct {
+		name    string
+		request *pb.CreateTransactionRequest
+		code    codes.Code
+		balance int64
+	}{
+		{
+			name:    "valid debit",
+			request: &pb.CreateTransactionRequest{ClientId: 1, Amount: 100, Kind: "d", Description: "teste"},
+			code:    codes.OK,
+			balance: -100,
+		},
+		{
+			name:    "over the limit",
+			request: &pb.CreateTransactionRequest{ClientId: 1, Amount: 1000, Kind: "d", Description: "teste"},
+			code:    codes.FailedPrecondition,
+		},
+		{
+			name:    "invalid kind",
+			request: &pb.CreateTransactionRequest{ClientId: 1, Amount: 100, Kind: "x", Description: "teste"},
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "client doesn't exist",
+			request: &pb.CreateTransactionRequest{ClientId: 6, Amount: 100, Kind: "c", Description: "teste"},
+			code:    codes.NotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.CreateTransaction(ctx, tt.request)
+			assert.Equal(t, tt.code, status.Code(err))
+			if tt.code == codes.OK {
+				assert.Equal(t, int64(1000), res.Limit)
+				assert.Equal(t, tt.balance, res.Balance)
+			}
+		})
+	}
+}
+
+func TestClientServer_GetStatement(t *testing.T) {
+	ctx := context.Background()
+	client := initializeClient(t, &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000, Balance: -50}}, nil)
+
+	res, err := client.GetStatement(ctx, &pb.GetStatementRequest{ClientId: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-50), res.Balance.Balance)
+
+	_, err = client.GetStatement(ctx, &pb.GetStatementRequest{ClientId: 6})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestClientServer_WatchBalance(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := initializeClient(t, &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000}}, nil)
+
+	stream, err := client.WatchBalance(ctx, &pb.WatchBalanceRequest{ClientId: 1})
+	assert.NoError(t, err)
+
+	balance, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), balance.Balance)
+
+	_, err = client.CreateTransaction(ctx, &pb.CreateTransactionRequest{ClientId: 1, Amount: 30, Kind: "c", Description: "teste"})
+	assert.NoError(t, err)
+
+	balance, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), balance.Balance)
+}
+
+func TestClientServer_WatchBalance_Events(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// The events buffered before the balance is read, one of them already in the balance.
+	stream := make(fakeEventStream, 2)
+	stream <- domain.TransactionEvent{ID: 1, ClientID: 1, Limit: 1000, Balance: 20, Version: 2}
+	stream <- domain.TransactionEvent{ID: 2, ClientID: 1, Limit: 1000, Balance: 50, Version: 3}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	events := domain.NewEventService(logger, fakeEventRepository{}, nil, stream)
+	client := initializeClient(t, &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000, Balance: 20, Version: 2}}, events)
+
+	watch, err := client.WatchBalance(ctx, &pb.WatchBalanceRequest{ClientId: 1})
+	assert.NoError(t, err)
+
+	balance, err := watch.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), balance.Balance)
+
+	balance, err = watch.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50), balance.Balance)
+	assert.Equal(t, int64(2), balance.TransactionId)
+}
@@ -2,40 +2,163 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
+	"io/fs"
 	"log"
 	"log/slog"
+	"net"
+	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"rinha-with-go-2024/cmd/api/admin"
 	"rinha-with-go-2024/cmd/api/middleware"
 	"rinha-with-go-2024/cmd/api/router"
+	"rinha-with-go-2024/cmd/api/rpc"
+	"rinha-with-go-2024/cmd/api/transport"
 	"rinha-with-go-2024/config/env"
 	"rinha-with-go-2024/internal/domain"
+	"rinha-with-go-2024/internal/infra/cache"
+	"rinha-with-go-2024/internal/infra/events"
 	"rinha-with-go-2024/internal/infra/logger"
+	"rinha-with-go-2024/internal/infra/migrations"
 	"rinha-with-go-2024/internal/infra/repository"
+	"rinha-with-go-2024/internal/infra/token"
+	"rinha-with-go-2024/internal/infra/webhook"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
-	logger := initializeLogger()
+	logger, level := initializeLogger()
 	db := initializeDatabase()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrations(logger, db, os.Args[2:])
+		return
+	}
+
+	if env.GetEnvOrSetDefault("DB_MIGRATE_ON_START", "1") == "1" {
+		waitForDatabase(logger, db)
+		runMigrations(logger, db, []string{"up"})
+	}
 	monitorConnectionPool(logger, db)
 
-	repo := repository.NewClientRepository(logger, db)
+	repo := initializeClientRepository(logger, db)
 	svc := domain.NewClientRepository(logger, repo)
+	initializeStatementCache(logger, db, svc)
+
+	authSvc := initializeAuthService(logger, db)
+	auth, rpcAuth := initializeAuth(logger, authSvc)
 
-	r := gin.Default()
-	router.SetupRoutes(logger, r, svc)
-	r.Use(middleware.TimeoutMiddleware(time.Second * 30))
-	r.Run()
+	exchangeSvc := domain.NewExchangeService(logger, repository.NewExchangeRateRepository(logger, db))
+	webhookSvc := initializeWebhooks(logger, db, svc)
+	if webhookSvc != nil && len(auth) == 0 {
+		logger.Warn("the webhook subscriptions require authentication, enable AUTH_API_KEY_ENABLED or AUTH_JWT_ENABLED to create them")
+	}
+	eventSvc := initializeEvents(logger, db, svc)
+	scheduleSvc := initializeScheduler(logger, db, svc)
+	accrualSvc := initializeAccruals(logger, db, svc)
+	initializeGRPC(logger, svc, eventSvc, rpcAuth)
+	initializeAdmin(logger, level)
+	services := router.Services{
+		Client:   svc,
+		Auth:     authSvc,
+		Exchange: exchangeSvc,
+		Schedule: scheduleSvc,
+		Accrual:  accrualSvc,
+		Webhook:  webhookSvc,
+		Events:   eventSvc,
+		Load:     repository.NewPoolGauge(db),
+		Origins:  socketOrigins(),
+	}
+
+	middlewares := initializeMiddlewares(logger)
+	switch name := env.GetEnvOrSetDefault("HTTP_ROUTER", "gin"); name {
+	case "gin":
+		r := gin.Default()
+		router.SetupRoutes(logger, transport.Use(transport.NewGinRouter(r), middlewares...), services, auth...)
+		r.Use(middleware.TimeoutMiddleware(time.Second * 30))
+		serveHTTP(logger, r.Handler())
+	case "nethttp":
+		mux := transport.NewServeMux()
+		router.SetupRoutes(logger, transport.Use(mux, middlewares...), services, auth...)
+		serveHTTP(logger, mux)
+	default:
+		log.Fatalf("error loading router configuration: unknown router %q", name)
+	}
 }
 
-func initializeLogger() *slog.Logger {
-	level := env.GetEnvOrSetDefault("LOG_LEVEL", "DEBUG")
-	return logger.NewLogger(level)
+func serveHTTP(logger *slog.Logger, h http.Handler) {
+	lis := initializeListener(logger)
+	if err := http.Serve(lis, h); err != nil {
+		log.Fatalf("error serving http: %v", err)
+	}
+}
+
+// initializeListener listens in the HTTP_SOCKET when set, so the nginx in the same host skips
+// the TCP stack, otherwise in the PORT, like gin does.
+func initializeListener(logger *slog.Logger) net.Listener {
+	path := env.GetEnvOrSetDefault("HTTP_SOCKET", "")
+	if path == "" {
+		addr := ":" + env.GetEnvOrSetDefault("PORT", "8080")
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("error loading listener configuration: %v", err)
+		}
+
+		logger.Info("listening", "addr", addr)
+		return lis
+	}
+
+	mode, err := strconv.ParseUint(env.GetEnvOrSetDefault("HTTP_SOCKET_MODE", "0660"), 8, 32)
+	if err != nil {
+		log.Fatalf("error loading listener configuration: %v", err)
+	}
+
+	lis, err := transport.ListenUnix(path, fs.FileMode(mode))
+	if err != nil {
+		log.Fatalf("error loading listener configuration: %v", err)
+	}
+
+	logger.Info("listening", "socket", path, "mode", fs.FileMode(mode))
+	return lis
+}
+
+// initializeLogger keeps only LOG_DEBUG_SAMPLE of the debug lines, the level and the sample
+// can be changed at runtime in the admin port.
+func initializeLogger() (*slog.Logger, *logger.Level) {
+	sample, err := strconv.ParseFloat(env.GetEnvOrSetDefault("LOG_DEBUG_SAMPLE", "1"), 64)
+	if err != nil {
+		log.Fatalf("error loading logger configuration: %v", err)
+	}
+
+	level, err := logger.NewLevel(env.GetEnvOrSetDefault("LOG_LEVEL", "DEBUG"), sample)
+	if err != nil {
+		log.Fatalf("error loading logger configuration: %v", err)
+	}
+
+	return logger.NewLeveledLogger(level), level
+}
+
+// initializeMiddlewares returns the middlewares of every route, before the authentication.
+func initializeMiddlewares(logger *slog.Logger) []transport.Middleware {
+	var middlewares []transport.Middleware
+
+	if env.GetEnvOrSetDefault("REQUEST_ID_ENABLED", "1") == "1" {
+		middlewares = append(middlewares, middleware.RequestIDMiddleware(logger))
+	}
+
+	if env.GetEnvOrSetDefault("LOG_DEBUG_HEADER_ENABLED", "0") == "1" {
+		middlewares = append(middlewares, middleware.DebugLogMiddleware())
+	}
+
+	return middlewares
 }
 
 func initializeDatabase() *pgxpool.Pool {
@@ -65,6 +188,367 @@ func initializeDatabase() *pgxpool.Pool {
 	return pool
 }
 
+func initializeClientRepository(logger *slog.Logger, db *pgxpool.Pool) domain.ClientRepository {
+	repo := repository.NewClientRepository(logger, db)
+
+	if env.GetEnvOrSetDefault("BATCH_TRANSACTIONS_ENABLED", "0") != "1" {
+		return repo
+	}
+
+	window, err := time.ParseDuration(env.GetEnvOrSetDefault("BATCH_TRANSACTIONS_WINDOW", "2ms"))
+	if err != nil {
+		log.Fatalf("error loading batch configuration: %v", err)
+	}
+
+	maxSize, err := strconv.Atoi(env.GetEnvOrSetDefault("BATCH_TRANSACTIONS_MAX_SIZE", "100"))
+	if err != nil {
+		log.Fatalf("error loading batch configuration: %v", err)
+	}
+
+	batching := repository.NewBatchingClientRepository(logger, repo, window, maxSize)
+	monitorBatches(batching)
+	return batching
+}
+
+// monitorBatches publishes the counters of the batches in /debug/vars of the admin port.
+func monitorBatches(repo *repository.BatchingClientRepository) {
+	expvar.Publish("transaction_batches", expvar.Func(func() any { return repo.Stats() }))
+}
+
+func initializeStatementCache(logger *slog.Logger, db *pgxpool.Pool, svc *domain.ClientService) {
+	if env.GetEnvOrSetDefault("STATEMENT_CACHE_ENABLED", "0") != "1" {
+		return
+	}
+
+	size, err := strconv.Atoi(env.GetEnvOrSetDefault("STATEMENT_CACHE_SIZE", "1000"))
+	if err != nil {
+		log.Fatalf("error loading cache configuration: %v", err)
+	}
+
+	ttl, err := time.ParseDuration(env.GetEnvOrSetDefault("STATEMENT_CACHE_TTL", "1s"))
+	if err != nil {
+		log.Fatalf("error loading cache configuration: %v", err)
+	}
+
+	var shared cache.Shared
+	if addr := env.GetEnvOrSetDefault("STATEMENT_CACHE_REDIS_ADDR", ""); addr != "" {
+		shared = cache.NewRedisCache(redis.NewClient(&redis.Options{Addr: addr}))
+	}
+
+	notifier := cache.NewPostgresNotifier(logger, db)
+	statements := cache.NewStatementCache(logger, size, ttl, shared, notifier, repository.NewClientRepository(logger, db))
+	go notifier.Listen(context.Background(), statements)
+
+	svc.WithStatementCache(statements)
+}
+
+func initializeScheduler(logger *slog.Logger, db *pgxpool.Pool, svc *domain.ClientService) *domain.ScheduleService {
+	scheduleSvc := domain.NewScheduleService(logger, repository.NewScheduleRepository(logger, db), svc)
+
+	if env.GetEnvOrSetDefault("SCHEDULER_ENABLED", "0") != "1" {
+		return scheduleSvc
+	}
+
+	interval, err := time.ParseDuration(env.GetEnvOrSetDefault("SCHEDULER_INTERVAL", "1s"))
+	if err != nil {
+		log.Fatalf("error loading scheduler configuration: %v", err)
+	}
+
+	batchSize, err := strconv.Atoi(env.GetEnvOrSetDefault("SCHEDULER_BATCH_SIZE", "100"))
+	if err != nil {
+		log.Fatalf("error loading scheduler configuration: %v", err)
+	}
+
+	pollLoop(logger, "scheduled transactions", interval, batchSize, func(ctx context.Context) (int, error) {
+		return scheduleSvc.RunDue(ctx, time.Now(), batchSize)
+	})
+	return scheduleSvc
+}
+
+// pollLoop runs a background job in batches of up to batchSize, right away after a full batch,
+// since there may be more due, and otherwise every d. The jobs claim each item they run, so
+// every replica can poll them.
+func pollLoop(logger *slog.Logger, name string, d time.Duration, batchSize int, poll func(ctx context.Context) (int, error)) {
+	run := func() {
+		for {
+			count, err := poll(context.Background())
+			if err != nil {
+				logger.Error("failed to run the background job", "job", name, "error", err)
+			}
+			if count > 0 {
+				logger.Debug("Background job run", "job", name, "count", count)
+			}
+
+			if count < batchSize {
+				time.Sleep(d)
+			}
+		}
+	}
+
+	go run()
+}
+
+func initializeAccruals(logger *slog.Logger, db *pgxpool.Pool, svc *domain.ClientService) *domain.AccrualService {
+	accrualSvc := domain.NewAccrualService(logger, repository.NewAccrualRepository(logger, db)).WithClientService(svc)
+
+	if env.GetEnvOrSetDefault("ACCRUAL_ENABLED", "0") != "1" {
+		return accrualSvc
+	}
+
+	interval, err := time.ParseDuration(env.GetEnvOrSetDefault("ACCRUAL_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatalf("error loading accrual configuration: %v", err)
+	}
+
+	runAccruals(logger, accrualSvc, interval)
+	return accrualSvc
+}
+
+// runAccruals charges the previous day, the accruals already posted are
+// skipped, so it can run on every replica and as often as needed.
+func runAccruals(logger *slog.Logger, svc *domain.AccrualService, d time.Duration) {
+	run := func() {
+		for {
+			yesterday := time.Now().UTC().AddDate(0, 0, -1)
+			summary, err := svc.Accrue(context.Background(), yesterday)
+			if err != nil {
+				logger.Error("failed to accrue the charges", "date", yesterday.Format(time.DateOnly), "error", err)
+			}
+
+			logger.Debug("Accruals status",
+				"date", yesterday.Format(time.DateOnly),
+				"accounts", summary.Accounts,
+				"posted", summary.Posted,
+				"skipped", summary.Skipped,
+			)
+
+			time.Sleep(d)
+		}
+	}
+
+	go run()
+}
+
+// initializeWebhooks enqueues and delivers the events when enabled, returning nil otherwise so
+// the subscriptions aren't served and the load test doesn't pay for the lookups.
+func initializeWebhooks(logger *slog.Logger, db *pgxpool.Pool, svc *domain.ClientService) *domain.WebhookService {
+	if env.GetEnvOrSetDefault("WEBHOOKS_ENABLED", "0") != "1" {
+		return nil
+	}
+
+	timeout, err := time.ParseDuration(env.GetEnvOrSetDefault("WEBHOOKS_TIMEOUT", "5s"))
+	if err != nil {
+		log.Fatalf("error loading webhooks configuration: %v", err)
+	}
+
+	// Only meant to try the webhooks locally, as the receiver in host.docker.internal.
+	allowPrivate := env.GetEnvOrSetDefault("WEBHOOKS_ALLOW_PRIVATE", "0") == "1"
+
+	// The lease outlasts the sender timeout, so a delivery is only claimed again when its worker stopped.
+	webhookSvc := domain.NewWebhookService(logger, repository.NewWebhookRepository(logger, db), webhook.NewHTTPSender(timeout, allowPrivate)).
+		WithLease(2 * timeout)
+	if allowPrivate {
+		webhookSvc.AllowPrivateAddresses()
+	}
+
+	interval, err := time.ParseDuration(env.GetEnvOrSetDefault("WEBHOOKS_INTERVAL", "1s"))
+	if err != nil {
+		log.Fatalf("error loading webhooks configuration: %v", err)
+	}
+
+	batchSize, err := strconv.Atoi(env.GetEnvOrSetDefault("WEBHOOKS_BATCH_SIZE", "50"))
+	if err != nil {
+		log.Fatalf("error loading webhooks configuration: %v", err)
+	}
+
+	svc.WithObserver(webhookSvc)
+	pollLoop(logger, "webhook deliveries", interval, batchSize, func(ctx context.Context) (int, error) {
+		return webhookSvc.DeliverDue(ctx, batchSize)
+	})
+	return webhookSvc
+}
+
+// initializeEvents publishes the accepted transactions of this replica and listens to the
+// ones of both, returning nil when disabled so the stream isn't served.
+func initializeEvents(logger *slog.Logger, db *pgxpool.Pool, svc *domain.ClientService) *domain.EventService {
+	if env.GetEnvOrSetDefault("EVENTS_ENABLED", "0") != "1" {
+		return nil
+	}
+
+	bufferSize, err := strconv.Atoi(env.GetEnvOrSetDefault("EVENTS_BUFFER_SIZE", "64"))
+	if err != nil {
+		log.Fatalf("error loading events configuration: %v", err)
+	}
+
+	hub := events.NewHub(logger, bufferSize)
+	notifier := events.NewPostgresNotifier(logger, db)
+	go notifier.Listen(context.Background(), hub)
+
+	eventSvc := domain.NewEventService(logger, repository.NewClientRepository(logger, db), notifier, hub)
+	svc.WithObserver(eventSvc)
+	return eventSvc
+}
+
+// initializeGRPC serves the gRPC API in its own port, meant for the internal services, so it
+// isn't behind the nginx and only listens in the loopback by default. It takes the same
+// authentication of the HTTP API when enabled.
+func initializeGRPC(logger *slog.Logger, svc *domain.ClientService, eventSvc *domain.EventService, auth *rpc.Authenticator) {
+	if env.GetEnvOrSetDefault("GRPC_ENABLED", "0") != "1" {
+		return
+	}
+
+	timeout, err := time.ParseDuration(env.GetEnvOrSetDefault("GRPC_TIMEOUT", "30s"))
+	if err != nil {
+		log.Fatalf("error loading grpc configuration: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", env.GetEnvOrSetDefault("GRPC_ADDR", "127.0.0.1:50051"))
+	if err != nil {
+		log.Fatalf("error loading grpc configuration: %v", err)
+	}
+
+	server := rpc.NewServer(logger, svc, eventSvc, timeout, auth)
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			log.Fatalf("error serving grpc: %v", err)
+		}
+	}()
+}
+
+// initializeAdmin serves the profiling and the log level endpoints in their own port, so they can be captured
+// from the containers during a load test without being reachable through the nginx.
+func initializeAdmin(logger *slog.Logger, level *logger.Level) {
+	if env.GetEnvOrSetDefault("ADMIN_ENABLED", "0") != "1" {
+		return
+	}
+
+	addr := env.GetEnvOrSetDefault("ADMIN_ADDR", "127.0.0.1:6060")
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("error loading admin configuration: %v", err)
+	}
+
+	profiler := admin.NewProfiler(logger, env.GetEnvOrSetDefault("ADMIN_PROFILE_DIR", "/tmp/profiles"))
+	go func() {
+		if err := http.Serve(lis, admin.NewHandler(logger, profiler, level)); err != nil {
+			log.Fatalf("error serving admin: %v", err)
+		}
+	}()
+
+	logger.Info("admin listening", "addr", addr)
+}
+
+func initializeAuthService(logger *slog.Logger, db *pgxpool.Pool) *domain.AuthService {
+	window, err := time.ParseDuration(env.GetEnvOrSetDefault("AUTH_NONCE_WINDOW", "5m"))
+	if err != nil {
+		log.Fatalf("error loading auth configuration: %v", err)
+	}
+
+	return domain.NewAuthService(logger, repository.NewAuthRepository(logger, db), window)
+}
+
+// initializeAuth returns the authentication of the HTTP routes and of the gRPC calls, both
+// empty when no authentication is enabled.
+func initializeAuth(logger *slog.Logger, svc *domain.AuthService) ([]transport.Middleware, *rpc.Authenticator) {
+	var auth []transport.Middleware
+	var apiKeys *domain.AuthService
+	var tokens rpc.TokenValidator
+
+	if env.GetEnvOrSetDefault("AUTH_API_KEY_ENABLED", "0") == "1" {
+		purgeNonces(logger, svc, time.Minute)
+		auth = append(auth, middleware.APIKeyAuthMiddleware(logger, svc))
+		apiKeys = svc
+	}
+
+	if env.GetEnvOrSetDefault("AUTH_JWT_ENABLED", "0") == "1" {
+		validator, err := token.NewJWTValidator(
+			env.GetEnvOrSetDefault("AUTH_JWT_SECRET", ""),
+			env.GetEnvOrSetDefault("AUTH_JWT_JWKS_FILE", ""),
+			env.GetEnvOrSetDefault("AUTH_JWT_ISSUER", ""),
+		)
+		if err != nil {
+			log.Fatalf("error loading auth configuration: %v", err)
+		}
+
+		auth = append(auth, middleware.JWTAuthMiddleware(logger, validator))
+		tokens = validator
+	}
+
+	if len(auth) == 0 {
+		return nil, nil
+	}
+	return auth, rpc.NewAuthenticator(logger, apiKeys, tokens)
+}
+
+func purgeNonces(logger *slog.Logger, svc *domain.AuthService, d time.Duration) {
+	purge := func() {
+		for {
+			if err := svc.PurgeNonces(context.Background()); err != nil {
+				logger.Error("failed to purge the request nonces", "error", err)
+			}
+
+			time.Sleep(d)
+		}
+	}
+
+	go purge()
+}
+
+// waitForDatabase avoids failing the migrations when the API starts before Postgres is ready.
+func waitForDatabase(logger *slog.Logger, db *pgxpool.Pool) {
+	var err error
+	for attempt := 1; attempt <= 30; attempt++ {
+		err = db.Ping(context.Background())
+		if err == nil {
+			return
+		}
+
+		logger.Info("waiting for the database", "attempt", attempt, "error", err)
+		time.Sleep(time.Second)
+	}
+
+	log.Fatalf("error connecting to the database: %v", err)
+}
+
+// runMigrations handles the migrate subcommand:
+// migrate up | migrate down [steps] | migrate version
+func runMigrations(logger *slog.Logger, db *pgxpool.Pool, args []string) {
+	migrator, err := migrations.NewMigrator(logger, db)
+	if err != nil {
+		log.Fatalf("error loading migrations: %v", err)
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				log.Fatalf("invalid number of steps: %v", err)
+			}
+		}
+		err = migrator.Down(ctx, steps)
+	case "version":
+		var version int
+		version, err = migrator.Version(ctx)
+		fmt.Println(version)
+	default:
+		log.Fatalf("unknown migrate command %q, use up, down or version", command)
+	}
+
+	if err != nil {
+		log.Fatalf("error running migrations: %v", err)
+	}
+}
+
 func monitorConnectionPool(logger *slog.Logger, db *pgxpool.Pool) {
 	enabled := env.GetEnvOrSetDefault("MONITOR_CONN_POOL", "1")
 
@@ -89,3 +573,14 @@ func monitorConnectionPool(logger *slog.Logger, db *pgxpool.Pool) {
 
 	go monitor(time.Second * 10)
 }
+
+// socketOrigins are the origins, besides the host of the API, whose browsers may open the websocket.
+func socketOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(env.GetEnvOrSetDefault("WEBSOCKET_ALLOWED_ORIGINS", ""), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
@@ -0,0 +1,50 @@
+package transport
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GinRouter struct {
+	engine *gin.Engine
+}
+
+func NewGinRouter(engine *gin.Engine) *GinRouter {
+	return &GinRouter{
+		engine: engine,
+	}
+}
+
+func (r *GinRouter) Handle(method, path string, h HandlerFunc) {
+	r.engine.Handle(method, path, func(c *gin.Context) {
+		h(ginContext{c})
+	})
+}
+
+func (r *GinRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.engine.ServeHTTP(w, req)
+}
+
+// ginContext holds only the pointer, so it is converted to a Context without allocating.
+type ginContext struct {
+	c *gin.Context
+}
+
+func (g ginContext) Request() *http.Request      { return g.c.Request }
+func (g ginContext) SetRequest(r *http.Request)  { g.c.Request = r }
+func (g ginContext) Route() string               { return g.c.FullPath() }
+func (g ginContext) Writer() http.ResponseWriter { return g.c.Writer }
+func (g ginContext) Param(key string) string     { return g.c.Param(key) }
+func (g ginContext) Query(key string) string     { return g.c.Query(key) }
+func (g ginContext) GetHeader(key string) string { return g.c.GetHeader(key) }
+func (g ginContext) Header(key, value string)    { g.c.Header(key, value) }
+func (g ginContext) DecodeJSON(obj any) error    { return g.c.ShouldBindJSON(obj) }
+func (g ginContext) Status(code int)             { g.c.Status(code) }
+func (g ginContext) JSON(code int, obj any)      { g.c.JSON(code, obj) }
+func (g ginContext) Set(key string, value any)   { g.c.Set(key, value) }
+func (g ginContext) Get(key string) (any, bool)  { return g.c.Get(key) }
+
+func (g ginContext) DefaultQuery(key, defaultValue string) string {
+	return g.c.DefaultQuery(key, defaultValue)
+}
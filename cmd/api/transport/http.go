@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ServeMux routes with the patterns of the net/http, without the binding and the rendering
+// of gin. Unlike gin, a known path with another method is answered with 405 instead of 404.
+type ServeMux struct {
+	mux  *http.ServeMux
+	pool sync.Pool
+}
+
+func NewServeMux() *ServeMux {
+	return &ServeMux{
+		mux:  http.NewServeMux(),
+		pool: sync.Pool{New: func() any { return &httpContext{} }},
+	}
+}
+
+func (m *ServeMux) Handle(method, path string, h HandlerFunc) {
+	m.mux.HandleFunc(method+" "+pattern(path), func(w http.ResponseWriter, r *http.Request) {
+		c := m.pool.Get().(*httpContext)
+		c.w, c.r, c.route = w, r, path
+		h(c)
+
+		c.reset()
+		m.pool.Put(c)
+	})
+}
+
+func (m *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mux.ServeHTTP(w, r)
+}
+
+// pattern rewrites the gin parameters, as in :id, into the wildcards of the net/http, as in {id}.
+func pattern(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+		} else if name, ok := strings.CutPrefix(segment, "*"); ok {
+			segments[i] = "{" + name + "...}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// httpContext is reused across the requests, so it must not be kept after the handler returns.
+type httpContext struct {
+	w     http.ResponseWriter
+	r     *http.Request
+	route string
+	query url.Values
+	keys  map[string]any
+}
+
+func (c *httpContext) reset() {
+	c.w, c.r, c.route, c.query = nil, nil, "", nil
+	clear(c.keys)
+}
+
+func (c *httpContext) Request() *http.Request      { return c.r }
+func (c *httpContext) SetRequest(r *http.Request)  { c.r = r }
+func (c *httpContext) Route() string               { return c.route }
+func (c *httpContext) Writer() http.ResponseWriter { return c.w }
+func (c *httpContext) Param(key string) string     { return c.r.PathValue(key) }
+func (c *httpContext) GetHeader(key string) string { return c.r.Header.Get(key) }
+func (c *httpContext) Status(code int)             { c.w.WriteHeader(code) }
+
+func (c *httpContext) Query(key string) string {
+	return c.DefaultQuery(key, "")
+}
+
+// DefaultQuery returns defaultValue only when the key is missing, as gin does.
+func (c *httpContext) DefaultQuery(key, defaultValue string) string {
+	if c.query == nil {
+		c.query = c.r.URL.Query()
+	}
+	if values, ok := c.query[key]; ok && len(values) > 0 {
+		return values[0]
+	}
+	return defaultValue
+}
+
+// Header deletes the header when the value is empty, as gin does.
+func (c *httpContext) Header(key, value string) {
+	if value == "" {
+		c.w.Header().Del(key)
+		return
+	}
+	c.w.Header().Set(key, value)
+}
+
+func (c *httpContext) DecodeJSON(obj any) error {
+	return json.NewDecoder(c.r.Body).Decode(obj)
+}
+
+func (c *httpContext) JSON(code int, obj any) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		c.w.WriteHeader(500)
+		return
+	}
+
+	c.w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	c.w.WriteHeader(code)
+	c.w.Write(data)
+}
+
+func (c *httpContext) Set(key string, value any) {
+	if c.keys == nil {
+		c.keys = map[string]any{}
+	}
+	c.keys[key] = value
+}
+
+func (c *httpContext) Get(key string) (any, bool) {
+	value, ok := c.keys[key]
+	return value, ok
+}
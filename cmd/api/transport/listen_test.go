@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenUnix(t *testing.T) {
+	t.Run("the socket has the given permissions", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "api.sock")
+
+		lis, err := ListenUnix(path, 0666)
+		assert.NoError(t, err)
+		defer lis.Close()
+
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, fs.FileMode(0666), info.Mode().Perm())
+	})
+
+	t.Run("a stale socket is removed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "api.sock")
+
+		stale, err := net.Listen("unix", path)
+		assert.NoError(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		lis, err := ListenUnix(path, 0660)
+		assert.NoError(t, err)
+		defer lis.Close()
+
+		conn, err := net.Dial("unix", path)
+		assert.NoError(t, err)
+		conn.Close()
+	})
+
+	t.Run("a socket in use isn't removed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "api.sock")
+
+		lis, err := ListenUnix(path, 0660)
+		assert.NoError(t, err)
+		defer lis.Close()
+
+		_, err = ListenUnix(path, 0660)
+		assert.Error(t, err)
+	})
+
+	t.Run("a file isn't removed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "api.sock")
+		assert.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+		_, err := ListenUnix(path, 0660)
+		assert.Error(t, err)
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "data", string(data))
+	})
+}
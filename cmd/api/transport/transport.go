@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"net/http"
+)
+
+// Context is what the handlers use from a request, so they are served by either router.
+// The methods keep the names and the semantics of gin, since the handlers were written for it.
+// Route is the path the handler was registered with, as in /clientes/:id/extrato.
+type Context interface {
+	Request() *http.Request
+	SetRequest(r *http.Request)
+	Route() string
+	Writer() http.ResponseWriter
+	Param(key string) string
+	Query(key string) string
+	DefaultQuery(key, defaultValue string) string
+	GetHeader(key string) string
+	Header(key, value string)
+	DecodeJSON(obj any) error
+	Status(code int)
+	JSON(code int, obj any)
+	Set(key string, value any)
+	Get(key string) (any, bool)
+}
+
+type HandlerFunc func(c Context)
+
+// Middleware wraps the next handler, aborting the request by not calling it.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Chain wraps h with the middlewares, the first one running first.
+func Chain(h HandlerFunc, middlewares ...Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Use returns a router wrapping every handler with the middlewares, before the ones of each route.
+func Use(r Router, middlewares ...Middleware) Router {
+	if len(middlewares) == 0 {
+		return r
+	}
+	return &middlewareRouter{Router: r, middlewares: middlewares}
+}
+
+type middlewareRouter struct {
+	Router
+	middlewares []Middleware
+}
+
+func (r *middlewareRouter) Handle(method, path string, h HandlerFunc) {
+	r.Router.Handle(method, path, Chain(h, r.middlewares...))
+}
+
+// Router takes the paths with the gin syntax for the parameters, as in /clientes/:id/extrato.
+type Router interface {
+	http.Handler
+	Handle(method, path string, h HandlerFunc)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"rinha-with-go-2024/cmd/internal/cli"
+	"rinha-with-go-2024/internal/domain"
+	"rinha-with-go-2024/internal/infra/repository"
+)
+
+// Creates a new API key for a client and prints its id and the key, only the hash is stored.
+// Usage: go run ./cmd/apikey -client 1
+func main() {
+	clientID := flag.Int("client", 0, "client id that will own the api key")
+	flag.Parse()
+
+	if *clientID == 0 {
+		log.Fatal("the client id is required")
+	}
+
+	logger := cli.InitializeLogger()
+	db := cli.InitializeDatabase()
+	defer db.Close()
+
+	svc := domain.NewAuthService(logger, repository.NewAuthRepository(logger, db), 0)
+	created, key, err := svc.CreateAPIKey(context.Background(), *clientID)
+	if err != nil {
+		log.Fatalf("error creating the api key: %v", err)
+	}
+
+	fmt.Printf("id: %d\nchave: %s\n", created.ID, key)
+}
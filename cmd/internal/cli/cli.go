@@ -0,0 +1,37 @@
+// Package cli has the configuration shared by the command line tools, read from the same
+// environment variables of the API.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+
+	"rinha-with-go-2024/config/env"
+	"rinha-with-go-2024/internal/infra/logger"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// InitializeLogger only logs the errors by default, so the output of the tools stays readable.
+func InitializeLogger() *slog.Logger {
+	level := env.GetEnvOrSetDefault("LOG_LEVEL", "ERROR")
+	return logger.NewLogger(level)
+}
+
+func InitializeDatabase() *pgxpool.Pool {
+	dbEndpoint := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
+		env.GetEnvOrSetDefault("DB_USER", "admin"),
+		env.GetEnvOrSetDefault("DB_PASSWORD", "password"),
+		env.GetEnvOrSetDefault("DB_HOST", "localhost"),
+		env.GetEnvOrSetDefault("DB_PORT", "5432"),
+		env.GetEnvOrSetDefault("DB_SCHEMA", "rinha"))
+
+	pool, err := pgxpool.New(context.Background(), dbEndpoint)
+	if err != nil {
+		log.Fatalf("error loading database configuration: %v", err)
+	}
+
+	return pool
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	RoundRobin       = "round-robin"
+	LeastConnections = "least-conn"
+)
+
+// maxUpstreams is the size of the set of the upstreams already tried by a request.
+const maxUpstreams = 64
+
+var ErrNoUpstream = errors.New("no healthy upstream")
+
+// Upstream is an API replica, reached in the host:port, the http://host:port or the unix:/path.
+type Upstream struct {
+	Address   string
+	url       url.URL
+	transport *http.Transport
+	healthy   atomic.Bool
+	active    atomic.Int64
+	requests  atomic.Int64
+	failures  atomic.Int64
+}
+
+// NewUpstream keeps up to keepalive idle connections, like the keepalive of the nginx upstreams.
+func NewUpstream(address string, keepalive int, timeout time.Duration) (*Upstream, error) {
+	u := &Upstream{Address: address}
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	dial := dialer.DialContext
+
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		if path == "" {
+			return nil, fmt.Errorf("invalid upstream %q", address)
+		}
+		u.url = url.URL{Scheme: "http", Host: "localhost"}
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", path)
+		}
+	} else {
+		if !strings.Contains(address, "://") {
+			address = "http://" + address
+		}
+		parsed, err := url.Parse(address)
+		if err != nil || parsed.Scheme != "http" || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid upstream %q", u.Address)
+		}
+		u.url = url.URL{Scheme: parsed.Scheme, Host: parsed.Host}
+	}
+
+	u.transport = &http.Transport{
+		DialContext:           dial,
+		MaxIdleConns:          keepalive,
+		MaxIdleConnsPerHost:   keepalive,
+		IdleConnTimeout:       60 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		DisableCompression:    true,
+	}
+	u.healthy.Store(true)
+
+	return u, nil
+}
+
+// roundTrip counts the request as active until its body is closed, so the streams count too.
+func (u *Upstream) roundTrip(r *http.Request) (*http.Response, error) {
+	out := *r
+	target := *r.URL
+	target.Scheme, target.Host = u.url.Scheme, u.url.Host
+	out.URL = &target
+
+	u.active.Add(1)
+	u.requests.Add(1)
+	res, err := u.transport.RoundTrip(&out)
+	if err != nil {
+		u.active.Add(-1)
+		u.failures.Add(1)
+		return nil, err
+	}
+
+	done := func() { u.active.Add(-1) }
+	if rwc, ok := res.Body.(io.ReadWriteCloser); ok {
+		res.Body = &upgradedBody{ReadWriteCloser: rwc, done: done}
+	} else {
+		res.Body = &countedBody{ReadCloser: res.Body, done: done}
+	}
+	return res, nil
+}
+
+func (u *Upstream) check(ctx context.Context, path string) bool {
+	target := u.url
+	target.Path = path
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return false
+	}
+
+	res, err := u.transport.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	return res.StatusCode == 200
+}
+
+type countedBody struct {
+	io.ReadCloser
+	done   func()
+	closed atomic.Bool
+}
+
+func (b *countedBody) Close() error {
+	if b.closed.CompareAndSwap(false, true) {
+		b.done()
+	}
+	return b.ReadCloser.Close()
+}
+
+// upgradedBody keeps the Write of the upgraded connections, which the proxy requires.
+type upgradedBody struct {
+	io.ReadWriteCloser
+	done   func()
+	closed atomic.Bool
+}
+
+func (b *upgradedBody) Close() error {
+	if b.closed.CompareAndSwap(false, true) {
+		b.done()
+	}
+	return b.ReadWriteCloser.Close()
+}
+
+// Balancer is the transport of the proxy, picking an upstream for each request. The idempotent
+// requests failing before a response are retried on another upstream, up to retries times.
+type Balancer struct {
+	logger    *slog.Logger
+	upstreams []*Upstream
+	strategy  string
+	retries   int
+	next      atomic.Uint64
+	retried   atomic.Int64
+}
+
+func NewBalancer(logger *slog.Logger, upstreams []*Upstream, strategy string, retries int) (*Balancer, error) {
+	if len(upstreams) == 0 || len(upstreams) > maxUpstreams {
+		return nil, fmt.Errorf("the number of upstreams must be between 1 and %d", maxUpstreams)
+	}
+	if strategy != RoundRobin && strategy != LeastConnections {
+		return nil, fmt.Errorf("unknown strategy %q", strategy)
+	}
+
+	return &Balancer{
+		logger:    logger,
+		upstreams: upstreams,
+		strategy:  strategy,
+		retries:   retries,
+	}, nil
+}
+
+func (b *Balancer) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := b.next.Add(1)
+	var tried uint64
+	for attempt := 0; ; attempt++ {
+		i, ok := b.pick(start, tried)
+		if !ok {
+			return nil, ErrNoUpstream
+		}
+		tried |= 1 << i
+
+		res, err := b.upstreams[i].roundTrip(r)
+		if err == nil {
+			return res, nil
+		}
+
+		if attempt >= b.retries || !idempotent(r) || r.Context().Err() != nil {
+			return nil, err
+		}
+		b.retried.Add(1)
+		b.logger.Debug("retrying on another upstream", "upstream", b.upstreams[i].Address, "error", err)
+	}
+}
+
+// pick scans from start, skipping the unhealthy upstreams and the ones already tried, and
+// returns false when none is left. The least connections ties go to the first one scanned.
+func (b *Balancer) pick(start uint64, tried uint64) (int, bool) {
+	n := len(b.upstreams)
+
+	best := -1
+	for offset := 0; offset < n; offset++ {
+		i := int((start + uint64(offset)) % uint64(n))
+		u := b.upstreams[i]
+		if tried&(1<<i) != 0 || !u.healthy.Load() {
+			continue
+		}
+		if b.strategy == RoundRobin {
+			return i, true
+		}
+		if best == -1 || u.active.Load() < b.upstreams[best].active.Load() {
+			best = i
+		}
+	}
+
+	return best, best != -1
+}
+
+// idempotent only retries the requests without a body, which the proxy can send again.
+func idempotent(r *http.Request) bool {
+	return (r.Method == http.MethodGet || r.Method == http.MethodHead) && (r.Body == nil || r.Body == http.NoBody)
+}
+
+// CheckHealth marks the upstreams answering 200 in the path as healthy, every interval.
+func (b *Balancer) CheckHealth(ctx context.Context, path string, interval, timeout time.Duration) {
+	for {
+		for _, u := range b.upstreams {
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			healthy := u.check(checkCtx, path)
+			cancel()
+
+			if u.healthy.Swap(healthy) != healthy {
+				b.logger.Info("upstream health changed", "upstream", u.Address, "healthy", healthy)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+type StatsResponse struct {
+	Strategy  string             `json:"estrategia"`
+	Retries   int64              `json:"repeticoes"`
+	Upstreams []UpstreamResponse `json:"upstreams"`
+}
+
+type UpstreamResponse struct {
+	Address  string `json:"endereco"`
+	Healthy  bool   `json:"saudavel"`
+	Active   int64  `json:"ativas"`
+	Requests int64  `json:"requisicoes"`
+	Failures int64  `json:"falhas"`
+}
+
+func (b *Balancer) Stats() StatsResponse {
+	stats := StatsResponse{
+		Strategy:  b.strategy,
+		Retries:   b.retried.Load(),
+		Upstreams: make([]UpstreamResponse, 0, len(b.upstreams)),
+	}
+	for _, u := range b.upstreams {
+		stats.Upstreams = append(stats.Upstreams, UpstreamResponse{
+			Address:  u.Address,
+			Healthy:  u.healthy.Load(),
+			Active:   u.active.Load(),
+			Requests: u.requests.Load(),
+			Failures: u.failures.Load(),
+		})
+	}
+	return stats
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func initializeReplica(t *testing.T, name string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func initializeProxy(t *testing.T, strategy string, addresses ...string) (*Balancer, *httptest.Server) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var upstreams []*Upstream
+	for _, address := range addresses {
+		u, err := NewUpstream(address, 10, time.Second)
+		assert.NoError(t, err)
+		upstreams = append(upstreams, u)
+	}
+
+	balancer, err := NewBalancer(logger, upstreams, strategy, 1)
+	assert.NoError(t, err)
+
+	proxy := httptest.NewServer(&httputil.ReverseProxy{
+		Rewrite:      func(r *httputil.ProxyRequest) { r.SetXForwarded() },
+		Transport:    balancer,
+		ErrorHandler: proxyErrorHandler(logger),
+	})
+	t.Cleanup(proxy.Close)
+
+	return balancer, proxy
+}
+
+func get(t *testing.T, url string) (int, string) {
+	res, err := http.Get(url)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	return res.StatusCode, string(body)
+}
+
+func TestNewUpstream(t *testing.T) {
+	for _, address := range []string{"api:80", "http://api:80", "unix:/var/run/rinha/api-1.sock"} {
+		_, err := NewUpstream(address, 10, time.Second)
+		assert.NoError(t, err, address)
+	}
+
+	for _, address := range []string{"unix:", "https://api:80", "http://"} {
+		_, err := NewUpstream(address, 10, time.Second)
+		assert.Error(t, err, address)
+	}
+}
+
+func TestBalancer_RoundRobin(t *testing.T) {
+	a, b := initializeReplica(t, "a"), initializeReplica(t, "b")
+	_, proxy := initializeProxy(t, RoundRobin, a.URL, b.URL)
+
+	answers := map[string]int{}
+	for i := 0; i < 10; i++ {
+		status, body := get(t, proxy.URL)
+		assert.Equal(t, 200, status)
+		answers[body]++
+	}
+
+	assert.Equal(t, map[string]int{"a": 5, "b": 5}, answers)
+}
+
+func TestBalancer_LeastConnections(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := initializeReplica(t, "fast")
+
+	balancer, proxy := initializeProxy(t, LeastConnections, slow.URL, fast.URL)
+	// The first scan starts at the slow replica, which takes the tie.
+	balancer.next.Store(1)
+
+	go http.Get(proxy.URL)
+	assert.Eventually(t, func() bool { return balancer.Stats().Upstreams[0].Active == 1 }, time.Second, time.Millisecond*10)
+
+	for i := 0; i < 5; i++ {
+		_, body := get(t, proxy.URL)
+		assert.Equal(t, "fast", body)
+	}
+}
+
+func TestBalancer_Retry(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	up := initializeReplica(t, "up")
+
+	t.Run("idempotent requests are retried on another replica", func(t *testing.T) {
+		balancer, proxy := initializeProxy(t, RoundRobin, down.URL, up.URL)
+
+		for i := 0; i < 4; i++ {
+			status, body := get(t, proxy.URL)
+			assert.Equal(t, 200, status)
+			assert.Equal(t, "up", body)
+		}
+		assert.Equal(t, int64(2), balancer.Stats().Retries)
+		assert.Equal(t, int64(2), balancer.Stats().Upstreams[0].Failures)
+	})
+
+	t.Run("requests with a body aren't retried", func(t *testing.T) {
+		_, proxy := initializeProxy(t, RoundRobin, down.URL, up.URL)
+
+		statuses := map[int]int{}
+		for i := 0; i < 4; i++ {
+			res, err := http.Post(proxy.URL, "application/json", strings.NewReader(`{}`))
+			assert.NoError(t, err)
+			res.Body.Close()
+			statuses[res.StatusCode]++
+		}
+		assert.Equal(t, map[int]int{200: 2, 502: 2}, statuses)
+	})
+}
+
+func TestBalancer_CheckHealth(t *testing.T) {
+	var sickened atomic.Bool
+	sick := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" && sickened.Load() {
+			w.WriteHeader(503)
+			return
+		}
+		w.Write([]byte("sick"))
+	}))
+	defer sick.Close()
+	well := initializeReplica(t, "well")
+
+	balancer, proxy := initializeProxy(t, RoundRobin, sick.URL, well.URL)
+	sickened.Store(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go balancer.CheckHealth(ctx, "/ping", time.Millisecond*10, time.Second)
+
+	assert.Eventually(t, func() bool { return !balancer.Stats().Upstreams[0].Healthy }, time.Second, time.Millisecond*10)
+	for i := 0; i < 4; i++ {
+		_, body := get(t, proxy.URL)
+		assert.Equal(t, "well", body)
+	}
+}
+
+func TestBalancer_NoHealthyUpstream(t *testing.T) {
+	a := initializeReplica(t, "a")
+	balancer, proxy := initializeProxy(t, RoundRobin, a.URL)
+	balancer.upstreams[0].healthy.Store(false)
+
+	status, _ := get(t, proxy.URL)
+	assert.Equal(t, 502, status)
+}
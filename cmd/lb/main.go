@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+
+	"rinha-with-go-2024/internal/infra/logger"
+)
+
+// Stands in for the nginx, balancing the requests across the API replicas, checking the health
+// of each one and serving the counters of each replica in the stats address.
+// Usage: go run ./cmd/lb -upstreams unix:/var/run/rinha/api-1.sock,unix:/var/run/rinha/api-2.sock
+func main() {
+	addr := flag.String("addr", ":9999", "address to listen on")
+	upstreams := flag.String("upstreams", "", "comma separated replicas, as host:port or unix:/path")
+	strategy := flag.String("strategy", RoundRobin, "round-robin or least-conn")
+	keepalive := flag.Int("keepalive", 200, "idle connections kept to each replica")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout to connect and to receive the response headers")
+	retries := flag.Int("retries", 1, "times an idempotent request is retried on another replica")
+	healthPath := flag.String("health", "/ping", "path answering 200 while the replica is healthy")
+	healthInterval := flag.Duration("health-interval", 2*time.Second, "interval between the health checks")
+	healthTimeout := flag.Duration("health-timeout", time.Second, "timeout of each health check")
+	statsAddr := flag.String("stats-addr", ":9998", "address of the stats endpoint, empty to disable it")
+	logLevel := flag.String("log-level", "INFO", "DEBUG, INFO, WARN or ERROR")
+	flag.Parse()
+
+	logger := logger.NewLogger(*logLevel)
+
+	var replicas []*Upstream
+	for _, address := range strings.Split(*upstreams, ",") {
+		if address = strings.TrimSpace(address); address == "" {
+			continue
+		}
+		u, err := NewUpstream(address, *keepalive, *timeout)
+		if err != nil {
+			log.Fatalf("error loading upstreams configuration: %v", err)
+		}
+		replicas = append(replicas, u)
+	}
+
+	balancer, err := NewBalancer(logger, replicas, *strategy, *retries)
+	if err != nil {
+		log.Fatalf("error loading balancer configuration: %v", err)
+	}
+	go balancer.CheckHealth(context.Background(), *healthPath, *healthInterval, *healthTimeout)
+
+	if *statsAddr != "" {
+		go serveStats(*statsAddr, balancer)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite:       func(r *httputil.ProxyRequest) { r.SetXForwarded() },
+		Transport:     balancer,
+		FlushInterval: -1,
+		BufferPool:    newBufferPool(),
+		ErrorHandler:  proxyErrorHandler(logger),
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           proxy,
+		ReadHeaderTimeout: *timeout,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	logger.Info("balancing", "addr", *addr, "strategy", *strategy, "upstreams", len(replicas))
+	log.Fatal(server.ListenAndServe())
+}
+
+// proxyErrorHandler answers like the nginx, 504 when the replica timed out and 502 otherwise.
+func proxyErrorHandler(logger *slog.Logger) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.Warn("failed to proxy the request", "method", r.Method, "path", r.URL.Path, "error", err)
+
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			w.WriteHeader(504)
+			return
+		}
+		w.WriteHeader(502)
+	}
+}
+
+func serveStats(addr string, balancer *Balancer) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(balancer.Stats())
+	})
+
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+// bufferPool reuses the buffers copying the bodies, instead of one per request.
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func newBufferPool() *bufferPool {
+	return &bufferPool{pool: sync.Pool{New: func() any {
+		b := make([]byte, 32*1024)
+		return &b
+	}}}
+}
+
+func (p *bufferPool) Get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+func (p *bufferPool) Put(b []byte) {
+	p.pool.Put(&b)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"rinha-with-go-2024/internal/domain"
+)
+
+// Receives the webhooks locally, verifying the signatures and printing the payloads.
+// With -fail N, the first N deliveries answer 500 to exercise the retries.
+// Usage: go run ./cmd/webhook-receiver -secret <segredo> -addr :9090
+func main() {
+	secret := flag.String("secret", "", "secret returned when the webhook was created")
+	addr := flag.String("addr", ":9090", "address to listen on")
+	fail := flag.Int64("fail", 0, "number of deliveries to fail before accepting them")
+	flag.Parse()
+
+	if *secret == "" {
+		log.Fatal("the secret is required")
+	}
+
+	var received atomic.Int64
+	http.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+
+		delivery := r.Header.Get("X-Webhook-Delivery")
+		timestamp := r.Header.Get("X-Webhook-Timestamp")
+		if !domain.VerifyWebhook(*secret, timestamp, payload, r.Header.Get("X-Webhook-Signature")) {
+			log.Printf("delivery %s: invalid signature", delivery)
+			w.WriteHeader(401)
+			return
+		}
+
+		if received.Add(1) <= *fail {
+			log.Printf("delivery %s: failing on purpose", delivery)
+			w.WriteHeader(500)
+			return
+		}
+
+		log.Printf("delivery %s: %s %s", delivery, r.Header.Get("X-Webhook-Event"), payload)
+		w.WriteHeader(204)
+	})
+
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,219 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/big"
+	"time"
+)
+
+var (
+	ErrInvalidProduct  = errors.New("invalid product")
+	ErrProductNotFound = errors.New("product not found")
+)
+
+const DefaultProduct = "padrao"
+
+// The accruals are posted as debits with these descriptions, which the clients can't use.
+const (
+	InterestDescription = "#juros"
+	FeeDescription      = "#tarifa"
+)
+
+const (
+	AccrualInterest = "juros"
+	AccrualFee      = "tarifa"
+)
+
+// Product holds the charges of the clients using it. The interest is accrued daily
+// over the negative balance and the fee is charged once a month.
+type Product struct {
+	Code              string
+	DailyInterestRate *big.Rat
+	MonthlyFee        Money
+}
+
+// NewProduct parses the daily interest rate as a decimal, like "0.001" for 0.1% a day.
+func NewProduct(code string, dailyInterestRate string, monthlyFee Money) (*Product, error) {
+	if len(code) == 0 || len(code) > 20 || monthlyFee < 0 {
+		return nil, ErrInvalidProduct
+	}
+
+	rate, ok := new(big.Rat).SetString(dailyInterestRate)
+	if !ok || rate.Sign() < 0 {
+		return nil, ErrInvalidProduct
+	}
+
+	return &Product{Code: code, DailyInterestRate: rate, MonthlyFee: monthlyFee}, nil
+}
+
+// Interest is the interest of one day over the negative balance, rounded half away from zero to the cent.
+func (p *Product) Interest(balance Money) (Money, error) {
+	if balance >= 0 {
+		return 0, nil
+	}
+
+	debt, err := balance.Neg()
+	if err != nil {
+		return 0, err
+	}
+
+	return multiplyRate(debt, p.DailyInterestRate)
+}
+
+// InterestRate formats the rate with the same precision of the database column.
+func (p *Product) InterestRate() string {
+	return formatRate(p.DailyInterestRate)
+}
+
+// AccrualAccount is a client with its product and the balance at the end of the accrual date.
+type AccrualAccount struct {
+	ClientID int
+	Balance  Money
+	Product  Product
+}
+
+// Accrual is a charge posted as a debit at PostedAt, at most once per client, kind and period.
+type Accrual struct {
+	ClientID      int
+	Kind          string
+	Period        time.Time
+	Amount        Money
+	PostedAt      time.Time
+	TransactionID int
+}
+
+// Transaction is the debit of the accrual. It is not checked against the client's limit.
+func (a *Accrual) Transaction() *Transaction {
+	description := InterestDescription
+	if a.Kind == AccrualFee {
+		description = FeeDescription
+	}
+
+	return &Transaction{
+		ClientID:    a.ClientID,
+		Amount:      a.Amount,
+		Kind:        "d",
+		Description: description,
+		UpdatedAt:   a.PostedAt,
+	}
+}
+
+type AccrualSummary struct {
+	Accounts int
+	Posted   int
+	Skipped  int
+}
+
+type AccrualRepository interface {
+	// GetAccrualAccounts returns every client with the balance it had at end.
+	GetAccrualAccounts(ctx context.Context, end time.Time) ([]AccrualAccount, error)
+	// PostAccrual returns the client right after the accrual, or nil, without posting it,
+	// when the accrual of the same client, kind and period was already posted.
+	PostAccrual(ctx context.Context, a *Accrual) (*Client, error)
+	SaveProduct(ctx context.Context, p *Product) error
+	GetProducts(ctx context.Context) ([]Product, error)
+	SetClientProduct(ctx context.Context, clientID int, code string) error
+}
+
+type AccrualService struct {
+	logger  *slog.Logger
+	repo    AccrualRepository
+	clients *ClientService
+}
+
+func NewAccrualService(logger *slog.Logger, repo AccrualRepository) *AccrualService {
+	return &AccrualService{
+		logger: logger,
+		repo:   repo,
+	}
+}
+
+// WithClientService runs the hooks of the client service for the posted accruals, so they
+// invalidate the cached statement and notify the observers like the other transactions.
+func (s *AccrualService) WithClientService(clients *ClientService) *AccrualService {
+	s.clients = clients
+	return s
+}
+
+// Accrue charges the interest of the date, in UTC, and the fee of its month. The interest is
+// computed over the balance at the end of the date and the charges are posted at that time,
+// so running it again for the same date, or back-filling a past one, gives the same result.
+func (s *AccrualService) Accrue(ctx context.Context, date time.Time) (AccrualSummary, error) {
+	var summary AccrualSummary
+
+	date = date.UTC()
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := day.AddDate(0, 0, 1).Add(-time.Microsecond)
+
+	accounts, err := s.repo.GetAccrualAccounts(ctx, end)
+	if err != nil {
+		return summary, err
+	}
+
+	for _, account := range accounts {
+		summary.Accounts++
+
+		interest, err := account.Product.Interest(account.Balance)
+		if err != nil {
+			return summary, err
+		}
+
+		var accruals []Accrual
+		if interest > 0 {
+			accruals = append(accruals, Accrual{Kind: AccrualInterest, Period: day, Amount: interest})
+		}
+		if account.Product.MonthlyFee > 0 {
+			accruals = append(accruals, Accrual{Kind: AccrualFee, Period: month, Amount: account.Product.MonthlyFee})
+		}
+
+		for _, accrual := range accruals {
+			accrual.ClientID = account.ClientID
+			accrual.PostedAt = end
+
+			client, err := s.repo.PostAccrual(ctx, &accrual)
+			if err != nil {
+				LoggerFromContext(ctx, s.logger).ErrorContext(ctx, "failed to post the accrual", "clientID", account.ClientID, "kind", accrual.Kind, "error", err)
+				return summary, err
+			}
+
+			if client == nil {
+				summary.Skipped++
+				continue
+			}
+
+			summary.Posted++
+			if s.clients != nil {
+				t := accrual.Transaction()
+				t.TransactionID = accrual.TransactionID
+				s.clients.TransactionPosted(ctx, t, client)
+			}
+		}
+	}
+
+	return summary, nil
+}
+
+func (s *AccrualService) SetProduct(ctx context.Context, code string, dailyInterestRate string, monthlyFee Money) (*Product, error) {
+	p, err := NewProduct(code, dailyInterestRate, monthlyFee)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveProduct(ctx, p); err != nil {
+		LoggerFromContext(ctx, s.logger).ErrorContext(ctx, "failed to save the product", "code", code, "error", err)
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (s *AccrualService) GetProducts(ctx context.Context) ([]Product, error) {
+	return s.repo.GetProducts(ctx)
+}
+
+func (s *AccrualService) SetClientProduct(ctx context.Context, clientID int, code string) error {
+	return s.repo.SetClientProduct(ctx, clientID, code)
+}
@@ -0,0 +1,168 @@
+package domain
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAccrualRepository struct {
+	accounts []AccrualAccount
+	posted   map[string]Accrual
+	end      time.Time
+}
+
+func (r *fakeAccrualRepository) GetAccrualAccounts(ctx context.Context, end time.Time) ([]AccrualAccount, error) {
+	r.end = end
+	return r.accounts, nil
+}
+
+func (r *fakeAccrualRepository) PostAccrual(ctx context.Context, a *Accrual) (*Client, error) {
+	key := a.Kind + a.Period.Format(time.DateOnly)
+	if _, ok := r.posted[key]; ok {
+		return nil, nil
+	}
+	a.TransactionID = len(r.posted) + 1
+	r.posted[key] = *a
+	return &Client{ID: a.ClientID}, nil
+}
+
+type fakeStatementCache struct {
+	StatementCache
+	invalidated []int
+}
+
+func (c *fakeStatementCache) Invalidate(ctx context.Context, clientID int, version int64) {
+	c.invalidated = append(c.invalidated, clientID)
+}
+
+type fakeObserver struct {
+	accepted []Transaction
+}
+
+func (o *fakeObserver) TransactionAccepted(ctx context.Context, t *Transaction, client *Client) {
+	o.accepted = append(o.accepted, *t)
+}
+
+func (o *fakeObserver) TransactionRejected(ctx context.Context, t *Transaction, err error) {}
+
+func (r *fakeAccrualRepository) SaveProduct(ctx context.Context, p *Product) error {
+	return nil
+}
+
+func (r *fakeAccrualRepository) GetProducts(ctx context.Context) ([]Product, error) {
+	return nil, nil
+}
+
+func (r *fakeAccrualRepository) SetClientProduct(ctx context.Context, clientID int, code string) error {
+	return nil
+}
+
+func TestProduct_Interest(t *testing.T) {
+	product, err := NewProduct(DefaultProduct, "0.001", 0)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		balance  Money
+		expected Money
+	}{
+		{"positive balance", 1000, 0},
+		{"zero balance", 0, 0},
+		{"negative balance", -100000, 100},
+		{"rounded half away from zero", -1500, 2},
+		{"rounded down", -1499, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interest, err := product.Interest(tt.balance)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, interest)
+		})
+	}
+}
+
+func TestProduct_New_Invalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		rate       string
+		monthlyFee Money
+	}{
+		{"empty code", "", "0.001", 0},
+		{"negative rate", DefaultProduct, "-0.001", 0},
+		{"invalid rate", DefaultProduct, "abc", 0},
+		{"negative fee", DefaultProduct, "0.001", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewProduct(tt.code, tt.rate, tt.monthlyFee)
+			assert.ErrorIs(t, err, ErrInvalidProduct)
+		})
+	}
+}
+
+func TestAccrualService_Accrue(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+	product, _ := NewProduct(DefaultProduct, "0.001", 500)
+	repo := &fakeAccrualRepository{
+		accounts: []AccrualAccount{
+			{ClientID: 1, Balance: -100000, Product: *product},
+		},
+		posted: map[string]Accrual{},
+	}
+	svc := NewAccrualService(logger, repo)
+
+	summary, err := svc.Accrue(ctx, time.Date(2024, 9, 13, 15, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, AccrualSummary{Accounts: 1, Posted: 2}, summary)
+	assert.Equal(t, time.Date(2024, 9, 13, 23, 59, 59, 999999000, time.UTC), repo.end)
+	assert.Equal(t, Money(100), repo.posted[AccrualInterest+"2024-09-13"].Amount)
+	assert.Equal(t, Money(500), repo.posted[AccrualFee+"2024-09-01"].Amount)
+	assert.Equal(t, repo.end, repo.posted[AccrualFee+"2024-09-01"].PostedAt)
+
+	t.Run("same date again", func(t *testing.T) {
+		summary, err := svc.Accrue(ctx, time.Date(2024, 9, 13, 18, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, AccrualSummary{Accounts: 1, Skipped: 2}, summary)
+	})
+
+	t.Run("next date in the same month", func(t *testing.T) {
+		summary, err := svc.Accrue(ctx, time.Date(2024, 9, 14, 0, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, AccrualSummary{Accounts: 1, Posted: 1, Skipped: 1}, summary)
+	})
+
+	t.Run("the posted accruals run the hooks of the client service", func(t *testing.T) {
+		cache := &fakeStatementCache{}
+		observer := &fakeObserver{}
+		clients := NewClientRepository(logger, &fakeClientRepository{}).WithStatementCache(cache).WithObserver(observer)
+		svc.WithClientService(clients)
+
+		summary, err := svc.Accrue(ctx, time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, AccrualSummary{Accounts: 1, Posted: 2}, summary)
+		assert.Equal(t, []int{1, 1}, cache.invalidated)
+		assert.Len(t, observer.accepted, 2)
+		assert.Equal(t, InterestDescription, observer.accepted[0].Description)
+		assert.Equal(t, repo.posted[AccrualInterest+"2024-10-01"].TransactionID, observer.accepted[0].TransactionID)
+
+		_, err = svc.Accrue(ctx, time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Len(t, observer.accepted, 2, "the skipped accruals aren't notified")
+	})
+}
+
+func TestTransaction_New_ReservedDescription(t *testing.T) {
+	for _, description := range []string{InterestDescription, FeeDescription} {
+		_, err := NewTransaction(1, 10, "c", description)
+		assert.ErrorIs(t, err, ErrInvalidTransaction)
+	}
+}
@@ -0,0 +1,192 @@
+package domain
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrForbidden        = errors.New("forbidden")
+	ErrAPIKeyNotFound   = errors.New("api key not found")
+	ErrRequestReplayed  = errors.New("request nonce already used")
+	ErrRequestOutOfTime = errors.New("request timestamp outside of the allowed window")
+)
+
+// MaxNonceLength is the size of the nonce column, longer nonces are unauthorized.
+const MaxNonceLength = 64
+
+const (
+	ScopeTransactionsWrite = "transacoes:write"
+	ScopeStatementRead     = "extrato:read"
+	ScopeAdmin             = "admin"
+)
+
+// ClientScopes are the scopes granted to a client authenticated with an API key.
+var ClientScopes = []string{ScopeTransactionsWrite, ScopeStatementRead}
+
+// Principal is the authenticated caller of a request, either from an API key or a JWT.
+type Principal struct {
+	ClientID int
+	Scopes   []string
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanAccessClient checks if the principal may act on the given client, admins can act on any client.
+func (p *Principal) CanAccessClient(clientID int) bool {
+	return p.ClientID == clientID || p.HasScope(ScopeAdmin)
+}
+
+type APIKey struct {
+	ID        int
+	ClientID  int
+	Hash      string
+	CreatedAt time.Time
+}
+
+// SignedRequest holds the parts of an HTTP request covered by the HMAC signature, and the
+// id of the API key that signed it. The key itself never travels with the request.
+type SignedRequest struct {
+	KeyID     string
+	Method    string
+	Path      string
+	Query     string
+	Body      []byte
+	Timestamp string
+	Nonce     string
+	Signature string
+}
+
+type AuthRepository interface {
+	CreateAPIKey(ctx context.Context, clientID int, hash string) (*APIKey, error)
+	GetAPIKey(ctx context.Context, id int) (*APIKey, error)
+	RegisterNonce(ctx context.Context, apiKeyID int, nonce string) error
+	PurgeNonces(ctx context.Context, olderThan time.Duration) error
+}
+
+type AuthService struct {
+	logger *slog.Logger
+	repo   AuthRepository
+	window time.Duration
+	now    func() time.Time
+}
+
+func NewAuthService(logger *slog.Logger, repo AuthRepository, window time.Duration) *AuthService {
+	return &AuthService{
+		logger: logger,
+		repo:   repo,
+		window: window,
+		now:    time.Now,
+	}
+}
+
+// CreateAPIKey generates a new key for the client and only persists its hash, the plain key
+// is returned once to be handed to the client along with the id that identifies it.
+func (s *AuthService) CreateAPIKey(ctx context.Context, clientID int) (*APIKey, string, error) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	created, err := s.repo.CreateAPIKey(ctx, clientID, HashAPIKey(key))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return created, key, nil
+}
+
+// Authenticate validates the signature, the timestamp window and the nonce of the request,
+// returning the client ID that owns the API key.
+func (s *AuthService) Authenticate(ctx context.Context, r SignedRequest) (int, error) {
+	keyID, err := strconv.Atoi(r.KeyID)
+	if err != nil || r.Signature == "" || r.Nonce == "" || len(r.Nonce) > MaxNonceLength {
+		return 0, ErrUnauthorized
+	}
+
+	if err := s.validTimestamp(r.Timestamp); err != nil {
+		return 0, err
+	}
+
+	key, err := s.repo.GetAPIKey(ctx, keyID)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return 0, ErrUnauthorized
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	expected := signRequest(key.Hash, r.Method, r.Path, r.Query, r.Body, r.Timestamp, r.Nonce)
+	if !hmac.Equal([]byte(expected), []byte(r.Signature)) {
+		return 0, ErrUnauthorized
+	}
+
+	if err := s.repo.RegisterNonce(ctx, key.ID, r.Nonce); err != nil {
+		return 0, err
+	}
+
+	return key.ClientID, nil
+}
+
+// PurgeNonces removes the nonces that can't be replayed anymore given they are outside the window.
+func (s *AuthService) PurgeNonces(ctx context.Context) error {
+	return s.repo.PurgeNonces(ctx, s.window*2)
+}
+
+func (s *AuthService) validTimestamp(timestamp string) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrUnauthorized
+	}
+
+	diff := s.now().Sub(time.Unix(seconds, 0))
+	if diff > s.window || diff < -s.window {
+		return ErrRequestOutOfTime
+	}
+
+	return nil
+}
+
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// SignRequest computes the hex HMAC-SHA256 of the request for the client holding the API key.
+// The secret is the hash of the key, which the server has stored, so the key itself is never sent.
+// The signed message is the method, path, raw query, timestamp, nonce and body separated by new lines.
+func SignRequest(key, method, path, query string, body []byte, timestamp, nonce string) string {
+	return signRequest(HashAPIKey(key), method, path, query, body, timestamp, nonce)
+}
+
+func signRequest(secret, method, path, query string, body []byte, timestamp, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n" + query + "\n" + timestamp + "\n" + nonce + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
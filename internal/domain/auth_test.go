@@ -0,0 +1,184 @@
+package domain
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAuthRepository struct {
+	keys   map[int]*APIKey
+	nonces map[string]bool
+}
+
+func newFakeAuthRepository() *fakeAuthRepository {
+	return &fakeAuthRepository{
+		keys:   map[int]*APIKey{},
+		nonces: map[string]bool{},
+	}
+}
+
+func (r *fakeAuthRepository) CreateAPIKey(ctx context.Context, clientID int, hash string) (*APIKey, error) {
+	key := &APIKey{ID: len(r.keys) + 1, ClientID: clientID, Hash: hash}
+	r.keys[key.ID] = key
+	return key, nil
+}
+
+func (r *fakeAuthRepository) GetAPIKey(ctx context.Context, id int) (*APIKey, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (r *fakeAuthRepository) RegisterNonce(ctx context.Context, apiKeyID int, nonce string) error {
+	id := strconv.Itoa(apiKeyID) + ":" + nonce
+	if r.nonces[id] {
+		return ErrRequestReplayed
+	}
+	r.nonces[id] = true
+	return nil
+}
+
+func (r *fakeAuthRepository) PurgeNonces(ctx context.Context, olderThan time.Duration) error {
+	return nil
+}
+
+func TestAuthService_Authenticate(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"valor": 10, "tipo": "c", "descricao": "teste"}`)
+
+	svc := NewAuthService(logger, newFakeAuthRepository(), time.Minute*5)
+	created, key, err := svc.CreateAPIKey(context.Background(), 1)
+	assert.NoError(t, err)
+
+	signed := func(nonce string) SignedRequest {
+		return SignedRequest{
+			KeyID:     strconv.Itoa(created.ID),
+			Method:    "POST",
+			Path:      "/clientes/1/transacoes",
+			Body:      body,
+			Timestamp: timestamp,
+			Nonce:     nonce,
+			Signature: SignRequest(key, "POST", "/clientes/1/transacoes", "", body, timestamp, nonce),
+		}
+	}
+
+	t.Run("valid signed request", func(t *testing.T) {
+		clientID, err := svc.Authenticate(context.Background(), signed("nonce-1"))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, clientID)
+	})
+
+	t.Run("replayed nonce", func(t *testing.T) {
+		_, err := svc.Authenticate(context.Background(), signed("nonce-2"))
+		assert.NoError(t, err)
+
+		_, err = svc.Authenticate(context.Background(), signed("nonce-2"))
+		assert.ErrorIs(t, err, ErrRequestReplayed)
+	})
+
+	t.Run("nonce longer than the column", func(t *testing.T) {
+		_, err := svc.Authenticate(context.Background(), signed(strings.Repeat("n", MaxNonceLength+1)))
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	})
+
+	t.Run("tampered body", func(t *testing.T) {
+		r := signed("nonce-3")
+		r.Body = []byte(`{"valor": 1000000, "tipo": "d", "descricao": "teste"}`)
+
+		_, err := svc.Authenticate(context.Background(), r)
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	})
+
+	t.Run("tampered query", func(t *testing.T) {
+		r := signed("nonce-6")
+		r.Query = "atomico=false"
+
+		_, err := svc.Authenticate(context.Background(), r)
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	})
+
+	t.Run("signed with the key id instead of the key", func(t *testing.T) {
+		r := signed("nonce-7")
+		r.Signature = SignRequest(r.KeyID, r.Method, r.Path, r.Query, r.Body, r.Timestamp, r.Nonce)
+
+		_, err := svc.Authenticate(context.Background(), r)
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	})
+
+	t.Run("unknown api key", func(t *testing.T) {
+		for _, id := range []string{"1000", "unknown", ""} {
+			r := signed("nonce-4")
+			r.KeyID = id
+
+			_, err := svc.Authenticate(context.Background(), r)
+			assert.ErrorIs(t, err, ErrUnauthorized, id)
+		}
+	})
+
+	t.Run("timestamp outside of the window", func(t *testing.T) {
+		old := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+		r := signed("nonce-5")
+		r.Timestamp = old
+		r.Signature = SignRequest(key, r.Method, r.Path, r.Query, r.Body, old, r.Nonce)
+
+		_, err := svc.Authenticate(context.Background(), r)
+		assert.ErrorIs(t, err, ErrRequestOutOfTime)
+	})
+}
+
+func TestPrincipal_HasScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		given    Principal
+		scope    string
+		clientID int
+		expected bool
+	}{
+		{
+			name:     "client with the scope on its own id",
+			given:    Principal{ClientID: 1, Scopes: ClientScopes},
+			scope:    ScopeStatementRead,
+			clientID: 1,
+			expected: true,
+		},
+		{
+			name:     "client without the scope",
+			given:    Principal{ClientID: 1, Scopes: []string{ScopeStatementRead}},
+			scope:    ScopeTransactionsWrite,
+			clientID: 1,
+			expected: false,
+		},
+		{
+			name:     "client with the scope on another id",
+			given:    Principal{ClientID: 1, Scopes: ClientScopes},
+			scope:    ScopeStatementRead,
+			clientID: 2,
+			expected: false,
+		},
+		{
+			name:     "admin on any client",
+			given:    Principal{Scopes: []string{ScopeAdmin}},
+			scope:    ScopeTransactionsWrite,
+			clientID: 2,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed := tt.given.HasScope(tt.scope) && tt.given.CanAccessClient(tt.clientID)
+			assert.Equal(t, tt.expected, allowed)
+		})
+	}
+}
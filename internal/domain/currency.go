@@ -0,0 +1,144 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const DefaultCurrency = "BRL"
+
+// exchangeRateDecimalDigits is the scale of the rate columns, NUMERIC(20, 10), which leaves
+// exchangeRateIntegerDigits before the point.
+const (
+	exchangeRateDecimalDigits = 10
+	exchangeRateIntegerDigits = 10
+)
+
+var (
+	ErrInvalidCurrency      = errors.New("invalid currency")
+	ErrInvalidExchangeRate  = errors.New("invalid exchange rate")
+	ErrExchangeRateNotFound = errors.New("exchange rate not found")
+	ErrCurrencyInUse        = errors.New("the client already has transactions in its currency")
+)
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	ratePattern     = regexp.MustCompile(fmt.Sprintf(`^(0|[1-9][0-9]{0,%d})(\.[0-9]{1,%d})?$`,
+		exchangeRateIntegerDigits-1, exchangeRateDecimalDigits))
+)
+
+// ExchangeRate converts an amount in the From currency to the To currency.
+type ExchangeRate struct {
+	From      string
+	To        string
+	Rate      *big.Rat
+	UpdatedAt time.Time
+}
+
+// NewExchangeRate parses the rate as a positive decimal, like "5.4321", that fits the database
+// column without rounding, so fractions like "1/3", exponents and more digits are invalid.
+func NewExchangeRate(from string, to string, rate string) (*ExchangeRate, error) {
+	if err := validCurrency(from); err != nil {
+		return nil, err
+	}
+
+	if err := validCurrency(to); err != nil {
+		return nil, err
+	}
+
+	if from == to {
+		return nil, ErrInvalidExchangeRate
+	}
+
+	if !ratePattern.MatchString(rate) {
+		return nil, ErrInvalidExchangeRate
+	}
+
+	r, ok := new(big.Rat).SetString(rate)
+	if !ok || r.Sign() <= 0 {
+		return nil, ErrInvalidExchangeRate
+	}
+
+	return &ExchangeRate{From: from, To: to, Rate: r}, nil
+}
+
+// Convert multiplies the amount by the rate rounding half away from zero to the cent.
+func (r *ExchangeRate) Convert(amount Money) (Money, error) {
+	return multiplyRate(amount, r.Rate)
+}
+
+// multiplyRate multiplies the amount by the rate rounding half away from zero to the cent.
+func multiplyRate(amount Money, rate *big.Rat) (Money, error) {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(amount)), rate)
+
+	num, den := product.Num(), product.Denom()
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(den) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(num.Sign())))
+	}
+
+	if !quotient.IsInt64() {
+		return 0, ErrMoneyOverflow
+	}
+
+	return Money(quotient.Int64()), nil
+}
+
+// Decimal formats the rate with the same precision of the database column.
+func (r *ExchangeRate) Decimal() string {
+	return formatRate(r.Rate)
+}
+
+func formatRate(rate *big.Rat) string {
+	decimal := strings.TrimRight(rate.FloatString(exchangeRateDecimalDigits), "0")
+	return strings.TrimSuffix(decimal, ".")
+}
+
+func validCurrency(code string) error {
+	if currencyPattern.MatchString(code) {
+		return nil
+	}
+
+	return ErrInvalidCurrency
+}
+
+type ExchangeRateRepository interface {
+	SaveExchangeRate(ctx context.Context, r *ExchangeRate) error
+	GetExchangeRates(ctx context.Context) ([]ExchangeRate, error)
+}
+
+type ExchangeService struct {
+	logger *slog.Logger
+	repo   ExchangeRateRepository
+}
+
+func NewExchangeService(logger *slog.Logger, repo ExchangeRateRepository) *ExchangeService {
+	return &ExchangeService{
+		logger: logger,
+		repo:   repo,
+	}
+}
+
+func (s *ExchangeService) SetRate(ctx context.Context, from string, to string, rate string) (*ExchangeRate, error) {
+	r, err := NewExchangeRate(from, to, rate)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveExchangeRate(ctx, r); err != nil {
+		LoggerFromContext(ctx, s.logger).ErrorContext(ctx, "failed to save the exchange rate", "from", from, "to", to, "error", err)
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (s *ExchangeService) GetRates(ctx context.Context) ([]ExchangeRate, error) {
+	return s.repo.GetExchangeRates(ctx)
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchangeRate_New(t *testing.T) {
+	tests := []struct {
+		name        string
+		from        string
+		to          string
+		rate        string
+		expectedErr error
+	}{
+		{name: "valid rate", from: "USD", to: "BRL", rate: "5.4321"},
+		{name: "invalid currency", from: "usd", to: "BRL", rate: "5.4321", expectedErr: ErrInvalidCurrency},
+		{name: "same currency", from: "BRL", to: "BRL", rate: "1", expectedErr: ErrInvalidExchangeRate},
+		{name: "zero rate", from: "USD", to: "BRL", rate: "0", expectedErr: ErrInvalidExchangeRate},
+		{name: "invalid rate", from: "USD", to: "BRL", rate: "abc", expectedErr: ErrInvalidExchangeRate},
+		{name: "largest rate", from: "USD", to: "BRL", rate: "9999999999.9999999999"},
+		{name: "fraction", from: "USD", to: "BRL", rate: "1/3", expectedErr: ErrInvalidExchangeRate},
+		{name: "exponent", from: "USD", to: "BRL", rate: "5e2", expectedErr: ErrInvalidExchangeRate},
+		{name: "negative rate", from: "USD", to: "BRL", rate: "-5.25", expectedErr: ErrInvalidExchangeRate},
+		{name: "zero decimal rate", from: "USD", to: "BRL", rate: "0.0000000000", expectedErr: ErrInvalidExchangeRate},
+		{name: "over the integer digits", from: "USD", to: "BRL", rate: "10000000000", expectedErr: ErrInvalidExchangeRate},
+		{name: "over the decimal digits", from: "USD", to: "BRL", rate: "0.00000000001", expectedErr: ErrInvalidExchangeRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExchangeRate(tt.from, tt.to, tt.rate)
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestExchangeRate_Convert(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     string
+		amount   Money
+		expected Money
+	}{
+		{name: "exact conversion", rate: "5", amount: 100, expected: 500},
+		{name: "rounds half up", rate: "0.5", amount: 5, expected: 3},
+		{name: "rounds down", rate: "0.3333333333", amount: 100, expected: 33},
+		{name: "negative rounds half away from zero", rate: "0.5", amount: -5, expected: -3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := NewExchangeRate("USD", "BRL", tt.rate)
+			assert.NoError(t, err)
+
+			converted, err := rate.Convert(tt.amount)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, converted)
+		})
+	}
+
+	t.Run("overflow", func(t *testing.T) {
+		rate, err := NewExchangeRate("USD", "BRL", "2")
+		assert.NoError(t, err)
+
+		_, err = rate.Convert(Money(1 << 62))
+		assert.ErrorIs(t, err, ErrMoneyOverflow)
+	})
+}
+
+func TestTransaction_Exchange(t *testing.T) {
+	transaction, err := NewTransaction(1, 1000, "c", "cambio")
+	assert.NoError(t, err)
+	assert.NoError(t, transaction.SetCurrency("USD"))
+
+	assert.False(t, transaction.NeedsExchange("USD"))
+	assert.True(t, transaction.NeedsExchange("BRL"))
+
+	rate, err := NewExchangeRate("USD", "BRL", "5.25")
+	assert.NoError(t, err)
+	assert.NoError(t, transaction.Exchange(rate))
+
+	assert.Equal(t, Money(5250), transaction.Amount)
+	assert.Equal(t, Money(1000), transaction.OriginalAmount)
+	assert.Equal(t, "5.25", transaction.Rate)
+	assert.False(t, transaction.NeedsExchange("BRL"))
+
+	t.Run("invalid currency", func(t *testing.T) {
+		transaction, err := NewTransaction(1, 1000, "c", "cambio")
+		assert.NoError(t, err)
+		assert.ErrorIs(t, transaction.SetCurrency("dolar"), ErrInvalidTransaction)
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -11,36 +13,78 @@ var (
 	ErrInvalidTransaction         = errors.New("invalid transaction")
 	ErrTransactionOverClientLimit = errors.New("transaction over the client's limit")
 	ErrClientDoesntExist          = errors.New("client doesn't exist")
+	ErrBatchRejected              = errors.New("transaction batch rejected")
+	ErrDuplicateReference         = errors.New("external reference already used")
+	ErrTransactionNotFound        = errors.New("transaction not found")
 )
 
+var externalReferencePattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// MaxBatchSize is the maximum number of transactions accepted in a single batch.
+const MaxBatchSize = 5000
+
+// Client holds the Version of its row, increased in the same database transaction as every
+// change of the balance, so the replicas can tell which of two reads of the client is newer.
 type Client struct {
 	ID        int
-	Limit     int
-	Balance   int
+	Limit     Money
+	Balance   Money
+	Currency  string
+	Version   int64
 	UpdatedAt time.Time
 }
 
-func NewClient(id int, limit int, balance int, updatedAt time.Time) *Client {
+func NewClient(id int, limit Money, balance Money, updatedAt time.Time) *Client {
 	return &Client{
 		ID:        id,
 		Limit:     limit,
 		Balance:   balance,
+		Currency:  DefaultCurrency,
 		UpdatedAt: updatedAt,
 	}
 }
 
+// Apply updates the balance with the transaction following the same rule
+// of the repository, where the balance plus the limit must stay above zero.
+func (c *Client) Apply(t *Transaction) error {
+	newBalance, err := c.Balance.Add(t.SignedAmount())
+	if err != nil {
+		return err
+	}
+
+	available, err := c.Limit.Add(newBalance)
+	if err != nil {
+		return err
+	}
+
+	if available <= 0 {
+		return ErrTransactionOverClientLimit
+	}
+
+	c.Balance = newBalance
+	return nil
+}
+
+// Transaction holds the amount in the client's currency. When it was created in another
+// currency, the Currency, the OriginalAmount and the Rate applied to convert it are kept.
 type Transaction struct {
-	TransactionID int
-	ClientID      int
-	Amount        uint
-	Kind          string
-	Description   string
-	UpdatedAt     time.Time
+	TransactionID     int
+	ClientID          int
+	Amount            Money
+	Kind              string
+	Description       string
+	Currency          string
+	OriginalAmount    Money
+	Rate              string
+	Category          string
+	Metadata          Metadata
+	ExternalReference string
+	UpdatedAt         time.Time
 }
 
 func NewTransaction(
 	clientId int,
-	amount uint,
+	amount Money,
 	kind string,
 	description string,
 ) (*Transaction, error) {
@@ -51,6 +95,10 @@ func NewTransaction(
 		Description: description,
 	}
 
+	if err := t.validAmount(); err != nil {
+		return nil, err
+	}
+
 	if err := t.validKind(); err != nil {
 		return nil, err
 	}
@@ -62,6 +110,76 @@ func NewTransaction(
 	return t, nil
 }
 
+// SetCurrency sets the currency of the amount, when empty it is the client's currency.
+func (t *Transaction) SetCurrency(code string) error {
+	if code == "" {
+		return nil
+	}
+
+	if err := validCurrency(code); err != nil {
+		return ErrInvalidTransaction
+	}
+
+	t.Currency = code
+	return nil
+}
+
+// SetExternalReference sets the optional id given by the upstream system,
+// which identifies the transaction among the ones of the client. The references
+// of the scheduled occurrences are reserved.
+func (t *Transaction) SetExternalReference(reference string) error {
+	if reference == "" {
+		return nil
+	}
+
+	if !externalReferencePattern.MatchString(reference) || strings.HasPrefix(reference, ScheduleReferencePrefix) {
+		return ErrInvalidTransaction
+	}
+
+	t.ExternalReference = reference
+	return nil
+}
+
+// NeedsExchange tells if the amount must be converted to the client's currency.
+func (t *Transaction) NeedsExchange(clientCurrency string) bool {
+	return t.Currency != "" && t.Currency != clientCurrency && t.Rate == ""
+}
+
+// Exchange converts the amount to the client's currency with the rate.
+func (t *Transaction) Exchange(rate *ExchangeRate) error {
+	if rate == nil || rate.From != t.Currency {
+		return ErrExchangeRateNotFound
+	}
+
+	converted, err := rate.Convert(t.Amount)
+	if err != nil {
+		return err
+	}
+
+	t.OriginalAmount = t.Amount
+	t.Amount = converted
+	t.Rate = rate.Decimal()
+	return nil
+}
+
+// SignedAmount is the amount to add to the balance, negative for debits.
+// The amount is never negative, so negating it can't overflow.
+func (t *Transaction) SignedAmount() Money {
+	if t.Kind == "d" {
+		return -t.Amount
+	}
+
+	return t.Amount
+}
+
+func (t *Transaction) validAmount() error {
+	if t.Amount >= 0 {
+		return nil
+	}
+
+	return ErrInvalidTransaction
+}
+
 func (t *Transaction) validKind() error {
 	if t.Kind == "c" || t.Kind == "d" {
 		return nil
@@ -70,7 +188,12 @@ func (t *Transaction) validKind() error {
 	return ErrInvalidTransaction
 }
 
+// validDescription also rejects the descriptions reserved to the accruals.
 func (t *Transaction) validDescription() error {
+	if t.Description == InterestDescription || t.Description == FeeDescription {
+		return ErrInvalidTransaction
+	}
+
 	if len(t.Description) > 0 && len(t.Description) <= 10 {
 		return nil
 	}
@@ -78,9 +201,48 @@ func (t *Transaction) validDescription() error {
 	return ErrInvalidTransaction
 }
 
+// BatchItem is a transaction of a batch with its outcome, the client holds the balance right after it.
+type BatchItem struct {
+	Transaction *Transaction
+	Client      *Client
+	Err         error
+}
+
+// Statement is the client's balance with its last transactions.
+type Statement struct {
+	Client       *Client
+	Transactions []Transaction
+}
+
+// StatementCache is a read-through cache of the statements. The epoch returned on a miss must
+// be given back to Set, so a statement read before the cache is cleared isn't cached. Invalidate
+// takes the version of the client after the change, so a statement older than it isn't cached,
+// whichever replica read it.
+type StatementCache interface {
+	Get(ctx context.Context, clientID int) (*Statement, uint64, bool)
+	Set(ctx context.Context, clientID int, epoch uint64, s *Statement)
+	Invalidate(ctx context.Context, clientID int, version int64)
+}
+
+// TransactionObserver is notified after a transaction is accepted, with the client's balance
+// right after it, or rejected. It is called before the response, so it must be quick.
+type TransactionObserver interface {
+	TransactionAccepted(ctx context.Context, t *Transaction, client *Client)
+	TransactionRejected(ctx context.Context, t *Transaction, err error)
+}
+
+// BatchObserver may be implemented by an observer to be notified once per batch instead of once
+// per item, with the items accepted, which have the client, and the rejected, which have the error,
+// in order. It's meant for the observers that would look up the same data for every item.
+type BatchObserver interface {
+	BatchCompleted(ctx context.Context, clientID int, items []BatchItem)
+}
+
 type ClientService struct {
-	logger *slog.Logger
-	repo   ClientRepository
+	logger    *slog.Logger
+	repo      ClientRepository
+	cache     StatementCache
+	observers []TransactionObserver
 }
 
 func NewClientRepository(logger *slog.Logger, repo ClientRepository) *ClientService {
@@ -90,32 +252,173 @@ func NewClientRepository(logger *slog.Logger, repo ClientRepository) *ClientServ
 	}
 }
 
+// WithStatementCache enables the cache of statements, it is invalidated on every successful transaction.
+func (s *ClientService) WithStatementCache(cache StatementCache) *ClientService {
+	s.cache = cache
+	return s
+}
+
+// WithObserver adds an observer of the transactions, both single and in batches.
+func (s *ClientService) WithObserver(observer TransactionObserver) *ClientService {
+	s.observers = append(s.observers, observer)
+	return s
+}
+
 type ClientRepository interface {
-	ExecuteTransaction(ctx context.Context, t *Transaction) error
+	ExecuteTransaction(ctx context.Context, t *Transaction) (*Client, error)
+	ExecuteTransactions(ctx context.Context, clientID int, items []BatchItem, atomic bool) error
 	GetClientBalance(ctx context.Context, clientID int) (*Client, error)
-	GetClientTransactions(ctx context.Context, clientID int) ([]Transaction, error)
+	GetStatement(ctx context.Context, clientID int) (*Statement, error)
+	GetTransactions(ctx context.Context, clientID int, filter *TransactionFilter) ([]Transaction, error)
+	GetTransactionByReference(ctx context.Context, clientID int, reference string) (*Transaction, error)
+	SetClientCurrency(ctx context.Context, clientID int, currency string) (*Client, error)
 }
 
 func (s *ClientService) CreateTransaction(ctx context.Context, t *Transaction) (*Client, error) {
-	err := s.repo.ExecuteTransaction(ctx, t)
+	client, err := s.repo.ExecuteTransaction(ctx, t)
 	if err != nil {
-		s.logger.Error("failed to execute transaction", "error", err)
+		LoggerFromContext(ctx, s.logger).ErrorContext(ctx, "failed to execute transaction", "error", err)
+		s.notifyRejected(ctx, t, err)
 		return nil, err
 	}
+	s.invalidateStatement(ctx, client)
+	s.notifyAccepted(ctx, t, client)
+
+	return client, nil
+}
+
+// CreateTransactions applies the batch in order under a single lock of the client. When atomic,
+// any invalid or rejected item fails the whole batch with ErrBatchRejected, otherwise only the
+// failed items are skipped. The outcome of each item is set in the batch.
+func (s *ClientService) CreateTransactions(ctx context.Context, clientID int, items []BatchItem, atomic bool) error {
+	if len(items) == 0 || len(items) > MaxBatchSize {
+		return ErrInvalidTransaction
+	}
+
+	if atomic {
+		for _, item := range items {
+			if item.Err != nil {
+				return ErrBatchRejected
+			}
+		}
+	}
+
+	err := s.repo.ExecuteTransactions(ctx, clientID, items, atomic)
+	if err != nil && !errors.Is(err, ErrBatchRejected) {
+		LoggerFromContext(ctx, s.logger).ErrorContext(ctx, "failed to execute transaction batch", "error", err)
+	}
+	if err == nil {
+		// The balance is updated once per batch, so the clients of the accepted items share its version.
+		for i := len(items) - 1; i >= 0; i-- {
+			if items[i].Client != nil {
+				s.invalidateStatement(ctx, items[i].Client)
+				break
+			}
+		}
+	}
 
-	return s.repo.GetClientBalance(ctx, t.ClientID)
+	completed := make([]BatchItem, 0, len(items))
+	for _, item := range items {
+		switch {
+		case item.Err != nil && item.Transaction != nil:
+			completed = append(completed, BatchItem{Transaction: item.Transaction, Err: item.Err})
+		case err == nil && item.Client != nil:
+			completed = append(completed, BatchItem{Transaction: item.Transaction, Client: item.Client})
+		}
+	}
+	s.notifyBatch(ctx, clientID, completed)
+
+	return err
+}
+
+// TransactionPosted runs the hooks of an accepted transaction for the ones posted by the other
+// services, like the accruals, once committed.
+func (s *ClientService) TransactionPosted(ctx context.Context, t *Transaction, client *Client) {
+	s.invalidateStatement(ctx, client)
+	s.notifyAccepted(ctx, t, client)
 }
 
 func (s *ClientService) GetStatement(ctx context.Context, clientId int) (*Client, []Transaction, error) {
-	client, err := s.repo.GetClientBalance(ctx, clientId)
+	var epoch uint64
+	if s.cache != nil {
+		statement, e, ok := s.cache.Get(ctx, clientId)
+		if ok {
+			return statement.Client, statement.Transactions, nil
+		}
+		epoch = e
+	}
+
+	statement, err := s.repo.GetStatement(ctx, clientId)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	transactions, err := s.repo.GetClientTransactions(ctx, clientId)
+	if s.cache != nil {
+		s.cache.Set(ctx, clientId, epoch, statement)
+	}
+
+	return statement.Client, statement.Transactions, nil
+}
+
+// SetCurrency changes the currency of a client without transactions, since their amounts, the
+// balance and the limit would have to be converted, and fails with ErrCurrencyInUse otherwise.
+func (s *ClientService) SetCurrency(ctx context.Context, clientID int, currency string) error {
+	if err := validCurrency(currency); err != nil {
+		return err
+	}
+
+	client, err := s.repo.SetClientCurrency(ctx, clientID, currency)
 	if err != nil {
-		return nil, nil, err
+		return err
+	}
+	s.invalidateStatement(ctx, client)
+
+	return nil
+}
+
+func (s *ClientService) GetClientBalance(ctx context.Context, clientID int) (*Client, error) {
+	return s.repo.GetClientBalance(ctx, clientID)
+}
+
+func (s *ClientService) GetTransactions(ctx context.Context, clientID int, filter *TransactionFilter) ([]Transaction, error) {
+	return s.repo.GetTransactions(ctx, clientID, filter)
+}
+
+func (s *ClientService) GetTransactionByReference(ctx context.Context, clientID int, reference string) (*Transaction, error) {
+	return s.repo.GetTransactionByReference(ctx, clientID, reference)
+}
+
+func (s *ClientService) notifyAccepted(ctx context.Context, t *Transaction, client *Client) {
+	for _, observer := range s.observers {
+		observer.TransactionAccepted(ctx, t, client)
 	}
+}
 
-	return client, transactions, nil
+func (s *ClientService) notifyRejected(ctx context.Context, t *Transaction, err error) {
+	for _, observer := range s.observers {
+		observer.TransactionRejected(ctx, t, err)
+	}
+}
+
+func (s *ClientService) notifyBatch(ctx context.Context, clientID int, items []BatchItem) {
+	for _, observer := range s.observers {
+		if batch, ok := observer.(BatchObserver); ok {
+			batch.BatchCompleted(ctx, clientID, items)
+			continue
+		}
+
+		for _, item := range items {
+			if item.Err != nil {
+				observer.TransactionRejected(ctx, item.Transaction, item.Err)
+			} else {
+				observer.TransactionAccepted(ctx, item.Transaction, item.Client)
+			}
+		}
+	}
+}
+
+func (s *ClientService) invalidateStatement(ctx context.Context, client *Client) {
+	if s.cache != nil {
+		s.cache.Invalidate(ctx, client.ID, client.Version)
+	}
 }
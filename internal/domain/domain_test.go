@@ -1,6 +1,11 @@
 package domain
 
 import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
 	"testing"
 	"time"
 
@@ -118,3 +123,91 @@ func TestClient_New_Valid(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_Apply(t *testing.T) {
+	tests := []struct {
+		name            string
+		given           Client
+		transaction     Transaction
+		expectedBalance Money
+		expectedErr     error
+	}{
+		{
+			name:            "credit transaction",
+			given:           Client{Limit: 1000, Balance: 0},
+			transaction:     Transaction{Amount: 500, Kind: "c"},
+			expectedBalance: 500,
+		},
+		{
+			name:            "debit transaction within limit",
+			given:           Client{Limit: 1000, Balance: 0},
+			transaction:     Transaction{Amount: 500, Kind: "d"},
+			expectedBalance: -500,
+		},
+		{
+			name:            "credit transaction overflowing the balance",
+			given:           Client{Limit: 1000, Balance: math.MaxInt64},
+			transaction:     Transaction{Amount: 1, Kind: "c"},
+			expectedBalance: math.MaxInt64,
+			expectedErr:     ErrMoneyOverflow,
+		},
+		{
+			name:            "debit transaction over the limit",
+			given:           Client{Limit: 1000, Balance: -500},
+			transaction:     Transaction{Amount: 500, Kind: "d"},
+			expectedBalance: -500,
+			expectedErr:     ErrTransactionOverClientLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := tt.given
+			err := client.Apply(&tt.transaction)
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expectedBalance, client.Balance)
+		})
+	}
+}
+
+func TestClientService_CreateTransactions_Invalid(t *testing.T) {
+	svc := NewClientRepository(slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+
+	t.Run("empty batch", func(t *testing.T) {
+		err := svc.CreateTransactions(context.Background(), 1, nil, true)
+		assert.ErrorIs(t, err, ErrInvalidTransaction)
+	})
+
+	t.Run("atomic batch with an invalid item", func(t *testing.T) {
+		items := []BatchItem{
+			{Transaction: &Transaction{ClientID: 1, Amount: 10, Kind: "c", Description: "test"}},
+			{Err: ErrInvalidTransaction},
+		}
+
+		err := svc.CreateTransactions(context.Background(), 1, items, true)
+		assert.ErrorIs(t, err, ErrBatchRejected)
+	})
+}
+
+func TestTransaction_SetExternalReference(t *testing.T) {
+	tests := []struct {
+		name          string
+		reference     string
+		expectedError error
+	}{
+		{"no reference", "", nil},
+		{"reference", "pedido-2024:0001", nil},
+		{"reference with slash", "pedido/1", ErrInvalidTransaction},
+		{"too long reference", strings.Repeat("a", 65), ErrInvalidTransaction},
+		{"reference of a scheduled occurrence", "agendamento:1:0", ErrInvalidTransaction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction, _ := NewTransaction(1, 10, "c", "teste")
+			err := transaction.SetExternalReference(tt.reference)
+			assert.ErrorIs(t, err, tt.expectedError)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// MaxReplayEvents bounds the events replayed when resuming a stream, a client further behind
+// gets the oldest ones and resumes again from the last of them.
+const MaxReplayEvents = 1000
+
+// TransactionEvent is an accepted transaction with the client's balance right after it,
+// identified by the transactionId, which increases with the transactions of a client.
+type TransactionEvent struct {
+	ID          int       `json:"id"`
+	ClientID    int       `json:"cliente"`
+	Amount      Money     `json:"valor"`
+	Kind        string    `json:"tipo"`
+	Description string    `json:"descricao"`
+	Limit       Money     `json:"limite"`
+	Balance     Money     `json:"saldo"`
+	OccurredAt  time.Time `json:"realizada_em"`
+	// Version is the client's after the transaction, shared by the transactions of a batch.
+	// It's only known for the live events, not the replayed ones.
+	Version int64 `json:"versao"`
+}
+
+// After tells whether the event happened after the client was read, so its balance is newer.
+func (e TransactionEvent) After(client *Client) bool {
+	return e.Version > client.Version
+}
+
+// EventPublisher broadcasts the events to the streams of every replica.
+type EventPublisher interface {
+	Publish(ctx context.Context, e *TransactionEvent) error
+}
+
+// EventStream delivers the events published from the subscription on. The channel is closed
+// when the subscriber falls behind its buffer or the events may have been lost, so it must
+// resume from the last event received.
+type EventStream interface {
+	Subscribe(clientID int) (events <-chan TransactionEvent, unsubscribe func())
+}
+
+type EventRepository interface {
+	// GetEventsAfter returns up to limit events of the client after the transaction id, the oldest
+	// first, checking the client exists when there are none.
+	GetEventsAfter(ctx context.Context, clientID int, afterID int, limit int) ([]TransactionEvent, error)
+}
+
+// EventSubscription has the events missed since the last event id, to be sent before the
+// live ones. Truncated tells there were more missed events than MaxReplayEvents.
+type EventSubscription struct {
+	Replay    []TransactionEvent
+	Events    <-chan TransactionEvent
+	Truncated bool
+	Close     func()
+	replayed  int
+}
+
+// Fresh tells whether the live event was not already replayed. The live events are not
+// deduplicated among themselves, since the replicas publish after committing and their
+// events may arrive out of order.
+func (s *EventSubscription) Fresh(e TransactionEvent) bool {
+	return e.ID > s.replayed
+}
+
+// EventService is a TransactionObserver publishing the accepted transactions.
+type EventService struct {
+	logger    *slog.Logger
+	repo      EventRepository
+	publisher EventPublisher
+	stream    EventStream
+}
+
+func NewEventService(logger *slog.Logger, repo EventRepository, publisher EventPublisher, stream EventStream) *EventService {
+	return &EventService{
+		logger:    logger,
+		repo:      repo,
+		publisher: publisher,
+		stream:    stream,
+	}
+}
+
+func (s *EventService) TransactionAccepted(ctx context.Context, t *Transaction, client *Client) {
+	if t.TransactionID == 0 {
+		return
+	}
+
+	e := &TransactionEvent{
+		ID:          t.TransactionID,
+		ClientID:    client.ID,
+		Amount:      t.Amount,
+		Kind:        t.Kind,
+		Description: t.Description,
+		Limit:       client.Limit,
+		Balance:     client.Balance,
+		OccurredAt:  client.UpdatedAt,
+		Version:     client.Version,
+	}
+	if err := s.publisher.Publish(ctx, e); err != nil {
+		LoggerFromContext(ctx, s.logger).ErrorContext(ctx, "failed to publish the transaction event", "clientID", client.ID, "error", err)
+	}
+}
+
+func (s *EventService) TransactionRejected(ctx context.Context, t *Transaction, err error) {}
+
+// Subscribe starts listening before reading the missed events, so no event is lost between
+// both, and only replays when resuming after lastEventID.
+func (s *EventService) Subscribe(ctx context.Context, clientID int, lastEventID int) (*EventSubscription, error) {
+	events, unsubscribe := s.stream.Subscribe(clientID)
+
+	limit := MaxReplayEvents
+	if lastEventID == 0 {
+		limit = 0
+	}
+
+	replay, err := s.repo.GetEventsAfter(ctx, clientID, lastEventID, limit)
+	if err != nil {
+		unsubscribe()
+		return nil, err
+	}
+
+	subscription := &EventSubscription{
+		Replay:    replay,
+		Events:    events,
+		Truncated: len(replay) == MaxReplayEvents,
+		Close:     unsubscribe,
+		replayed:  lastEventID,
+	}
+	if len(replay) > 0 {
+		subscription.replayed = replay[len(replay)-1].ID
+	}
+
+	return subscription, nil
+}
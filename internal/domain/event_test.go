@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeEventRepository struct {
+	events []TransactionEvent
+}
+
+func (r *fakeEventRepository) GetEventsAfter(ctx context.Context, clientID int, afterID int, limit int) ([]TransactionEvent, error) {
+	var events []TransactionEvent
+	for _, e := range r.events {
+		if e.ID > afterID && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+type fakeEventBroker struct {
+	published []TransactionEvent
+	events    chan TransactionEvent
+}
+
+func (b *fakeEventBroker) Publish(ctx context.Context, e *TransactionEvent) error {
+	b.published = append(b.published, *e)
+	return nil
+}
+
+func (b *fakeEventBroker) Subscribe(clientID int) (<-chan TransactionEvent, func()) {
+	return b.events, func() {}
+}
+
+func TestEventService_TransactionAccepted(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	broker := &fakeEventBroker{}
+	svc := NewEventService(logger, &fakeEventRepository{}, broker, broker)
+
+	svc.TransactionAccepted(context.Background(),
+		&Transaction{TransactionID: 7, ClientID: 1, Amount: 10, Kind: "d", Description: "teste"},
+		&Client{ID: 1, Limit: 1000, Balance: -10},
+	)
+
+	assert.Len(t, broker.published, 1)
+	assert.Equal(t, 7, broker.published[0].ID)
+	assert.Equal(t, Money(-10), broker.published[0].Balance)
+}
+
+func TestEventService_Subscribe(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+	repo := &fakeEventRepository{events: []TransactionEvent{{ID: 3}, {ID: 5}, {ID: 8}}}
+	broker := &fakeEventBroker{}
+	svc := NewEventService(logger, repo, broker, broker)
+
+	t.Run("without the last event id only the live events are sent", func(t *testing.T) {
+		subscription, err := svc.Subscribe(ctx, 1, 0)
+		assert.NoError(t, err)
+		assert.Empty(t, subscription.Replay)
+		assert.True(t, subscription.Fresh(TransactionEvent{ID: 3}))
+	})
+
+	t.Run("resuming replays the missed events", func(t *testing.T) {
+		subscription, err := svc.Subscribe(ctx, 1, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []TransactionEvent{{ID: 5}, {ID: 8}}, subscription.Replay)
+		assert.False(t, subscription.Truncated)
+		assert.False(t, subscription.Fresh(TransactionEvent{ID: 8}))
+		assert.True(t, subscription.Fresh(TransactionEvent{ID: 9}))
+	})
+}
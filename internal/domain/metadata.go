@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+)
+
+const (
+	MaxMetadataKeys        = 10
+	MaxMetadataKeyLength   = 40
+	MaxMetadataValueLength = 100
+	MaxMetadataSize        = 1024
+)
+
+// MaxTransactionsLimit is the maximum number of transactions listed at once.
+const MaxTransactionsLimit = 100
+
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+var categoryPattern = regexp.MustCompile(`^[a-z0-9_-]{1,30}$`)
+
+// Metadata is a flat JSON object annotating a transaction, like the merchant or the channel.
+// The values are strings, numbers, booleans or null, and the numbers are kept as written.
+type Metadata map[string]any
+
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	if len(data) > MaxMetadataSize {
+		return ErrInvalidMetadata
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var values map[string]any
+	if err := decoder.Decode(&values); err != nil {
+		return ErrInvalidMetadata
+	}
+
+	*m = values
+	return nil
+}
+
+func (m Metadata) validate() error {
+	if len(m) > MaxMetadataKeys {
+		return ErrInvalidMetadata
+	}
+
+	for key, value := range m {
+		if len(key) == 0 || len(key) > MaxMetadataKeyLength {
+			return ErrInvalidMetadata
+		}
+
+		switch v := value.(type) {
+		case string:
+			if len(v) > MaxMetadataValueLength {
+				return ErrInvalidMetadata
+			}
+		case json.Number, float64, bool, nil:
+		default:
+			return ErrInvalidMetadata
+		}
+	}
+
+	encoded, err := json.Marshal(m)
+	if err != nil || len(encoded) > MaxMetadataSize {
+		return ErrInvalidMetadata
+	}
+
+	return nil
+}
+
+// SetAnnotations sets the optional category, like "mercado", and metadata of the transaction.
+func (t *Transaction) SetAnnotations(category string, metadata Metadata) error {
+	if category != "" && !categoryPattern.MatchString(category) {
+		return ErrInvalidTransaction
+	}
+
+	if err := metadata.validate(); err != nil {
+		return err
+	}
+
+	t.Category = category
+	if len(metadata) > 0 {
+		t.Metadata = metadata
+	}
+
+	return nil
+}
+
+// TransactionFilter selects the transactions of the category, when given, whose metadata
+// has every key with the value, compared as text. The newest are listed first up to Limit.
+type TransactionFilter struct {
+	Category string
+	Metadata map[string]string
+	Limit    int
+}
+
+func NewTransactionFilter(category string, metadata map[string]string, limit int) (*TransactionFilter, error) {
+	if category != "" && !categoryPattern.MatchString(category) {
+		return nil, ErrInvalidTransaction
+	}
+
+	if len(metadata) > MaxMetadataKeys || limit < 1 || limit > MaxTransactionsLimit {
+		return nil, ErrInvalidTransaction
+	}
+
+	return &TransactionFilter{Category: category, Metadata: metadata, Limit: limit}, nil
+}
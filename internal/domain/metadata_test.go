@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction_SetAnnotations(t *testing.T) {
+	tests := []struct {
+		name          string
+		category      string
+		metadata      string
+		expectedError error
+	}{
+		{"no annotations", "", `null`, nil},
+		{"category and metadata", "mercado", `{"estabelecimento": "padaria", "parcelas": 3, "online": false}`, nil},
+		{"invalid category", "Mercado Livre", `null`, ErrInvalidTransaction},
+		{"nested object", "", `{"estabelecimento": {"nome": "padaria"}}`, ErrInvalidMetadata},
+		{"array", "", `{"tags": ["a", "b"]}`, ErrInvalidMetadata},
+		{"too long value", "", `{"canal": "` + strings.Repeat("a", MaxMetadataValueLength+1) + `"}`, ErrInvalidMetadata},
+		{"too many keys", "", `{"a":1,"b":1,"c":1,"d":1,"e":1,"f":1,"g":1,"h":1,"i":1,"j":1,"k":1}`, ErrInvalidMetadata},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var metadata Metadata
+			assert.NoError(t, json.Unmarshal([]byte(tt.metadata), &metadata))
+
+			transaction, _ := NewTransaction(1, 10, "c", "teste")
+			err := transaction.SetAnnotations(tt.category, metadata)
+			assert.ErrorIs(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestMetadata_JSON(t *testing.T) {
+	t.Run("numbers are kept as written", func(t *testing.T) {
+		var metadata Metadata
+		assert.NoError(t, json.Unmarshal([]byte(`{"pedido":12345678901234567890}`), &metadata))
+
+		encoded, err := json.Marshal(metadata)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"pedido":12345678901234567890}`, string(encoded))
+	})
+
+	t.Run("not an object", func(t *testing.T) {
+		var metadata Metadata
+		assert.Error(t, json.Unmarshal([]byte(`["canal"]`), &metadata))
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		var metadata Metadata
+		data := `{"canal": "` + strings.Repeat("a", MaxMetadataSize) + `"}`
+		assert.ErrorIs(t, json.Unmarshal([]byte(data), &metadata), ErrInvalidMetadata)
+	})
+}
+
+func TestTransactionFilter_New(t *testing.T) {
+	_, err := NewTransactionFilter("mercado", map[string]string{"canal": "pix"}, 10)
+	assert.NoError(t, err)
+
+	_, err = NewTransactionFilter("", nil, 0)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+
+	_, err = NewTransactionFilter("", nil, MaxTransactionsLimit+1)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+
+	_, err = NewTransactionFilter("Mercado", nil, 10)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var ErrMoneyOverflow = errors.New("money overflow")
+
+// Money is an amount in cents. The operations are checked, so an amount
+// that doesn't fit in an int64 fails with ErrMoneyOverflow instead of wrapping.
+type Money int64
+
+func (m Money) Add(other Money) (Money, error) {
+	if (other > 0 && m > math.MaxInt64-other) || (other < 0 && m < math.MinInt64-other) {
+		return 0, ErrMoneyOverflow
+	}
+
+	return m + other, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if (other < 0 && m > math.MaxInt64+other) || (other > 0 && m < math.MinInt64+other) {
+		return 0, ErrMoneyOverflow
+	}
+
+	return m - other, nil
+}
+
+func (m Money) Neg() (Money, error) {
+	return Money(0).Sub(m)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(m), 10), nil
+}
+
+// UnmarshalJSON only accepts integers, like the API always did for the amounts.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return ErrMoneyOverflow
+	}
+	if err != nil {
+		return ErrInvalidTransaction
+	}
+
+	*m = Money(value)
+	return nil
+}
+
+// ScanInt64 allows pgx to scan the NUMERIC columns into Money.
+func (m *Money) ScanInt64(v pgtype.Int8) error {
+	if !v.Valid {
+		return errors.New("cannot scan NULL into Money")
+	}
+
+	*m = Money(v.Int64)
+	return nil
+}
+
+// Int64Value allows pgx to encode Money into the NUMERIC columns.
+func (m Money) Int64Value() (pgtype.Int8, error) {
+	return pgtype.Int8{Int64: int64(m), Valid: true}, nil
+}
@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoney_Operations(t *testing.T) {
+	tests := []struct {
+		name        string
+		operation   func() (Money, error)
+		expected    Money
+		expectedErr error
+	}{
+		{
+			name:      "add",
+			operation: func() (Money, error) { return Money(100).Add(50) },
+			expected:  150,
+		},
+		{
+			name:      "sub",
+			operation: func() (Money, error) { return Money(100).Sub(150) },
+			expected:  -50,
+		},
+		{
+			name:        "add overflow",
+			operation:   func() (Money, error) { return Money(math.MaxInt64).Add(1) },
+			expectedErr: ErrMoneyOverflow,
+		},
+		{
+			name:        "add underflow",
+			operation:   func() (Money, error) { return Money(math.MinInt64).Add(-1) },
+			expectedErr: ErrMoneyOverflow,
+		},
+		{
+			name:        "sub overflow",
+			operation:   func() (Money, error) { return Money(math.MaxInt64).Sub(-1) },
+			expectedErr: ErrMoneyOverflow,
+		},
+		{
+			name:        "negate the minimum",
+			operation:   func() (Money, error) { return Money(math.MinInt64).Neg() },
+			expectedErr: ErrMoneyOverflow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.operation()
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		given       string
+		expected    Money
+		expectedErr error
+	}{
+		{
+			name:     "integer",
+			given:    `1000`,
+			expected: 1000,
+		},
+		{
+			name:        "decimal",
+			given:       `10.5`,
+			expectedErr: ErrInvalidTransaction,
+		},
+		{
+			name:        "string",
+			given:       `"1000"`,
+			expectedErr: ErrInvalidTransaction,
+		},
+		{
+			name:        "overflow",
+			given:       `9223372036854775808`,
+			expectedErr: ErrMoneyOverflow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Money
+			err := json.Unmarshal([]byte(tt.given), &m)
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, m)
+		})
+	}
+
+	t.Run("marshal", func(t *testing.T) {
+		content, err := json.Marshal(Money(-1500))
+		assert.NoError(t, err)
+		assert.Equal(t, `-1500`, string(content))
+	})
+}
@@ -0,0 +1,200 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrInvalidSchedule  = errors.New("invalid schedule")
+	ErrScheduleNotFound = errors.New("schedule not found")
+)
+
+// ScheduleReferencePrefix starts the external references of the scheduled occurrences,
+// which the transactions can't use.
+const ScheduleReferencePrefix = "agendamento:"
+
+const (
+	ScheduleActive    = "ativo"
+	ScheduleCancelled = "cancelado"
+	ScheduleDone      = "concluido"
+	ScheduleFailed    = "falhou"
+)
+
+// recurrenceParser accepts the standard five fields cron expressions, like "0 9 * * 1",
+// and the descriptors, like "@daily". The recurrences are evaluated in UTC.
+var recurrenceParser = cron.NewParser(
+	cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// ScheduledTransaction posts a copy of the Transaction at NextRunAt, once or on every
+// occurrence of the Recurrence until it is cancelled.
+type ScheduledTransaction struct {
+	ID          int
+	Transaction Transaction
+	Recurrence  string
+	NextRunAt   time.Time
+	Status      string
+	Runs        int
+	Failures    int
+	LastRunAt   time.Time
+	LastError   string
+	CreatedAt   time.Time
+}
+
+// NewScheduledTransaction runs once at runAt when there is no recurrence. With a recurrence,
+// the first run is at runAt when given, otherwise at the next occurrence after now. The
+// transaction can't have an external reference, since it would be used by every run.
+func NewScheduledTransaction(t *Transaction, runAt time.Time, recurrence string, now time.Time) (*ScheduledTransaction, error) {
+	if t == nil || t.ExternalReference != "" {
+		return nil, ErrInvalidSchedule
+	}
+
+	s := &ScheduledTransaction{
+		Transaction: *t,
+		Recurrence:  recurrence,
+		NextRunAt:   runAt.UTC(),
+		Status:      ScheduleActive,
+	}
+
+	if recurrence == "" {
+		if runAt.IsZero() {
+			return nil, ErrInvalidSchedule
+		}
+		return s, nil
+	}
+
+	schedule, err := recurrenceParser.Parse(recurrence)
+	if err != nil {
+		return nil, ErrInvalidSchedule
+	}
+
+	if runAt.IsZero() {
+		s.NextRunAt = schedule.Next(now.UTC())
+	}
+
+	return s, nil
+}
+
+// NewTransaction returns a fresh copy of the scheduled transaction, since
+// executing it converts the amount when it is in another currency. Its external
+// reference identifies the occurrence, so the unique reference of the client rejects
+// an occurrence posted again.
+func (s *ScheduledTransaction) NewTransaction() *Transaction {
+	t := s.Transaction
+	t.TransactionID = 0
+	t.ExternalReference = ScheduleReferencePrefix + strconv.Itoa(s.ID) + ":" + strconv.Itoa(s.Runs)
+	return &t
+}
+
+// Complete records the outcome of the run at now. A recurring schedule moves to the next
+// occurrence after now, so the occurrences missed while no worker was running are skipped.
+func (s *ScheduledTransaction) Complete(now time.Time, err error) {
+	s.Runs++
+	s.LastRunAt = now.UTC()
+	s.LastError = ""
+	if err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+	}
+
+	if s.Recurrence == "" {
+		s.Status = ScheduleDone
+		if err != nil {
+			s.Status = ScheduleFailed
+		}
+		return
+	}
+
+	schedule, parseErr := recurrenceParser.Parse(s.Recurrence)
+	if parseErr != nil {
+		s.Status = ScheduleFailed
+		s.LastError = parseErr.Error()
+		return
+	}
+
+	s.NextRunAt = schedule.Next(s.LastRunAt)
+}
+
+// IsTransactionRejected tells whether the error is a rejection of the transaction itself,
+// which running it again wouldn't change, instead of a failure to execute it.
+func IsTransactionRejected(err error) bool {
+	return errors.Is(err, ErrTransactionOverClientLimit) ||
+		errors.Is(err, ErrClientDoesntExist) ||
+		errors.Is(err, ErrInvalidTransaction) ||
+		errors.Is(err, ErrMoneyOverflow) ||
+		errors.Is(err, ErrExchangeRateNotFound) ||
+		errors.Is(err, ErrDuplicateReference)
+}
+
+type ScheduleRepository interface {
+	CreateSchedule(ctx context.Context, s *ScheduledTransaction) error
+	GetSchedules(ctx context.Context, clientID int) ([]ScheduledTransaction, error)
+	CancelSchedule(ctx context.Context, clientID int, scheduleID int) error
+	// RunNextDue claims the next active schedule due at now, skipping the ones claimed by
+	// other workers, and saves it after run returns. It returns false when none is due.
+	RunNextDue(ctx context.Context, now time.Time, run func(ctx context.Context, s *ScheduledTransaction) error) (bool, error)
+}
+
+type ScheduleService struct {
+	logger  *slog.Logger
+	repo    ScheduleRepository
+	clients *ClientService
+}
+
+func NewScheduleService(logger *slog.Logger, repo ScheduleRepository, clients *ClientService) *ScheduleService {
+	return &ScheduleService{
+		logger:  logger,
+		repo:    repo,
+		clients: clients,
+	}
+}
+
+func (s *ScheduleService) CreateSchedule(ctx context.Context, schedule *ScheduledTransaction) error {
+	return s.repo.CreateSchedule(ctx, schedule)
+}
+
+func (s *ScheduleService) GetSchedules(ctx context.Context, clientID int) ([]ScheduledTransaction, error) {
+	return s.repo.GetSchedules(ctx, clientID)
+}
+
+func (s *ScheduleService) CancelSchedule(ctx context.Context, clientID int, scheduleID int) error {
+	return s.repo.CancelSchedule(ctx, clientID, scheduleID)
+}
+
+// RunDue posts the transactions of up to limit schedules due at now and returns how many ran.
+// A rejected transaction, like one over the client's limit, is recorded in the schedule. Any
+// other error stops the run and leaves the schedule due, so it is retried on the next call.
+func (s *ScheduleService) RunDue(ctx context.Context, now time.Time, limit int) (int, error) {
+	run := func(ctx context.Context, schedule *ScheduledTransaction) error {
+		_, err := s.clients.CreateTransaction(ctx, schedule.NewTransaction())
+		if errors.Is(err, ErrDuplicateReference) {
+			// The occurrence was posted, but the schedule wasn't saved after it.
+			LoggerFromContext(ctx, s.logger).WarnContext(ctx, "scheduled transaction already posted", "schedule", schedule.ID, "runs", schedule.Runs)
+			err = nil
+		}
+		if err != nil && !IsTransactionRejected(err) {
+			return err
+		}
+		if err != nil {
+			LoggerFromContext(ctx, s.logger).DebugContext(ctx, "scheduled transaction rejected", "schedule", schedule.ID, "error", err)
+		}
+
+		schedule.Complete(now, err)
+		return nil
+	}
+
+	for ran := 0; ran < limit; ran++ {
+		ok, err := s.repo.RunNextDue(ctx, now, run)
+		if err != nil || !ok {
+			return ran, err
+		}
+	}
+
+	return limit, nil
+}
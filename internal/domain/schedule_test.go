@@ -0,0 +1,243 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeScheduleRepository struct {
+	schedules []*ScheduledTransaction
+}
+
+func (r *fakeScheduleRepository) CreateSchedule(ctx context.Context, s *ScheduledTransaction) error {
+	s.ID = len(r.schedules) + 1
+	r.schedules = append(r.schedules, s)
+	return nil
+}
+
+func (r *fakeScheduleRepository) GetSchedules(ctx context.Context, clientID int) ([]ScheduledTransaction, error) {
+	return nil, nil
+}
+
+func (r *fakeScheduleRepository) CancelSchedule(ctx context.Context, clientID int, scheduleID int) error {
+	return nil
+}
+
+func (r *fakeScheduleRepository) RunNextDue(
+	ctx context.Context,
+	now time.Time,
+	run func(ctx context.Context, s *ScheduledTransaction) error,
+) (bool, error) {
+	for _, s := range r.schedules {
+		if s.Status != ScheduleActive || s.NextRunAt.After(now) {
+			continue
+		}
+
+		claimed := *s
+		if err := run(ctx, &claimed); err != nil {
+			return true, err
+		}
+		*s = claimed
+		return true, nil
+	}
+
+	return false, nil
+}
+
+type fakeClientRepository struct {
+	ClientRepository
+	err     error
+	applied []Transaction
+}
+
+func (r *fakeClientRepository) ExecuteTransaction(ctx context.Context, t *Transaction) (*Client, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.applied = append(r.applied, *t)
+	return &Client{ID: t.ClientID}, nil
+}
+
+func (r *fakeClientRepository) ExecuteTransactions(ctx context.Context, clientID int, items []BatchItem, atomic bool) error {
+	client := Client{ID: clientID, Limit: 1000}
+	for i := range items {
+		if items[i].Err != nil {
+			continue
+		}
+		if err := client.Apply(items[i].Transaction); err != nil {
+			items[i].Err = err
+			continue
+		}
+		r.applied = append(r.applied, *items[i].Transaction)
+		snapshot := client
+		items[i].Client = &snapshot
+	}
+	return nil
+}
+
+func TestScheduledTransaction_New(t *testing.T) {
+	now := time.Date(2024, 9, 13, 10, 30, 0, 0, time.UTC)
+	transaction := &Transaction{ClientID: 1, Amount: 10, Kind: "c", Description: "salario"}
+
+	tests := []struct {
+		name          string
+		runAt         time.Time
+		recurrence    string
+		expectedNext  time.Time
+		expectedError error
+	}{
+		{"once", now.Add(time.Hour), "", now.Add(time.Hour), nil},
+		{"recurring from the next occurrence", time.Time{}, "0 9 * * *", time.Date(2024, 9, 14, 9, 0, 0, 0, time.UTC), nil},
+		{"recurring from a given time", now.Add(time.Minute), "@hourly", now.Add(time.Minute), nil},
+		{"neither time nor recurrence", time.Time{}, "", time.Time{}, ErrInvalidSchedule},
+		{"invalid recurrence", time.Time{}, "every day", time.Time{}, ErrInvalidSchedule},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewScheduledTransaction(transaction, tt.runAt, tt.recurrence, now)
+			assert.ErrorIs(t, err, tt.expectedError)
+			if tt.expectedError != nil {
+				return
+			}
+
+			assert.Equal(t, tt.expectedNext, s.NextRunAt)
+			assert.Equal(t, ScheduleActive, s.Status)
+		})
+	}
+
+	t.Run("transaction with an external reference", func(t *testing.T) {
+		referenced := *transaction
+		referenced.ExternalReference = "pedido-1"
+
+		_, err := NewScheduledTransaction(&referenced, now, "", now)
+		assert.ErrorIs(t, err, ErrInvalidSchedule)
+	})
+}
+
+func TestScheduledTransaction_Complete(t *testing.T) {
+	now := time.Date(2024, 9, 13, 10, 30, 0, 0, time.UTC)
+	transaction := &Transaction{ClientID: 1, Amount: 10, Kind: "d", Description: "aluguel"}
+
+	t.Run("once", func(t *testing.T) {
+		s, _ := NewScheduledTransaction(transaction, now, "", now)
+		s.Complete(now, nil)
+
+		assert.Equal(t, ScheduleDone, s.Status)
+		assert.Equal(t, 1, s.Runs)
+	})
+
+	t.Run("once rejected", func(t *testing.T) {
+		s, _ := NewScheduledTransaction(transaction, now, "", now)
+		s.Complete(now, ErrTransactionOverClientLimit)
+
+		assert.Equal(t, ScheduleFailed, s.Status)
+		assert.Equal(t, 1, s.Failures)
+		assert.Equal(t, ErrTransactionOverClientLimit.Error(), s.LastError)
+	})
+
+	t.Run("recurring skips the missed occurrences", func(t *testing.T) {
+		s, _ := NewScheduledTransaction(transaction, now.Add(-time.Hour*72), "@daily", now)
+		s.Complete(now, ErrTransactionOverClientLimit)
+		s.Complete(now, nil)
+
+		assert.Equal(t, ScheduleActive, s.Status)
+		assert.Equal(t, time.Date(2024, 9, 14, 0, 0, 0, 0, time.UTC), s.NextRunAt)
+		assert.Equal(t, 2, s.Runs)
+		assert.Equal(t, 1, s.Failures)
+		assert.Empty(t, s.LastError)
+	})
+}
+
+func TestScheduleService_RunDue(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+	now := time.Date(2024, 9, 13, 10, 30, 0, 0, time.UTC)
+	transaction := &Transaction{ClientID: 1, Amount: 10, Kind: "c", Description: "salario"}
+
+	t.Run("runs only the due schedules", func(t *testing.T) {
+		clients := &fakeClientRepository{}
+		repo := &fakeScheduleRepository{}
+		svc := NewScheduleService(logger, repo, NewClientRepository(logger, clients))
+
+		due, _ := NewScheduledTransaction(transaction, now, "", now)
+		later, _ := NewScheduledTransaction(transaction, now.Add(time.Hour), "", now)
+		svc.CreateSchedule(ctx, due)
+		svc.CreateSchedule(ctx, later)
+
+		ran, err := svc.RunDue(ctx, now, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ran)
+		assert.Len(t, clients.applied, 1)
+		assert.Equal(t, ScheduleDone, repo.schedules[0].Status)
+		assert.Equal(t, ScheduleActive, repo.schedules[1].Status)
+	})
+
+	t.Run("rejected transaction is recorded", func(t *testing.T) {
+		clients := &fakeClientRepository{err: ErrTransactionOverClientLimit}
+		repo := &fakeScheduleRepository{}
+		svc := NewScheduleService(logger, repo, NewClientRepository(logger, clients))
+
+		s, _ := NewScheduledTransaction(transaction, now, "", now)
+		svc.CreateSchedule(ctx, s)
+
+		ran, err := svc.RunDue(ctx, now, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ran)
+		assert.Equal(t, ScheduleFailed, repo.schedules[0].Status)
+	})
+
+	t.Run("failure leaves the schedule due", func(t *testing.T) {
+		failure := errors.New("connection refused")
+		clients := &fakeClientRepository{err: failure}
+		repo := &fakeScheduleRepository{}
+		svc := NewScheduleService(logger, repo, NewClientRepository(logger, clients))
+
+		s, _ := NewScheduledTransaction(transaction, now, "", now)
+		svc.CreateSchedule(ctx, s)
+
+		ran, err := svc.RunDue(ctx, now, 10)
+		assert.ErrorIs(t, err, failure)
+		assert.Equal(t, 0, ran)
+		assert.Equal(t, ScheduleActive, repo.schedules[0].Status)
+		assert.Equal(t, 0, repo.schedules[0].Runs)
+	})
+
+	t.Run("each occurrence has its own reference", func(t *testing.T) {
+		clients := &fakeClientRepository{}
+		repo := &fakeScheduleRepository{}
+		svc := NewScheduleService(logger, repo, NewClientRepository(logger, clients))
+
+		s, _ := NewScheduledTransaction(transaction, now, "@hourly", now)
+		svc.CreateSchedule(ctx, s)
+
+		_, err := svc.RunDue(ctx, now, 1)
+		assert.NoError(t, err)
+		_, err = svc.RunDue(ctx, now.Add(time.Hour), 1)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "agendamento:1:0", clients.applied[0].ExternalReference)
+		assert.Equal(t, "agendamento:1:1", clients.applied[1].ExternalReference)
+	})
+
+	t.Run("occurrence already posted is completed", func(t *testing.T) {
+		clients := &fakeClientRepository{err: ErrDuplicateReference}
+		repo := &fakeScheduleRepository{}
+		svc := NewScheduleService(logger, repo, NewClientRepository(logger, clients))
+
+		s, _ := NewScheduledTransaction(transaction, now, "", now)
+		svc.CreateSchedule(ctx, s)
+
+		ran, err := svc.RunDue(ctx, now, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ran)
+		assert.Equal(t, ScheduleDone, repo.schedules[0].Status)
+		assert.Equal(t, 0, repo.schedules[0].Failures)
+	})
+}
@@ -0,0 +1,530 @@
+package domain
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrDeliveryLeaseExpired is returned when the delivery was sent after its lease expired,
+	// so its result isn't saved, since another worker may have claimed it again.
+	ErrDeliveryLeaseExpired = errors.New("webhook delivery lease expired")
+)
+
+// The events a subscription can filter. The threshold event is sent when the balance crosses
+// the threshold of the subscription, in either direction, and the rejected debit event when
+// a debit is rejected for being over the client's limit.
+const (
+	EventBalanceThreshold = "saldo_limiar"
+	EventDebitRejected    = "debito_recusado"
+)
+
+const (
+	DeliveryPending   = "pendente"
+	DeliveryDelivered = "entregue"
+	DeliveryFailed    = "falhou"
+)
+
+// A delivery is retried with exponential backoff, starting at deliveryBackoff and
+// doubling up to maxDeliveryBackoff, until it fails after MaxDeliveryAttempts.
+const (
+	MaxDeliveryAttempts = 8
+	deliveryBackoff     = time.Second * 5
+	maxDeliveryBackoff  = time.Hour
+)
+
+// defaultDeliveryLease is how long a delivery is claimed while it is sent, see WithLease.
+const defaultDeliveryLease = time.Minute
+
+// MaxDeliveriesLimit bounds the deliveries listed in the delivery log.
+const MaxDeliveriesLimit = 100
+
+type WebhookSubscription struct {
+	ID        int
+	ClientID  int
+	URL       string
+	Events    []string
+	Threshold *Money
+	Secret    string
+	CreatedAt time.Time
+}
+
+// NewWebhookSubscription generates the secret used to sign the payloads. The
+// threshold is required by, and only used with, the threshold event.
+func NewWebhookSubscription(clientID int, rawURL string, events []string, threshold *Money) (*WebhookSubscription, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(rawURL) > 2048 {
+		return nil, ErrInvalidWebhook
+	}
+
+	if len(events) == 0 {
+		return nil, ErrInvalidWebhook
+	}
+
+	var filter []string
+	for _, event := range events {
+		if event != EventBalanceThreshold && event != EventDebitRejected {
+			return nil, ErrInvalidWebhook
+		}
+		if !slices.Contains(filter, event) {
+			filter = append(filter, event)
+		}
+	}
+
+	if slices.Contains(filter, EventBalanceThreshold) != (threshold != nil) {
+		return nil, ErrInvalidWebhook
+	}
+
+	secret, err := GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookSubscription{
+		ClientID:  clientID,
+		URL:       rawURL,
+		Events:    filter,
+		Threshold: threshold,
+		Secret:    secret,
+	}, nil
+}
+
+// WebhookEvent is the payload delivered to the subscriptions.
+type WebhookEvent struct {
+	Type        string    `json:"evento"`
+	ClientID    int       `json:"cliente"`
+	Amount      Money     `json:"valor"`
+	Kind        string    `json:"tipo"`
+	Description string    `json:"descricao"`
+	Balance     *Money    `json:"saldo,omitempty"`
+	Threshold   *Money    `json:"limiar,omitempty"`
+	Direction   string    `json:"direcao,omitempty"`
+	Error       string    `json:"erro,omitempty"`
+	OccurredAt  time.Time `json:"ocorrido_em"`
+}
+
+// Accepted returns the threshold event when the transaction moved the balance across
+// the threshold, with the direction "abaixo" or "acima" of the new balance.
+func (s *WebhookSubscription) Accepted(t *Transaction, client *Client, now time.Time) (*WebhookEvent, bool) {
+	if !slices.Contains(s.Events, EventBalanceThreshold) || s.Threshold == nil {
+		return nil, false
+	}
+
+	previous, err := client.Balance.Sub(t.SignedAmount())
+	if err != nil {
+		return nil, false
+	}
+
+	threshold := *s.Threshold
+	if (previous >= threshold) == (client.Balance >= threshold) {
+		return nil, false
+	}
+
+	direction := "acima"
+	if client.Balance < threshold {
+		direction = "abaixo"
+	}
+
+	balance := client.Balance
+	return &WebhookEvent{
+		Type:        EventBalanceThreshold,
+		ClientID:    client.ID,
+		Amount:      t.Amount,
+		Kind:        t.Kind,
+		Description: t.Description,
+		Balance:     &balance,
+		Threshold:   &threshold,
+		Direction:   direction,
+		OccurredAt:  now,
+	}, true
+}
+
+// Rejected returns the rejected debit event when the debit was over the client's limit.
+func (s *WebhookSubscription) Rejected(t *Transaction, err error, now time.Time) (*WebhookEvent, bool) {
+	if !slices.Contains(s.Events, EventDebitRejected) || t.Kind != "d" || !errors.Is(err, ErrTransactionOverClientLimit) {
+		return nil, false
+	}
+
+	return &WebhookEvent{
+		Type:        EventDebitRejected,
+		ClientID:    t.ClientID,
+		Amount:      t.Amount,
+		Kind:        t.Kind,
+		Description: t.Description,
+		Error:       err.Error(),
+		OccurredAt:  now,
+	}, true
+}
+
+type WebhookDelivery struct {
+	ID             int
+	SubscriptionID int
+	Event          string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode int
+	LastError      string
+	DeliveredAt    time.Time
+	CreatedAt      time.Time
+}
+
+func newWebhookDelivery(s *WebhookSubscription, event *WebhookEvent) (WebhookDelivery, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	return WebhookDelivery{
+		SubscriptionID: s.ID,
+		Event:          event.Type,
+		Payload:        payload,
+		Status:         DeliveryPending,
+		NextAttemptAt:  event.OccurredAt,
+	}, nil
+}
+
+// Complete records the attempt at now, only a 2xx response is a successful delivery.
+func (d *WebhookDelivery) Complete(now time.Time, statusCode int, err error) {
+	d.Attempts++
+	d.LastStatusCode = statusCode
+	d.LastError = ""
+
+	if err == nil && statusCode >= 200 && statusCode < 300 {
+		d.Status = DeliveryDelivered
+		d.DeliveredAt = now
+		return
+	}
+
+	if err != nil {
+		d.LastError = err.Error()
+	}
+
+	if d.Attempts >= MaxDeliveryAttempts {
+		d.Status = DeliveryFailed
+		return
+	}
+
+	backoff := deliveryBackoff << (d.Attempts - 1)
+	if backoff > maxDeliveryBackoff {
+		backoff = maxDeliveryBackoff
+	}
+	d.NextAttemptAt = now.Add(backoff)
+}
+
+// SignWebhook computes the hex HMAC-SHA256 of the timestamp and the payload separated by a dot.
+func SignWebhook(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature header, like "sha256=<hex>", in constant time.
+func VerifyWebhook(secret string, timestamp string, payload []byte, signature string) bool {
+	expected := "sha256=" + SignWebhook(secret, timestamp, payload)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, s *WebhookSubscription) error
+	GetSubscriptions(ctx context.Context, clientID int) ([]WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, clientID int, subscriptionID int) error
+	// GetDeliveries returns the last deliveries of the subscription, the newest first.
+	GetDeliveries(ctx context.Context, clientID int, subscriptionID int, limit int) ([]WebhookDelivery, error)
+	EnqueueDeliveries(ctx context.Context, deliveries []WebhookDelivery) error
+	// RunNextDelivery claims the next pending delivery due at now for the lease, skipping the
+	// ones claimed by other workers, and saves it after run returns. It returns false when
+	// none is due.
+	RunNextDelivery(
+		ctx context.Context,
+		now time.Time,
+		lease time.Duration,
+		run func(ctx context.Context, d *WebhookDelivery, s *WebhookSubscription) error,
+	) (bool, error)
+}
+
+// WebhookSender posts the payload to the url, returning the status code of the response.
+// WebhookSender must refuse to connect to the addresses that aren't public, see PublicAddress,
+// since the host of a subscription may resolve to another address when the webhook is sent.
+type WebhookSender interface {
+	Send(ctx context.Context, url string, headers map[string]string, payload []byte) (int, error)
+}
+
+// WebhookResolver resolves the hosts of the subscriptions, as the net.Resolver does.
+type WebhookResolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// WebhookService is a TransactionObserver enqueuing the events of the subscriptions,
+// which are delivered by DeliverDue. An event is lost when the process stops between
+// the transaction and the enqueue.
+type WebhookService struct {
+	logger       *slog.Logger
+	repo         WebhookRepository
+	sender       WebhookSender
+	resolver     WebhookResolver
+	allowPrivate bool
+	lease        time.Duration
+	now          func() time.Time
+}
+
+func NewWebhookService(logger *slog.Logger, repo WebhookRepository, sender WebhookSender) *WebhookService {
+	return &WebhookService{
+		logger:   logger,
+		repo:     repo,
+		sender:   sender,
+		resolver: net.DefaultResolver,
+		lease:    defaultDeliveryLease,
+		now:      time.Now,
+	}
+}
+
+// WithLease sets how long a delivery is claimed while it is sent, it must be longer than
+// the timeout of the sender.
+func (s *WebhookService) WithLease(lease time.Duration) *WebhookService {
+	s.lease = lease
+	return s
+}
+
+// WithResolver replaces the resolver of the subscription hosts.
+func (s *WebhookService) WithResolver(resolver WebhookResolver) *WebhookService {
+	s.resolver = resolver
+	return s
+}
+
+// AllowPrivateAddresses accepts the subscriptions to the loopback and the private networks,
+// only meant to try the webhooks locally.
+func (s *WebhookService) AllowPrivateAddresses() *WebhookService {
+	s.allowPrivate = true
+	return s
+}
+
+// PublicAddress rejects the loopback, private, shared, link-local, multicast and unspecified
+// addresses, so a subscription can't reach the database, the admin port or other internal
+// services of the replicas.
+func PublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!thisNetwork.Contains(addr) &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+var (
+	thisNetwork        = netip.MustParsePrefix("0.0.0.0/8")
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+)
+
+// checkAddress resolves the host of the subscription, rejecting it when any of its addresses
+// isn't public. The sender checks the address again when connecting, since it may change.
+func (s *WebhookService) checkAddress(ctx context.Context, rawURL string) error {
+	if s.allowPrivate {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ErrInvalidWebhook
+	}
+
+	addrs := []netip.Addr{}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		addrs = append(addrs, addr)
+	} else {
+		addrs, err = s.resolver.LookupNetIP(ctx, "ip", u.Hostname())
+		if err != nil || len(addrs) == 0 {
+			s.logger.DebugContext(ctx, "webhook host not resolved", "host", u.Hostname(), "error", err)
+			return ErrInvalidWebhook
+		}
+	}
+
+	for _, addr := range addrs {
+		if !PublicAddress(addr) {
+			s.logger.DebugContext(ctx, "webhook host isn't public", "host", u.Hostname(), "address", addr)
+			return ErrInvalidWebhook
+		}
+	}
+
+	return nil
+}
+
+func (s *WebhookService) CreateSubscription(
+	ctx context.Context,
+	clientID int,
+	url string,
+	events []string,
+	threshold *Money,
+) (*WebhookSubscription, error) {
+	subscription, err := NewWebhookSubscription(clientID, url, events, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkAddress(ctx, subscription.URL); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (s *WebhookService) GetSubscriptions(ctx context.Context, clientID int) ([]WebhookSubscription, error) {
+	return s.repo.GetSubscriptions(ctx, clientID)
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, clientID int, subscriptionID int) error {
+	return s.repo.DeleteSubscription(ctx, clientID, subscriptionID)
+}
+
+func (s *WebhookService) GetDeliveries(ctx context.Context, clientID int, subscriptionID int, limit int) ([]WebhookDelivery, error) {
+	if limit < 1 || limit > MaxDeliveriesLimit {
+		return nil, ErrInvalidWebhook
+	}
+
+	return s.repo.GetDeliveries(ctx, clientID, subscriptionID, limit)
+}
+
+// webhookMatch returns the event of the subscription for a transaction, when it has one.
+type webhookMatch func(subscription *WebhookSubscription, now time.Time) (*WebhookEvent, bool)
+
+func (s *WebhookService) TransactionAccepted(ctx context.Context, t *Transaction, client *Client) {
+	s.enqueue(ctx, t.ClientID, []webhookMatch{accepted(t, client)})
+}
+
+func (s *WebhookService) TransactionRejected(ctx context.Context, t *Transaction, err error) {
+	if match, ok := rejected(t, err); ok {
+		s.enqueue(ctx, t.ClientID, []webhookMatch{match})
+	}
+}
+
+// BatchCompleted reads the subscriptions of the client once for the whole batch, and enqueues
+// the deliveries of all its items together.
+func (s *WebhookService) BatchCompleted(ctx context.Context, clientID int, items []BatchItem) {
+	matches := make([]webhookMatch, 0, len(items))
+	for _, item := range items {
+		if item.Err == nil {
+			matches = append(matches, accepted(item.Transaction, item.Client))
+		} else if match, ok := rejected(item.Transaction, item.Err); ok {
+			matches = append(matches, match)
+		}
+	}
+
+	s.enqueue(ctx, clientID, matches)
+}
+
+func accepted(t *Transaction, client *Client) webhookMatch {
+	return func(subscription *WebhookSubscription, now time.Time) (*WebhookEvent, bool) {
+		return subscription.Accepted(t, client, now)
+	}
+}
+
+// rejected only matches the debits over the limit, the other errors have no event.
+func rejected(t *Transaction, err error) (webhookMatch, bool) {
+	if !errors.Is(err, ErrTransactionOverClientLimit) {
+		return nil, false
+	}
+
+	return func(subscription *WebhookSubscription, now time.Time) (*WebhookEvent, bool) {
+		return subscription.Rejected(t, err, now)
+	}, true
+}
+
+func (s *WebhookService) enqueue(ctx context.Context, clientID int, matches []webhookMatch) {
+	if len(matches) == 0 {
+		return
+	}
+
+	subscriptions, err := s.repo.GetSubscriptions(ctx, clientID)
+	if err != nil {
+		LoggerFromContext(ctx, s.logger).ErrorContext(ctx, "failed to get the webhook subscriptions", "clientID", clientID, "error", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	var deliveries []WebhookDelivery
+	for _, match := range matches {
+		for i := range subscriptions {
+			event, ok := match(&subscriptions[i], now)
+			if !ok {
+				continue
+			}
+
+			delivery, err := newWebhookDelivery(&subscriptions[i], event)
+			if err != nil {
+				LoggerFromContext(ctx, s.logger).ErrorContext(ctx, "failed to encode the webhook event", "clientID", clientID, "error", err)
+				continue
+			}
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err := s.repo.EnqueueDeliveries(ctx, deliveries); err != nil {
+		LoggerFromContext(ctx, s.logger).ErrorContext(ctx, "failed to enqueue the webhook deliveries", "clientID", clientID, "error", err)
+	}
+}
+
+// DeliverDue sends up to limit due deliveries and returns how many were attempted. The
+// failures to send are recorded in the delivery, only the repository errors are returned.
+func (s *WebhookService) DeliverDue(ctx context.Context, limit int) (int, error) {
+	for sent := 0; sent < limit; sent++ {
+		ok, err := s.repo.RunNextDelivery(ctx, s.now(), s.lease, s.deliver)
+		if errors.Is(err, ErrDeliveryLeaseExpired) {
+			LoggerFromContext(ctx, s.logger).WarnContext(ctx, "webhook delivery sent after its lease expired", "error", err)
+			continue
+		}
+		if err != nil || !ok {
+			return sent, err
+		}
+	}
+
+	return limit, nil
+}
+
+func (s *WebhookService) deliver(ctx context.Context, d *WebhookDelivery, subscription *WebhookSubscription) error {
+	now := s.now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	headers := map[string]string{
+		"Content-Type":        "application/json",
+		"X-Webhook-Event":     d.Event,
+		"X-Webhook-Delivery":  strconv.Itoa(d.ID),
+		"X-Webhook-Timestamp": timestamp,
+		"X-Webhook-Signature": "sha256=" + SignWebhook(subscription.Secret, timestamp, d.Payload),
+	}
+
+	statusCode, err := s.sender.Send(ctx, subscription.URL, headers, d.Payload)
+	if err != nil || statusCode < 200 || statusCode >= 300 {
+		LoggerFromContext(ctx, s.logger).DebugContext(ctx, "webhook delivery failed", "delivery", d.ID, "status", statusCode, "error", err)
+	}
+
+	// The attempt is recorded when the response arrives, not when the delivery was claimed.
+	d.Complete(s.now(), statusCode, err)
+	return nil
+}
@@ -0,0 +1,359 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeWebhookRepository struct {
+	WebhookRepository
+	subscriptions []WebhookSubscription
+	deliveries    []*WebhookDelivery
+	claims        []time.Time
+	lookups       int
+	enqueues      int
+}
+
+func (r *fakeWebhookRepository) CreateSubscription(ctx context.Context, s *WebhookSubscription) error {
+	s.ID = len(r.subscriptions) + 1
+	r.subscriptions = append(r.subscriptions, *s)
+	return nil
+}
+
+func (r *fakeWebhookRepository) GetSubscriptions(ctx context.Context, clientID int) ([]WebhookSubscription, error) {
+	r.lookups++
+	return r.subscriptions, nil
+}
+
+func (r *fakeWebhookRepository) EnqueueDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	r.enqueues++
+	for i := range deliveries {
+		d := deliveries[i]
+		d.ID = len(r.deliveries) + 1
+		r.deliveries = append(r.deliveries, &d)
+	}
+	return nil
+}
+
+func (r *fakeWebhookRepository) RunNextDelivery(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+	run func(ctx context.Context, d *WebhookDelivery, s *WebhookSubscription) error,
+) (bool, error) {
+	r.claims = append(r.claims, now)
+	for _, d := range r.deliveries {
+		if d.Status != DeliveryPending || d.NextAttemptAt.After(now) {
+			continue
+		}
+
+		claimed := *d
+		if err := run(ctx, &claimed, &r.subscriptions[0]); err != nil {
+			return true, err
+		}
+		*d = claimed
+		return true, nil
+	}
+
+	return false, nil
+}
+
+type fakeWebhookSender struct {
+	statusCode int
+	err        error
+	headers    map[string]string
+	payload    []byte
+}
+
+func (s *fakeWebhookSender) Send(ctx context.Context, url string, headers map[string]string, payload []byte) (int, error) {
+	s.headers = headers
+	s.payload = payload
+	return s.statusCode, s.err
+}
+
+func TestWebhookSubscription_New(t *testing.T) {
+	threshold := Money(0)
+
+	tests := []struct {
+		name          string
+		url           string
+		events        []string
+		threshold     *Money
+		expectedError error
+	}{
+		{"threshold", "https://example.com/hook", []string{EventBalanceThreshold}, &threshold, nil},
+		{"rejected debit", "http://localhost:9999", []string{EventDebitRejected}, nil, nil},
+		{"both events", "http://localhost:9999", []string{EventDebitRejected, EventBalanceThreshold}, &threshold, nil},
+		{"threshold event without threshold", "http://localhost:9999", []string{EventBalanceThreshold}, nil, ErrInvalidWebhook},
+		{"threshold without threshold event", "http://localhost:9999", []string{EventDebitRejected}, &threshold, ErrInvalidWebhook},
+		{"unknown event", "http://localhost:9999", []string{"saldo"}, nil, ErrInvalidWebhook},
+		{"no events", "http://localhost:9999", nil, nil, ErrInvalidWebhook},
+		{"invalid scheme", "ftp://localhost:9999", []string{EventDebitRejected}, nil, ErrInvalidWebhook},
+		{"no host", "http:///hook", []string{EventDebitRejected}, nil, ErrInvalidWebhook},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewWebhookSubscription(1, tt.url, tt.events, tt.threshold)
+			assert.ErrorIs(t, err, tt.expectedError)
+			if tt.expectedError != nil {
+				return
+			}
+
+			assert.Len(t, s.Secret, 64)
+		})
+	}
+}
+
+func TestWebhookSubscription_Accepted(t *testing.T) {
+	now := time.Date(2024, 9, 13, 10, 30, 0, 0, time.UTC)
+	threshold := Money(0)
+	s, _ := NewWebhookSubscription(1, "http://localhost:9999", []string{EventBalanceThreshold}, &threshold)
+
+	tests := []struct {
+		name              string
+		kind              string
+		amount            Money
+		balance           Money
+		expected          bool
+		expectedDirection string
+	}{
+		{"crosses below", "d", 100, -50, true, "abaixo"},
+		{"crosses above", "c", 100, 50, true, "acima"},
+		{"reaches the threshold", "c", 50, 0, true, "acima"},
+		{"stays above", "d", 10, 50, false, ""},
+		{"stays below", "d", 10, -50, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := &Transaction{ClientID: 1, Amount: tt.amount, Kind: tt.kind, Description: "teste"}
+			event, ok := s.Accepted(transaction, &Client{ID: 1, Balance: tt.balance}, now)
+			assert.Equal(t, tt.expected, ok)
+			if !ok {
+				return
+			}
+
+			assert.Equal(t, tt.expectedDirection, event.Direction)
+			assert.Equal(t, tt.balance, *event.Balance)
+		})
+	}
+}
+
+func TestWebhookSubscription_Rejected(t *testing.T) {
+	now := time.Date(2024, 9, 13, 10, 30, 0, 0, time.UTC)
+	s, _ := NewWebhookSubscription(1, "http://localhost:9999", []string{EventDebitRejected}, nil)
+	debit := &Transaction{ClientID: 1, Amount: 100, Kind: "d", Description: "teste"}
+
+	_, ok := s.Rejected(debit, ErrTransactionOverClientLimit, now)
+	assert.True(t, ok)
+
+	_, ok = s.Rejected(debit, ErrClientDoesntExist, now)
+	assert.False(t, ok)
+}
+
+func TestWebhookDelivery_Complete(t *testing.T) {
+	now := time.Date(2024, 9, 13, 10, 30, 0, 0, time.UTC)
+
+	t.Run("delivered", func(t *testing.T) {
+		d := &WebhookDelivery{Status: DeliveryPending}
+		d.Complete(now, 204, nil)
+
+		assert.Equal(t, DeliveryDelivered, d.Status)
+		assert.Equal(t, now, d.DeliveredAt)
+	})
+
+	t.Run("retried with backoff", func(t *testing.T) {
+		d := &WebhookDelivery{Status: DeliveryPending}
+		d.Complete(now, 500, nil)
+		assert.Equal(t, now.Add(time.Second*5), d.NextAttemptAt)
+
+		d.Complete(now, 0, errors.New("connection refused"))
+		assert.Equal(t, now.Add(time.Second*10), d.NextAttemptAt)
+		assert.Equal(t, DeliveryPending, d.Status)
+		assert.Equal(t, "connection refused", d.LastError)
+	})
+
+	t.Run("fails after the last attempt", func(t *testing.T) {
+		d := &WebhookDelivery{Status: DeliveryPending, Attempts: MaxDeliveryAttempts - 1}
+		d.Complete(now, 500, nil)
+
+		assert.Equal(t, DeliveryFailed, d.Status)
+	})
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	payload := []byte(`{"evento":"debito_recusado"}`)
+	signature := "sha256=" + SignWebhook("segredo", "1726223400", payload)
+
+	assert.True(t, VerifyWebhook("segredo", "1726223400", payload, signature))
+	assert.False(t, VerifyWebhook("segredo", "1726223401", payload, signature))
+	assert.False(t, VerifyWebhook("outro", "1726223400", payload, signature))
+}
+
+func TestWebhookService_DeliverDue(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+	threshold := Money(0)
+
+	subscription, _ := NewWebhookSubscription(1, "http://localhost:9999", []string{EventBalanceThreshold}, &threshold)
+	repo := &fakeWebhookRepository{subscriptions: []WebhookSubscription{*subscription}}
+	sender := &fakeWebhookSender{statusCode: 200}
+	svc := NewWebhookService(logger, repo, sender)
+
+	clients := NewClientRepository(logger, &fakeClientRepository{}).WithObserver(svc)
+	_, err := clients.CreateTransaction(ctx, &Transaction{ClientID: 1, Amount: 10, Kind: "c", Description: "teste"})
+	assert.NoError(t, err)
+	assert.Len(t, repo.deliveries, 1)
+
+	sent, err := svc.DeliverDue(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, DeliveryDelivered, repo.deliveries[0].Status)
+
+	timestamp := sender.headers["X-Webhook-Timestamp"]
+	assert.True(t, VerifyWebhook(subscription.Secret, timestamp, sender.payload, sender.headers["X-Webhook-Signature"]))
+
+	t.Run("the time is taken for each delivery", func(t *testing.T) {
+		start := time.Now()
+		clock := start
+		svc.now = func() time.Time {
+			clock = clock.Add(time.Second)
+			return clock
+		}
+		repo.claims = nil
+		sender.statusCode = 500
+
+		_, err := clients.CreateTransaction(ctx, &Transaction{ClientID: 1, Amount: 10, Kind: "c", Description: "teste"})
+		assert.NoError(t, err)
+		_, err = clients.CreateTransaction(ctx, &Transaction{ClientID: 1, Amount: 10, Kind: "c", Description: "teste"})
+		assert.NoError(t, err)
+
+		sent, err := svc.DeliverDue(ctx, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, sent)
+		assert.Len(t, repo.claims, 2)
+		assert.True(t, repo.claims[1].After(repo.claims[0]))
+
+		// The clock is read on the claim, the request and the response of each delivery,
+		// and the retry is scheduled from the response.
+		assert.WithinDuration(t, start.Add(3*time.Second+deliveryBackoff), repo.deliveries[1].NextAttemptAt, 0)
+		assert.WithinDuration(t, start.Add(6*time.Second+deliveryBackoff), repo.deliveries[2].NextAttemptAt, 0)
+	})
+}
+
+func TestWebhookService_BatchCompleted(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+	threshold := Money(0)
+
+	subscription, _ := NewWebhookSubscription(1, "http://localhost:9999", []string{EventBalanceThreshold, EventDebitRejected}, &threshold)
+	repo := &fakeWebhookRepository{subscriptions: []WebhookSubscription{*subscription}}
+	svc := NewWebhookService(logger, repo, &fakeWebhookSender{})
+	clients := NewClientRepository(logger, &fakeClientRepository{}).WithObserver(svc)
+
+	items := []BatchItem{
+		{Transaction: &Transaction{ClientID: 1, Amount: 100, Kind: "d", Description: "abaixo"}},
+		{Transaction: &Transaction{ClientID: 1, Amount: 10, Kind: "d", Description: "segue"}},
+		{Transaction: &Transaction{ClientID: 1, Amount: 5000, Kind: "d", Description: "recusado"}},
+		{Transaction: &Transaction{ClientID: 1, Amount: 200, Kind: "c", Description: "acima"}},
+	}
+	assert.NoError(t, clients.CreateTransactions(ctx, 1, items, false))
+
+	assert.Equal(t, 1, repo.lookups, "subscriptions read once per batch")
+	assert.Equal(t, 1, repo.enqueues, "deliveries enqueued together")
+	if assert.Len(t, repo.deliveries, 3) {
+		assert.Equal(t, EventBalanceThreshold, repo.deliveries[0].Event)
+		assert.Equal(t, EventDebitRejected, repo.deliveries[1].Event)
+		assert.Equal(t, EventBalanceThreshold, repo.deliveries[2].Event)
+	}
+
+	t.Run("batch without events doesn't read the subscriptions", func(t *testing.T) {
+		repo.lookups = 0
+		items := []BatchItem{{Transaction: &Transaction{ClientID: 1, Amount: 10, Kind: "x", Description: "teste"}, Err: ErrInvalidTransaction}}
+		assert.NoError(t, clients.CreateTransactions(ctx, 1, items, false))
+		assert.Equal(t, 0, repo.lookups)
+	})
+}
+
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	values, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+
+	var addrs []netip.Addr
+	for _, value := range values {
+		addrs = append(addrs, netip.MustParseAddr(value))
+	}
+	return addrs, nil
+}
+
+func TestPublicAddress(t *testing.T) {
+	for _, addr := range []string{"93.184.215.14", "2606:2800:21f:cb07:6820:80da:af6b:8b2c", "8.8.8.8"} {
+		assert.True(t, PublicAddress(netip.MustParseAddr(addr)), addr)
+	}
+
+	for _, addr := range []string{
+		"127.0.0.1", "::1", "10.0.0.1", "172.16.0.1", "192.168.1.1", "169.254.169.254", "fe80::1",
+		"fc00::1", "0.0.0.0", "::", "0.1.2.3", "100.64.0.1", "224.0.0.1", "::ffff:127.0.0.1",
+	} {
+		assert.False(t, PublicAddress(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestWebhookService_CreateSubscription(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+	resolver := fakeResolver{
+		"example.com":          {"93.184.215.14"},
+		"internal.example":     {"10.0.0.5"},
+		"rebinding.example":    {"93.184.215.14", "127.0.0.1"},
+		"postgres-db":          {"172.18.0.2"},
+		"metadata.internal":    {"169.254.169.254"},
+		"localhost":            {"127.0.0.1", "::1"},
+		"host.docker.internal": {"192.168.65.254"},
+	}
+
+	tests := []struct {
+		url           string
+		expectedError error
+	}{
+		{"https://example.com/hook", nil},
+		{"http://93.184.215.14:8080/hook", nil},
+		{"http://127.0.0.1:6060/debug/pprof/profile", ErrInvalidWebhook},
+		{"http://[::1]:6060/", ErrInvalidWebhook},
+		{"http://localhost:6060/", ErrInvalidWebhook},
+		{"http://internal.example/", ErrInvalidWebhook},
+		{"http://rebinding.example/", ErrInvalidWebhook},
+		{"http://postgres-db:5432/", ErrInvalidWebhook},
+		{"http://metadata.internal/latest/meta-data", ErrInvalidWebhook},
+		{"http://0.0.0.0:8080/", ErrInvalidWebhook},
+		{"http://unknown.example/", ErrInvalidWebhook},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			svc := NewWebhookService(logger, &fakeWebhookRepository{}, &fakeWebhookSender{}).WithResolver(resolver)
+
+			_, err := svc.CreateSubscription(ctx, 1, tt.url, []string{EventDebitRejected}, nil)
+			assert.ErrorIs(t, err, tt.expectedError)
+		})
+	}
+
+	t.Run("private addresses when allowed", func(t *testing.T) {
+		svc := NewWebhookService(logger, &fakeWebhookRepository{}, &fakeWebhookSender{}).WithResolver(resolver).AllowPrivateAddresses()
+
+		_, err := svc.CreateSubscription(ctx, 1, "http://host.docker.internal:9090", []string{EventDebitRejected}, nil)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const invalidationChannel = "statement_invalidation"
+
+// PostgresNotifier broadcasts the invalidations with NOTIFY and evicts the statements
+// of this replica when receiving them with LISTEN, so the writes of any replica
+// invalidate the statements cached in all of them.
+type PostgresNotifier struct {
+	logger *slog.Logger
+	db     *pgxpool.Pool
+}
+
+func NewPostgresNotifier(logger *slog.Logger, db *pgxpool.Pool) *PostgresNotifier {
+	return &PostgresNotifier{logger: logger, db: db}
+}
+
+// Publish sends the client id and the version separated by a colon.
+func (n *PostgresNotifier) Publish(ctx context.Context, clientID int, version int64) error {
+	payload := strconv.Itoa(clientID) + ":" + strconv.FormatInt(version, 10)
+	_, err := n.db.Exec(ctx, `SELECT pg_notify($1, $2);`, invalidationChannel, payload)
+	return err
+}
+
+// Listen blocks until the context is done, reconnecting when the connection is lost.
+// Given the notifications can be lost while reconnecting, the cache is cleared on every connection.
+func (n *PostgresNotifier) Listen(ctx context.Context, cache *StatementCache) {
+	for ctx.Err() == nil {
+		if err := n.listen(ctx, cache); err != nil && ctx.Err() == nil {
+			n.logger.Error("failed to listen the statement invalidations", "error", err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func (n *PostgresNotifier) listen(ctx context.Context, cache *StatementCache) error {
+	conn, err := n.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+invalidationChannel+";"); err != nil {
+		return err
+	}
+	cache.EvictAll()
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			conn.Conn().Close(context.Background())
+			return err
+		}
+
+		clientID, version, err := parseInvalidation(notification.Payload)
+		if err != nil {
+			n.logger.DebugContext(ctx, "invalid statement invalidation", "payload", notification.Payload)
+			continue
+		}
+
+		cache.Evict(clientID, version)
+	}
+}
+
+func parseInvalidation(payload string) (int, int64, error) {
+	id, version, _ := strings.Cut(payload, ":")
+	clientID, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	v, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return clientID, v, nil
+}
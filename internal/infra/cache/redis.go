@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// replaceScript writes the entry of KEYS[1] unless it has a newer version, comparing both in
+// Redis so the replicas can't interleave. ARGV holds the version, the statement, empty for an
+// invalidation, and the ttl in milliseconds. It follows the rule of the local entries, where
+// a statement of the same version replaces an invalidation.
+var replaceScript = redis.NewScript(`
+local current = redis.call('HMGET', KEYS[1], 'version', 'statement')
+if current[1] then
+	local version = tonumber(current[1])
+	local next = tonumber(ARGV[1])
+	if version > next then
+		return 0
+	end
+	if version == next and (ARGV[2] == '' or current[2] ~= '') then
+		return 0
+	end
+end
+redis.call('HSET', KEYS[1], 'version', ARGV[1], 'statement', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// RedisCache is the shared backend of the statements cache, each entry is a hash with the
+// version of the client and the statement, empty when invalidated.
+type RedisCache struct {
+	client *redis.Client
+}
+
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+func (r *RedisCache) Get(ctx context.Context, clientID int) (*domain.Statement, bool, error) {
+	content, err := r.client.HGet(ctx, r.key(clientID), "statement").Bytes()
+	if err == redis.Nil || (err == nil && len(content) == 0) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	statement := &domain.Statement{}
+	if err := json.Unmarshal(content, statement); err != nil {
+		return nil, false, err
+	}
+
+	return statement, true, nil
+}
+
+func (r *RedisCache) Set(ctx context.Context, clientID int, s *domain.Statement, ttl time.Duration) error {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return r.replace(ctx, clientID, s.Client.Version, string(content), ttl)
+}
+
+func (r *RedisCache) Invalidate(ctx context.Context, clientID int, version int64, ttl time.Duration) error {
+	return r.replace(ctx, clientID, version, "", ttl)
+}
+
+func (r *RedisCache) replace(ctx context.Context, clientID int, version int64, statement string, ttl time.Duration) error {
+	keys := []string{r.key(clientID)}
+	return replaceScript.Run(ctx, r.client, keys, version, statement, ttl.Milliseconds()).Err()
+}
+
+// key changed with the versioned entries, so the statements cached before aren't read.
+func (r *RedisCache) key(clientID int) string {
+	return "statement:v2:" + strconv.Itoa(clientID)
+}
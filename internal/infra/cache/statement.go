@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+)
+
+// Shared is a cache backend shared by all the API replicas. It keeps the version of the client
+// of each entry, and only replaces an entry by a newer one, so a replica can't overwrite the
+// statement or the invalidation written by another one with an older statement.
+type Shared interface {
+	Get(ctx context.Context, clientID int) (*domain.Statement, bool, error)
+	// Set saves the statement unless the entry has a newer version of the client.
+	Set(ctx context.Context, clientID int, s *domain.Statement, ttl time.Duration) error
+	// Invalidate replaces the statement by a marker of the version, unless the entry is newer.
+	Invalidate(ctx context.Context, clientID int, version int64, ttl time.Duration) error
+}
+
+// Versions reads the version of the client from the database, which every replica writes to
+// before answering, unlike the invalidations that reach the other replicas asynchronously.
+type Versions interface {
+	GetClientVersion(ctx context.Context, clientID int) (int64, error)
+}
+
+// Publisher broadcasts the invalidation of a client's statement to the other replicas.
+type Publisher interface {
+	Publish(ctx context.Context, clientID int, version int64) error
+}
+
+// StatementCache is an in-process LRU cache of statements bounded by size and TTL,
+// optionally backed by a shared cache and broadcasting the invalidations. An invalidation
+// is kept in the LRU as an entry without statement, holding the version of the client, so
+// the statements read before it are refused until it expires or is evicted. With the versions,
+// a cached statement is only served while it has the version of the client in the database, so
+// a write in another replica is seen before its invalidation arrives.
+type StatementCache struct {
+	logger    *slog.Logger
+	size      int
+	ttl       time.Duration
+	shared    Shared
+	publisher Publisher
+	versions  Versions
+
+	mu      sync.Mutex
+	entries map[int]*list.Element
+	order   *list.List
+	epoch   uint64
+}
+
+type entry struct {
+	clientID  int
+	version   int64
+	statement *domain.Statement
+	expiresAt time.Time
+}
+
+// replacedBy tells whether the entry is older than the statement, or the invalidation when the
+// statement is nil. A statement of the same version replaces an invalidation, since it was read
+// after the change.
+func (e *entry) replacedBy(version int64, statement *domain.Statement) bool {
+	if time.Now().After(e.expiresAt) {
+		return true
+	}
+	if statement != nil && e.statement == nil {
+		return version >= e.version
+	}
+	return version > e.version
+}
+
+// NewStatementCache creates the cache, the shared backend, the publisher and the versions are optional.
+func NewStatementCache(logger *slog.Logger, size int, ttl time.Duration, shared Shared, publisher Publisher, versions Versions) *StatementCache {
+	return &StatementCache{
+		logger:    logger,
+		size:      size,
+		ttl:       ttl,
+		shared:    shared,
+		publisher: publisher,
+		versions:  versions,
+		entries:   map[int]*list.Element{},
+		order:     list.New(),
+	}
+}
+
+func (c *StatementCache) Get(ctx context.Context, clientID int) (*domain.Statement, uint64, bool) {
+	c.mu.Lock()
+	epoch := c.epoch
+	var local *domain.Statement
+	if e, ok := c.entries[clientID]; ok {
+		cached := e.Value.(*entry)
+		if cached.statement != nil && time.Now().Before(cached.expiresAt) {
+			c.order.MoveToFront(e)
+			local = cached.statement
+		}
+	}
+	c.mu.Unlock()
+
+	if local != nil {
+		// A local statement older than the database is a miss, without looking for a newer one
+		// in the shared cache, it's read again from the database and replaces this one.
+		if !c.current(ctx, clientID, local) {
+			return nil, epoch, false
+		}
+		return local, epoch, true
+	}
+
+	if c.shared == nil {
+		return nil, epoch, false
+	}
+
+	statement, ok, err := c.shared.Get(ctx, clientID)
+	if err != nil {
+		domain.LoggerFromContext(ctx, c.logger).DebugContext(ctx, "failed to get the statement from the shared cache", "clientID", clientID, "error", err)
+		return nil, epoch, false
+	}
+	if !ok || !c.current(ctx, clientID, statement) {
+		return nil, epoch, false
+	}
+
+	if !c.setLocal(clientID, epoch, statement.Client.Version, statement) {
+		// An invalidation arrived while it was read, the shared statement may be older than it.
+		return nil, epoch, false
+	}
+	return statement, epoch, true
+}
+
+// current tells whether the statement has the version of the client in the database, it is
+// always the case without the versions.
+func (c *StatementCache) current(ctx context.Context, clientID int, s *domain.Statement) bool {
+	if c.versions == nil {
+		return true
+	}
+
+	version, err := c.versions.GetClientVersion(ctx, clientID)
+	if err != nil {
+		domain.LoggerFromContext(ctx, c.logger).DebugContext(ctx, "failed to get the version of the client", "clientID", clientID, "error", err)
+		return false
+	}
+	return s.Client.Version >= version
+}
+
+func (c *StatementCache) Set(ctx context.Context, clientID int, epoch uint64, s *domain.Statement) {
+	if !c.setLocal(clientID, epoch, s.Client.Version, s) || c.shared == nil {
+		return
+	}
+
+	if err := c.shared.Set(ctx, clientID, s, c.ttl); err != nil {
+		domain.LoggerFromContext(ctx, c.logger).DebugContext(ctx, "failed to set the statement in the shared cache", "clientID", clientID, "error", err)
+	}
+}
+
+// Invalidate refuses the statements older than the version in this replica and the shared
+// cache, then notifies the other replicas.
+func (c *StatementCache) Invalidate(ctx context.Context, clientID int, version int64) {
+	c.Evict(clientID, version)
+
+	if c.shared != nil {
+		if err := c.shared.Invalidate(ctx, clientID, version, c.ttl); err != nil {
+			domain.LoggerFromContext(ctx, c.logger).ErrorContext(ctx, "failed to invalidate the statement in the shared cache", "clientID", clientID, "error", err)
+		}
+	}
+
+	if c.publisher != nil {
+		if err := c.publisher.Publish(ctx, clientID, version); err != nil {
+			domain.LoggerFromContext(ctx, c.logger).ErrorContext(ctx, "failed to publish the statement invalidation", "clientID", clientID, "error", err)
+		}
+	}
+}
+
+// Evict invalidates the statement only in this replica, it is used when receiving the
+// invalidations from the other replicas.
+func (c *StatementCache) Evict(clientID int, version int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.put(clientID, version, nil)
+}
+
+// EvictAll clears the cache, and refuses the statements being read, when the invalidations
+// may have been lost.
+func (c *StatementCache) EvictAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	c.entries = map[int]*list.Element{}
+	c.order.Init()
+}
+
+func (c *StatementCache) setLocal(clientID int, epoch uint64, version int64, s *domain.Statement) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.epoch != epoch {
+		return false
+	}
+	return c.put(clientID, version, s)
+}
+
+// put replaces the entry of the client when it is older, the invalidations and the statements
+// are evicted alike when the cache is full.
+func (c *StatementCache) put(clientID int, version int64, s *domain.Statement) bool {
+	if e, ok := c.entries[clientID]; ok {
+		if !e.Value.(*entry).replacedBy(version, s) {
+			return false
+		}
+		c.remove(e)
+	}
+
+	c.entries[clientID] = c.order.PushFront(&entry{
+		clientID:  clientID,
+		version:   version,
+		statement: s,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+
+	return true
+}
+
+func (c *StatementCache) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*entry).clientID)
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePublisher struct {
+	published []string
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, clientID int, version int64) error {
+	p.published = append(p.published, fmt.Sprintf("%d:%d", clientID, version))
+	return nil
+}
+
+type fakeShared struct {
+	statements    map[int]*domain.Statement
+	invalidations map[int]int64
+}
+
+func (s *fakeShared) Get(ctx context.Context, clientID int) (*domain.Statement, bool, error) {
+	statement, ok := s.statements[clientID]
+	return statement, ok, nil
+}
+
+func (s *fakeShared) Set(ctx context.Context, clientID int, statement *domain.Statement, ttl time.Duration) error {
+	s.statements[clientID] = statement
+	return nil
+}
+
+func (s *fakeShared) Invalidate(ctx context.Context, clientID int, version int64, ttl time.Duration) error {
+	s.invalidations[clientID] = version
+	return nil
+}
+
+type fakeVersions map[int]int64
+
+func (v fakeVersions) GetClientVersion(ctx context.Context, clientID int) (int64, error) {
+	return v[clientID], nil
+}
+
+func statementAt(version int64) *domain.Statement {
+	return &domain.Statement{Client: &domain.Client{ID: 1, Limit: 1000, Balance: 10, Version: version}}
+}
+
+func TestStatementCache(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+	statement := statementAt(0)
+
+	t.Run("read through", func(t *testing.T) {
+		c := NewStatementCache(logger, 10, time.Minute, nil, nil, nil)
+
+		_, epoch, ok := c.Get(ctx, 1)
+		assert.False(t, ok)
+
+		c.Set(ctx, 1, epoch, statement)
+		cached, _, ok := c.Get(ctx, 1)
+		assert.True(t, ok)
+		assert.Equal(t, statement, cached)
+	})
+
+	t.Run("statement read before the invalidation is not cached", func(t *testing.T) {
+		publisher := &fakePublisher{}
+		c := NewStatementCache(logger, 10, time.Minute, nil, publisher, nil)
+
+		_, epoch, _ := c.Get(ctx, 1)
+		c.Invalidate(ctx, 1, 1)
+		c.Set(ctx, 1, epoch, statement)
+
+		_, _, ok := c.Get(ctx, 1)
+		assert.False(t, ok)
+		assert.Equal(t, []string{"1:1"}, publisher.published)
+
+		c.Set(ctx, 1, epoch, statementAt(1))
+		cached, _, ok := c.Get(ctx, 1)
+		assert.True(t, ok, "read after the change")
+		assert.Equal(t, int64(1), cached.Client.Version)
+	})
+
+	t.Run("statement isn't replaced by an older one", func(t *testing.T) {
+		c := NewStatementCache(logger, 10, time.Minute, nil, nil, nil)
+
+		_, epoch, _ := c.Get(ctx, 1)
+		c.Set(ctx, 1, epoch, statementAt(3))
+		c.Set(ctx, 1, epoch, statementAt(2))
+		c.Evict(1, 2)
+
+		cached, _, ok := c.Get(ctx, 1)
+		assert.True(t, ok)
+		assert.Equal(t, int64(3), cached.Client.Version)
+	})
+
+	t.Run("shared statement older than an invalidation is not read", func(t *testing.T) {
+		shared := &fakeShared{statements: map[int]*domain.Statement{}, invalidations: map[int]int64{}}
+		c := NewStatementCache(logger, 10, time.Minute, shared, nil, nil)
+
+		c.Invalidate(ctx, 1, 5)
+		assert.Equal(t, int64(5), shared.invalidations[1])
+
+		shared.statements[1] = statementAt(4)
+		_, _, ok := c.Get(ctx, 1)
+		assert.False(t, ok)
+
+		shared.statements[1] = statementAt(5)
+		_, _, ok = c.Get(ctx, 1)
+		assert.True(t, ok)
+	})
+
+	t.Run("statement older than the database is not served", func(t *testing.T) {
+		shared := &fakeShared{statements: map[int]*domain.Statement{}, invalidations: map[int]int64{}}
+		versions := fakeVersions{1: 1}
+		c := NewStatementCache(logger, 10, time.Minute, shared, nil, versions)
+
+		_, epoch, _ := c.Get(ctx, 1)
+		c.Set(ctx, 1, epoch, statementAt(1))
+		_, _, ok := c.Get(ctx, 1)
+		assert.True(t, ok)
+
+		// Written in another replica, whose invalidation hasn't arrived yet.
+		versions[1] = 2
+		_, epoch, ok = c.Get(ctx, 1)
+		assert.False(t, ok, "local statement")
+
+		shared.statements[1] = statementAt(1)
+		c.EvictAll()
+		_, epoch, ok = c.Get(ctx, 1)
+		assert.False(t, ok, "shared statement")
+
+		c.Set(ctx, 1, epoch, statementAt(2))
+		cached, _, ok := c.Get(ctx, 1)
+		assert.True(t, ok)
+		assert.Equal(t, int64(2), cached.Client.Version)
+	})
+
+	t.Run("statement read before evicting all is not cached", func(t *testing.T) {
+		c := NewStatementCache(logger, 10, time.Minute, nil, nil, nil)
+
+		_, epoch, _ := c.Get(ctx, 1)
+		c.EvictAll()
+		c.Set(ctx, 1, epoch, statement)
+
+		_, _, ok := c.Get(ctx, 1)
+		assert.False(t, ok)
+	})
+
+	t.Run("least recently used statement is evicted", func(t *testing.T) {
+		c := NewStatementCache(logger, 2, time.Minute, nil, nil, nil)
+
+		for clientID := 1; clientID <= 3; clientID++ {
+			_, epoch, _ := c.Get(ctx, clientID)
+			c.Set(ctx, clientID, epoch, statement)
+		}
+
+		_, _, ok := c.Get(ctx, 1)
+		assert.False(t, ok)
+		_, _, ok = c.Get(ctx, 3)
+		assert.True(t, ok)
+	})
+
+	t.Run("invalidations are evicted like the statements", func(t *testing.T) {
+		c := NewStatementCache(logger, 2, time.Minute, nil, nil, nil)
+
+		for clientID := 1; clientID <= 1000; clientID++ {
+			c.Evict(clientID, 1)
+		}
+
+		assert.Len(t, c.entries, 2)
+		assert.Equal(t, 2, c.order.Len())
+	})
+
+	t.Run("expired statement", func(t *testing.T) {
+		c := NewStatementCache(logger, 10, time.Millisecond, nil, nil, nil)
+
+		_, epoch, _ := c.Get(ctx, 1)
+		c.Set(ctx, 1, epoch, statement)
+		time.Sleep(time.Millisecond * 5)
+
+		_, _, ok := c.Get(ctx, 1)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,95 @@
+package events
+
+import (
+	"log/slog"
+	"sync"
+
+	"rinha-with-go-2024/internal/domain"
+)
+
+// Hub fans out the events of this replica to its subscribers. Each subscriber has a
+// bounded buffer, and one falling behind is dropped instead of slowing down the others.
+type Hub struct {
+	logger      *slog.Logger
+	bufferSize  int
+	mu          sync.Mutex
+	subscribers map[int]map[chan domain.TransactionEvent]struct{}
+}
+
+func NewHub(logger *slog.Logger, bufferSize int) *Hub {
+	return &Hub{
+		logger:      logger,
+		bufferSize:  bufferSize,
+		subscribers: map[int]map[chan domain.TransactionEvent]struct{}{},
+	}
+}
+
+func (h *Hub) Subscribe(clientID int) (<-chan domain.TransactionEvent, func()) {
+	events := make(chan domain.TransactionEvent, h.bufferSize)
+
+	h.mu.Lock()
+	if h.subscribers[clientID] == nil {
+		h.subscribers[clientID] = map[chan domain.TransactionEvent]struct{}{}
+	}
+	h.subscribers[clientID][events] = struct{}{}
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(clientID, events)
+	}
+
+	return events, unsubscribe
+}
+
+// Dispatch never blocks, since it runs in the single listener of the replica.
+func (h *Hub) Dispatch(e domain.TransactionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for events := range h.subscribers[e.ClientID] {
+		select {
+		case events <- e:
+		default:
+			h.logger.Debug("dropping slow event subscriber", "clientID", e.ClientID, "event", e.ID)
+			h.remove(e.ClientID, events)
+		}
+	}
+}
+
+// DropAll closes every subscription, used when the events may have been lost.
+func (h *Hub) DropAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for clientID, subscribers := range h.subscribers {
+		for events := range subscribers {
+			h.remove(clientID, events)
+		}
+	}
+}
+
+// remove closes the channel only once, whether the subscriber was dropped or unsubscribed.
+func (h *Hub) remove(clientID int, events chan domain.TransactionEvent) {
+	if _, ok := h.subscribers[clientID][events]; !ok {
+		return
+	}
+
+	delete(h.subscribers[clientID], events)
+	if len(h.subscribers[clientID]) == 0 {
+		delete(h.subscribers, clientID)
+	}
+	close(events)
+}
+
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := 0
+	for _, subscribers := range h.subscribers {
+		count += len(subscribers)
+	}
+	return count
+}
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("dispatches to the subscribers of the client", func(t *testing.T) {
+		h := NewHub(logger, 10)
+		first, unsubscribeFirst := h.Subscribe(1)
+		second, unsubscribeSecond := h.Subscribe(1)
+		other, unsubscribeOther := h.Subscribe(2)
+		defer unsubscribeFirst()
+		defer unsubscribeSecond()
+		defer unsubscribeOther()
+
+		h.Dispatch(domain.TransactionEvent{ID: 1, ClientID: 1})
+
+		assert.Equal(t, 1, (<-first).ID)
+		assert.Equal(t, 1, (<-second).ID)
+		assert.Len(t, other, 0)
+	})
+
+	t.Run("drops the subscriber over its buffer", func(t *testing.T) {
+		h := NewHub(logger, 2)
+		events, unsubscribe := h.Subscribe(1)
+
+		for id := 1; id <= 3; id++ {
+			h.Dispatch(domain.TransactionEvent{ID: id, ClientID: 1})
+		}
+
+		var received []int
+		for e := range events {
+			received = append(received, e.ID)
+		}
+		assert.Equal(t, []int{1, 2}, received)
+		assert.Equal(t, 0, h.Subscribers())
+
+		unsubscribe()
+	})
+
+	t.Run("drops every subscriber", func(t *testing.T) {
+		h := NewHub(logger, 2)
+		events, unsubscribe := h.Subscribe(1)
+		h.DropAll()
+
+		_, ok := <-events
+		assert.False(t, ok)
+
+		unsubscribe()
+		assert.Equal(t, 0, h.Subscribers())
+	})
+}
@@ -0,0 +1,76 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const eventsChannel = "transaction_events"
+
+// PostgresNotifier broadcasts the events with NOTIFY and dispatches the ones received with
+// LISTEN to the hub of this replica, so the subscribers of any replica get the events of both.
+type PostgresNotifier struct {
+	logger *slog.Logger
+	db     *pgxpool.Pool
+}
+
+func NewPostgresNotifier(logger *slog.Logger, db *pgxpool.Pool) *PostgresNotifier {
+	return &PostgresNotifier{logger: logger, db: db}
+}
+
+func (n *PostgresNotifier) Publish(ctx context.Context, e *domain.TransactionEvent) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.db.Exec(ctx, `SELECT pg_notify($1, $2);`, eventsChannel, string(payload))
+	return err
+}
+
+// Listen blocks until the context is done, reconnecting when the connection is lost. Given the
+// notifications can be lost while reconnecting, the subscribers are dropped on every connection,
+// so they resume from their last event.
+func (n *PostgresNotifier) Listen(ctx context.Context, hub *Hub) {
+	for ctx.Err() == nil {
+		if err := n.listen(ctx, hub); err != nil && ctx.Err() == nil {
+			n.logger.Error("failed to listen the transaction events", "error", err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func (n *PostgresNotifier) listen(ctx context.Context, hub *Hub) error {
+	conn, err := n.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+eventsChannel+";"); err != nil {
+		return err
+	}
+	hub.DropAll()
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			conn.Conn().Close(context.Background())
+			return err
+		}
+
+		var e domain.TransactionEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &e); err != nil {
+			n.logger.DebugContext(ctx, "invalid transaction event", "payload", notification.Payload)
+			continue
+		}
+
+		hub.Dispatch(e)
+	}
+}
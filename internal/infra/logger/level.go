@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+var ErrInvalidSample = errors.New("the sample must be between 0 and 1")
+
+// Level is the level of the logger, changed at runtime, and the fraction of the debug lines
+// kept, so DEBUG can be left on for a while without logging every request.
+type Level struct {
+	level  slog.LevelVar
+	sample atomic.Uint64
+}
+
+func NewLevel(level string, sample float64) (*Level, error) {
+	l := &Level{}
+	l.level.Set(getLogLevel(level))
+	if err := l.SetSample(sample); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Level) Level() slog.Level {
+	return l.level.Level()
+}
+
+func (l *Level) Set(level slog.Level) {
+	l.level.Set(level)
+}
+
+func (l *Level) Sample() float64 {
+	return math.Float64frombits(l.sample.Load())
+}
+
+func (l *Level) SetSample(sample float64) error {
+	if !(sample >= 0 && sample <= 1) {
+		return ErrInvalidSample
+	}
+
+	l.sample.Store(math.Float64bits(sample))
+	return nil
+}
+
+type debugKey struct{}
+
+// WithDebug logs every line with the returned context, whatever the level and the sample.
+func WithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugKey{}, true)
+}
+
+// sampledHandler decides in Enabled, so the lines dropped don't even build their records.
+type sampledHandler struct {
+	slog.Handler
+	level *Level
+}
+
+func (h *sampledHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if ctx != nil && ctx.Value(debugKey{}) != nil {
+		return true
+	}
+	if level < h.level.Level() {
+		return false
+	}
+	if level >= slog.LevelInfo {
+		return true
+	}
+
+	sample := h.level.Sample()
+	return sample >= 1 || rand.Float64() < sample
+}
+
+func (h *sampledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sampledHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *sampledHandler) WithGroup(name string) slog.Handler {
+	return &sampledHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
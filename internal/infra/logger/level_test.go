@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func initializeLogger(t *testing.T, level string, sample float64) (*slog.Logger, *Level, *bytes.Buffer) {
+	l, err := NewLevel(level, sample)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	return slog.New(NewHandler(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}), l)), l, &out
+}
+
+func lines(out *bytes.Buffer) int {
+	n := strings.Count(out.String(), "\n")
+	out.Reset()
+	return n
+}
+
+func TestLevel(t *testing.T) {
+	logger, level, out := initializeLogger(t, "INFO", 1)
+
+	logger.Debug("dropped")
+	logger.Info("kept")
+	assert.Equal(t, 1, lines(out))
+
+	level.Set(slog.LevelDebug)
+	logger.With("id", 1).Debug("kept")
+	assert.Equal(t, 1, lines(out))
+
+	level.Set(slog.LevelError)
+	logger.Warn("dropped")
+	assert.Equal(t, 0, lines(out))
+}
+
+func TestLevel_Sample(t *testing.T) {
+	logger, level, out := initializeLogger(t, "DEBUG", 0)
+
+	for i := 0; i < 100; i++ {
+		logger.Debug("dropped")
+		logger.Info("kept")
+	}
+	assert.Equal(t, 100, lines(out))
+
+	assert.NoError(t, level.SetSample(0.5))
+	for i := 0; i < 1000; i++ {
+		logger.Debug("sampled")
+	}
+	assert.InDelta(t, 500, lines(out), 100)
+
+	for _, sample := range []float64{-0.1, 1.1} {
+		assert.ErrorIs(t, level.SetSample(sample), ErrInvalidSample)
+	}
+	assert.Equal(t, 0.5, level.Sample())
+}
+
+func TestWithDebug(t *testing.T) {
+	logger, _, out := initializeLogger(t, "ERROR", 0)
+	ctx := WithDebug(context.Background())
+
+	logger.DebugContext(ctx, "kept")
+	logger.WithGroup("request").InfoContext(ctx, "kept")
+	logger.DebugContext(context.Background(), "dropped")
+	assert.Equal(t, 2, lines(out))
+}
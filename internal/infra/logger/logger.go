@@ -1,14 +1,24 @@
 package logger
 
 import (
+	"context"
 	"log/slog"
 	"os"
 )
 
 func NewLogger(level string) *slog.Logger {
-	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: getLogLevel(level),
-	}))
+	l, _ := NewLevel(level, 1)
+	return NewLeveledLogger(l)
+}
+
+// NewLeveledLogger logs with the level and the sample of debug lines of l, as they change.
+func NewLeveledLogger(l *Level) *slog.Logger {
+	return slog.New(NewHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}), l))
+}
+
+// NewHandler leaves the level of the lines to l, so h must take every level.
+func NewHandler(h slog.Handler, l *Level) slog.Handler {
+	return &sampledHandler{Handler: h, level: l}
 }
 
 func getLogLevel(level string) slog.Level {
@@ -25,3 +35,28 @@ func getLogLevel(level string) slog.Level {
 		return slog.LevelDebug
 	}
 }
+
+// WithRecordAttrs is the With of the loggers of a request, which usually logs nothing. The attrs
+// are added to each record handled, instead of being formatted upfront by the handler.
+func WithRecordAttrs(l *slog.Logger, attrs ...slog.Attr) *slog.Logger {
+	return slog.New(&recordAttrsHandler{Handler: l.Handler(), attrs: attrs})
+}
+
+type recordAttrsHandler struct {
+	slog.Handler
+	attrs []slog.Attr
+}
+
+func (h *recordAttrsHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(h.attrs...)
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs and WithGroup format the attrs upfront, so they stay out of the group.
+func (h *recordAttrsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.Handler.WithAttrs(h.attrs).WithAttrs(attrs)
+}
+
+func (h *recordAttrsHandler) WithGroup(name string) slog.Handler {
+	return h.Handler.WithAttrs(h.attrs).WithGroup(name)
+}
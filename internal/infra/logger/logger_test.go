@@ -0,0 +1,31 @@
+package logger
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRecordAttrs(t *testing.T) {
+	base, _, out := initializeLogger(t, "INFO", 1)
+	logger := WithRecordAttrs(base, slog.String("requestID", "abc"), slog.Int("clientID", 1))
+
+	logger.Debug("dropped")
+	assert.Zero(t, out.Len())
+
+	var record map[string]any
+	logger.Info("kept", "status", 422)
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &record))
+	assert.Equal(t, "abc", record["requestID"])
+	assert.Equal(t, float64(1), record["clientID"])
+	assert.Equal(t, float64(422), record["status"])
+
+	out.Reset()
+	logger.WithGroup("body").Info("kept", "valor", 100)
+	record = nil
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &record))
+	assert.Equal(t, "abc", record["requestID"])
+	assert.Equal(t, map[string]any{"valor": float64(100)}, record["body"])
+}
@@ -0,0 +1,78 @@
+//go:build integration
+
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+
+	"rinha-with-go-2024/config/env"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrator_Up(t *testing.T) {
+	db := initializeDatabase(t)
+	defer db.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	migrator, err := NewMigrator(logger, db)
+	assert.NoError(t, err)
+
+	t.Run("concurrent replicas apply the migrations once", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, migrator.Up(context.Background()))
+			}()
+		}
+		wg.Wait()
+
+		version, err := migrator.Version(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, migrator.migrations[len(migrator.migrations)-1].Version, version)
+
+		var clients int
+		err = db.QueryRow(context.Background(), "SELECT COUNT(*) FROM clients").Scan(&clients)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, clients)
+	})
+
+	t.Run("the initial schema keeps the clients of a database created by the init script", func(t *testing.T) {
+		_, err := db.Exec(context.Background(), migrator.migrations[0].Up)
+		assert.NoError(t, err)
+
+		var clients, maxID int
+		err = db.QueryRow(context.Background(), "SELECT COUNT(*), MAX(id) FROM clients").Scan(&clients, &maxID)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, clients)
+		assert.Equal(t, 5, maxID)
+	})
+}
+
+func initializeDatabase(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dbEndpoint := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
+		env.GetEnvOrSetDefault("DB_USER", "admin"),
+		env.GetEnvOrSetDefault("DB_PASSWORD", "password"),
+		env.GetEnvOrSetDefault("DB_HOST", "localhost"),
+		env.GetEnvOrSetDefault("DB_PORT", "5432"),
+		env.GetEnvOrSetDefault("DB_SCHEMA", "rinha"))
+
+	pool, err := pgxpool.New(context.Background(), dbEndpoint)
+	if err != nil {
+		log.Fatalf("error loading database configuration: %v", err)
+	}
+
+	return pool
+}
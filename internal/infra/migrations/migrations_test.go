@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("embedded migrations are valid and sorted", func(t *testing.T) {
+		migrations, err := Load(files)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, migrations)
+
+		for i, m := range migrations {
+			assert.Equal(t, i+1, m.Version)
+			assert.NotEmpty(t, m.Up)
+			assert.NotEmpty(t, m.Down)
+		}
+	})
+
+	t.Run("migrations are sorted by version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"sql/0002_second.up.sql":   {Data: []byte("SELECT 2;")},
+			"sql/0002_second.down.sql": {Data: []byte("SELECT 2;")},
+			"sql/0001_first.up.sql":    {Data: []byte("SELECT 1;")},
+			"sql/0001_first.down.sql":  {Data: []byte("SELECT 1;")},
+		}
+
+		migrations, err := Load(fsys)
+		assert.NoError(t, err)
+		assert.Equal(t, []Migration{
+			{Version: 1, Name: "first", Up: "SELECT 1;", Down: "SELECT 1;"},
+			{Version: 2, Name: "second", Up: "SELECT 2;", Down: "SELECT 2;"},
+		}, migrations)
+	})
+
+	t.Run("migration without down file", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"sql/0001_first.up.sql": {Data: []byte("SELECT 1;")},
+		}
+
+		_, err := Load(fsys)
+		assert.Error(t, err)
+	})
+
+	t.Run("versions with more than one migration", func(t *testing.T) {
+		tests := map[string]fstest.MapFS{
+			"more than one up file": {
+				"sql/0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+				"sql/0001_first.down.sql": {Data: []byte("SELECT 1;")},
+				"sql/0001_other.up.sql":   {Data: []byte("SELECT 2;")},
+			},
+			`the names "first" and "other"`: {
+				"sql/0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+				"sql/0001_other.down.sql": {Data: []byte("SELECT 1;")},
+			},
+		}
+
+		for message, fsys := range tests {
+			_, err := Load(fsys)
+			assert.ErrorContains(t, err, "migration 0001 has "+message)
+		}
+	})
+
+	t.Run("invalid file name", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"sql/first.sql": {Data: []byte("SELECT 1;")},
+		}
+
+		_, err := Load(fsys)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS request_nonces;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS clients;
@@ -18,12 +18,38 @@ CREATE TABLE IF NOT EXISTS transactions (
       ON DELETE CASCADE
 );
 
-INSERT INTO clients (limitBalance, balance) VALUES
-(100000, 0),
-(80000, 0),
-(1000000, 0),
-(10000000, 0),
-(500000, 0);
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    clientId INT NOT NULL,
+    keyHash VARCHAR(64) NOT NULL UNIQUE,
+    CreatedAt TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT fkClient
+      FOREIGN KEY (clientId)
+      REFERENCES clients (id)
+      ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS request_nonces (
+    apiKeyId INT NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    CreatedAt TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (apiKeyId, nonce),
+    CONSTRAINT fkApiKey
+      FOREIGN KEY (apiKeyId)
+      REFERENCES api_keys (id)
+      ON DELETE CASCADE
+);
+
+-- The ids are explicit so a database created by the old init script keeps its 5 clients.
+INSERT INTO clients (id, limitBalance, balance) VALUES
+(1, 100000, 0),
+(2, 80000, 0),
+(3, 1000000, 0),
+(4, 10000000, 0),
+(5, 500000, 0)
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval('clients_id_seq', (SELECT MAX(id) FROM clients));
 
 /* Examples of Queries
 
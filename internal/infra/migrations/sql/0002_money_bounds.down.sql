@@ -0,0 +1,6 @@
+ALTER TABLE transactions
+    DROP CONSTRAINT IF EXISTS transactionsAmountBounds;
+
+ALTER TABLE clients
+    DROP CONSTRAINT IF EXISTS clientsBalanceBounds,
+    DROP CONSTRAINT IF EXISTS clientsLimitBalanceBounds;
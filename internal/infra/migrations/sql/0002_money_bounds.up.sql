@@ -0,0 +1,11 @@
+-- The amounts are handled as int64 cents by the API, the NUMERIC columns
+-- must never hold a value that can't be represented by it.
+ALTER TABLE clients
+    ADD CONSTRAINT clientsLimitBalanceBounds
+        CHECK (limitBalance BETWEEN -9223372036854775808 AND 9223372036854775807),
+    ADD CONSTRAINT clientsBalanceBounds
+        CHECK (balance BETWEEN -9223372036854775808 AND 9223372036854775807);
+
+ALTER TABLE transactions
+    ADD CONSTRAINT transactionsAmountBounds
+        CHECK (amount BETWEEN 0 AND 9223372036854775807);
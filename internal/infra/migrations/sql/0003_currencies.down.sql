@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS exchange_rates;
+
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS rate,
+    DROP COLUMN IF EXISTS originalAmount,
+    DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE clients
+    DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,17 @@
+ALTER TABLE clients
+    ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'BRL';
+
+-- The transactions created in another currency keep the original
+-- amount and the rate applied to convert it to the client's currency.
+ALTER TABLE transactions
+    ADD COLUMN currency VARCHAR(3),
+    ADD COLUMN originalAmount NUMERIC,
+    ADD COLUMN rate NUMERIC(20, 10);
+
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    fromCurrency VARCHAR(3) NOT NULL,
+    toCurrency VARCHAR(3) NOT NULL,
+    rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+    UpdatedAt TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (fromCurrency, toCurrency)
+);
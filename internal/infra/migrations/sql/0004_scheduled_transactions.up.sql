@@ -0,0 +1,26 @@
+-- The transactions posted by the scheduler at nextRunAt, once or on every
+-- occurrence of the cron-like recurrence. The times are in UTC.
+CREATE TABLE IF NOT EXISTS scheduled_transactions (
+    id SERIAL PRIMARY KEY,
+    clientId INT NOT NULL,
+    amount NUMERIC NOT NULL,
+    kind VARCHAR(1) NOT NULL,
+    description VARCHAR(10) NOT NULL,
+    currency VARCHAR(3),
+    recurrence VARCHAR(100),
+    nextRunAt TIMESTAMP NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'ativo',
+    runs INT NOT NULL DEFAULT 0,
+    failures INT NOT NULL DEFAULT 0,
+    lastRunAt TIMESTAMP,
+    lastError TEXT,
+    CreatedAt TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT fkClient
+      FOREIGN KEY (clientId)
+      REFERENCES clients (id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS scheduledTransactionsDue
+    ON scheduled_transactions (nextRunAt)
+    WHERE status = 'ativo';
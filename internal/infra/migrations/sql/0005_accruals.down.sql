@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS accruals;
+
+ALTER TABLE clients
+    DROP COLUMN IF EXISTS product;
+
+DROP TABLE IF EXISTS products;
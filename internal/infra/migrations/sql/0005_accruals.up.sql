@@ -0,0 +1,35 @@
+-- The products define the charges of their clients, the default
+-- product charges nothing until it is configured.
+CREATE TABLE IF NOT EXISTS products (
+    code VARCHAR(20) PRIMARY KEY,
+    dailyInterestRate NUMERIC(20, 10) NOT NULL DEFAULT 0 CHECK (dailyInterestRate >= 0),
+    monthlyFee NUMERIC NOT NULL DEFAULT 0 CHECK (monthlyFee BETWEEN 0 AND 9223372036854775807),
+    UpdatedAt TIMESTAMP DEFAULT NOW()
+);
+
+INSERT INTO products (code) VALUES ('padrao');
+
+ALTER TABLE clients
+    ADD COLUMN product VARCHAR(20) NOT NULL DEFAULT 'padrao',
+    ADD CONSTRAINT fkProduct
+      FOREIGN KEY (product)
+      REFERENCES products (code);
+
+-- The primary key keeps each charge posted once per client and period.
+CREATE TABLE IF NOT EXISTS accruals (
+    clientId INT NOT NULL,
+    kind VARCHAR(10) NOT NULL,
+    period DATE NOT NULL,
+    amount NUMERIC NOT NULL,
+    transactionId INT NOT NULL,
+    CreatedAt TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (clientId, kind, period),
+    CONSTRAINT fkClient
+      FOREIGN KEY (clientId)
+      REFERENCES clients (id)
+      ON DELETE CASCADE,
+    CONSTRAINT fkTransaction
+      FOREIGN KEY (transactionId)
+      REFERENCES transactions (transactionId)
+      ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS transactionsCategory;
+
+ALTER TABLE scheduled_transactions
+    DROP COLUMN IF EXISTS metadata,
+    DROP COLUMN IF EXISTS category;
+
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS metadata,
+    DROP COLUMN IF EXISTS category;
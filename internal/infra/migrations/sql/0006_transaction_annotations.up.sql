@@ -0,0 +1,11 @@
+ALTER TABLE transactions
+    ADD COLUMN category VARCHAR(30),
+    ADD COLUMN metadata JSONB;
+
+ALTER TABLE scheduled_transactions
+    ADD COLUMN category VARCHAR(30),
+    ADD COLUMN metadata JSONB;
+
+CREATE INDEX IF NOT EXISTS transactionsCategory
+    ON transactions (clientId, category, UpdatedAt)
+    WHERE category IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS transactionsExternalReference;
+
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS externalReference;
@@ -0,0 +1,7 @@
+-- The id given by the upstream system, unique among the transactions of the client.
+ALTER TABLE transactions
+    ADD COLUMN externalReference VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS transactionsExternalReference
+    ON transactions (clientId, externalReference)
+    WHERE externalReference IS NOT NULL;
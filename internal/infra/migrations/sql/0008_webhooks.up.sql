@@ -0,0 +1,45 @@
+-- The webhook subscriptions of the clients, the threshold is only
+-- set for the balance threshold event.
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id SERIAL PRIMARY KEY,
+    clientId INT NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    events VARCHAR(20)[] NOT NULL,
+    threshold NUMERIC,
+    secret VARCHAR(64) NOT NULL,
+    CreatedAt TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT fkClient
+      FOREIGN KEY (clientId)
+      REFERENCES clients (id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS webhookSubscriptionsClient
+    ON webhook_subscriptions (clientId);
+
+-- The deliveries are kept as the delivery log of the subscription,
+-- the pending ones are retried at nextAttemptAt. The times are in UTC.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    subscriptionId INT NOT NULL,
+    event VARCHAR(20) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pendente',
+    attempts INT NOT NULL DEFAULT 0,
+    nextAttemptAt TIMESTAMP NOT NULL,
+    lastStatusCode INT,
+    lastError TEXT,
+    deliveredAt TIMESTAMP,
+    CreatedAt TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT fkSubscription
+      FOREIGN KEY (subscriptionId)
+      REFERENCES webhook_subscriptions (id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS webhookDeliveriesDue
+    ON webhook_deliveries (nextAttemptAt)
+    WHERE status = 'pendente';
+
+CREATE INDEX IF NOT EXISTS webhookDeliveriesSubscription
+    ON webhook_deliveries (subscriptionId, id);
@@ -0,0 +1,3 @@
+-- The events of a client are replayed by transactionId when resuming a stream.
+CREATE INDEX IF NOT EXISTS transactionsClient
+    ON transactions (clientId, transactionId);
@@ -0,0 +1,4 @@
+-- A delivery is claimed by a worker until lockedUntil, in UTC, so it is sent
+-- without holding a row lock and is claimed again when the worker stops.
+ALTER TABLE webhook_deliveries
+    ADD COLUMN lockedUntil TIMESTAMP;
@@ -0,0 +1,4 @@
+-- Increased with every change of the balance, in the same transaction, so the
+-- statements cached by the replicas can be ordered.
+ALTER TABLE clients
+    ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE accruals
+    ALTER CONSTRAINT fkTransaction NOT DEFERRABLE;
@@ -0,0 +1,4 @@
+-- The accrual is registered before its transaction, so a period already posted is found
+-- before the client is locked, and the transaction is only checked on commit.
+ALTER TABLE accruals
+    ALTER CONSTRAINT fkTransaction DEFERRABLE INITIALLY DEFERRED;
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AccrualRepository struct {
+	logger *slog.Logger
+	db     *pgxpool.Pool
+}
+
+func NewAccrualRepository(logger *slog.Logger, db *pgxpool.Pool) *AccrualRepository {
+	return &AccrualRepository{logger: logger, db: db}
+}
+
+// GetAccrualAccounts reverts the transactions made after end from the current balance,
+// in a single query so both are read from the same snapshot.
+func (r *AccrualRepository) GetAccrualAccounts(ctx context.Context, end time.Time) ([]domain.AccrualAccount, error) {
+	query := `
+	SELECT c.id,
+		c.balance - COALESCE((
+			SELECT SUM(CASE WHEN t.kind = 'c' THEN t.amount ELSE -t.amount END)
+			FROM transactions t
+			WHERE t.clientId = c.id AND t.UpdatedAt > $1
+		), 0),
+		p.code, p.dailyInterestRate::text, p.monthlyFee
+	FROM clients c
+	JOIN products p ON p.code = c.product
+	ORDER BY c.id;
+	`
+	rows, err := r.db.Query(ctx, query, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []domain.AccrualAccount
+	for rows.Next() {
+		var account domain.AccrualAccount
+		var code, rate string
+		var fee domain.Money
+		if err := rows.Scan(&account.ClientID, &account.Balance, &code, &rate, &fee); err != nil {
+			return nil, err
+		}
+
+		product, err := domain.NewProduct(code, rate, fee)
+		if err != nil {
+			return nil, err
+		}
+		account.Product = *product
+
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
+
+// PostAccrual registers the accrual before locking the client, so a period already posted is
+// skipped without any write, and a concurrent post of the same accrual waits for this one on
+// the primary key and then finds it registered.
+func (r *AccrualRepository) PostAccrual(ctx context.Context, a *domain.Accrual) (*domain.Client, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := r.postAccrual(ctx, tx, a)
+	if err != nil || client == nil {
+		domain.LoggerFromContext(ctx, r.logger).DebugContext(ctx, "rolling back accrual",
+			"error", err,
+			"posted", client != nil,
+			"rollback status", tx.Rollback(ctx))
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// postAccrual takes the id of the transaction along with the accrual, which references it
+// with a deferred foreign key, and only then updates the balance and inserts the transaction.
+func (r *AccrualRepository) postAccrual(ctx context.Context, tx pgx.Tx, a *domain.Accrual) (*domain.Client, error) {
+	t := a.Transaction()
+
+	query := `
+	INSERT INTO accruals (clientId, kind, period, amount, transactionId)
+	VALUES ($1, $2, $3, $4, nextval(pg_get_serial_sequence('transactions', 'transactionid')))
+	ON CONFLICT DO NOTHING
+	RETURNING transactionId;
+	`
+	var transactionID int
+	err := tx.QueryRow(ctx, query, a.ClientID, a.Kind, a.Period, a.Amount).Scan(&transactionID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23503" {
+		return nil, domain.ErrClientDoesntExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	UPDATE clients
+	SET balance = balance - $1,
+		version = version + 1,
+		UpdatedAt = NOW()
+	WHERE id = $2
+	RETURNING limitBalance, balance, currency, version, UpdatedAt;
+	`
+	client := &domain.Client{ID: t.ClientID}
+	err = tx.QueryRow(ctx, query, t.Amount, t.ClientID).
+		Scan(&client.Limit, &client.Balance, &client.Currency, &client.Version, &client.UpdatedAt)
+	if isMoneyOverflow(err) {
+		return nil, domain.ErrMoneyOverflow
+	}
+	if err == pgx.ErrNoRows {
+		return nil, domain.ErrClientDoesntExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	INSERT INTO transactions (transactionId, clientId, amount, kind, description, UpdatedAt)
+	VALUES ($1, $2, $3, $4, $5, $6);
+	`
+	_, err = tx.Exec(ctx, query, transactionID, t.ClientID, t.Amount, t.Kind, t.Description, t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	a.TransactionID = transactionID
+
+	return client, nil
+}
+
+func (r *AccrualRepository) SaveProduct(ctx context.Context, p *domain.Product) error {
+	query := `
+	INSERT INTO products (code, dailyInterestRate, monthlyFee)
+	VALUES ($1, $2::numeric, $3)
+	ON CONFLICT (code)
+	DO UPDATE SET dailyInterestRate = EXCLUDED.dailyInterestRate, monthlyFee = EXCLUDED.monthlyFee, UpdatedAt = NOW();
+	`
+	_, err := r.db.Exec(ctx, query, p.Code, p.InterestRate(), p.MonthlyFee)
+	return err
+}
+
+func (r *AccrualRepository) GetProducts(ctx context.Context) ([]domain.Product, error) {
+	query := `SELECT code, dailyInterestRate::text, monthlyFee FROM products ORDER BY code;`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []domain.Product
+	for rows.Next() {
+		var code, rate string
+		var fee domain.Money
+		if err := rows.Scan(&code, &rate, &fee); err != nil {
+			return nil, err
+		}
+
+		product, err := domain.NewProduct(code, rate, fee)
+		if err != nil {
+			return nil, err
+		}
+
+		products = append(products, *product)
+	}
+
+	return products, rows.Err()
+}
+
+func (r *AccrualRepository) SetClientProduct(ctx context.Context, clientID int, code string) error {
+	query := `UPDATE clients SET product = $1 WHERE id = $2;`
+	tag, err := r.db.Exec(ctx, query, code, clientID)
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23503" {
+		return domain.ErrProductNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return domain.ErrClientDoesntExist
+	}
+
+	return nil
+}
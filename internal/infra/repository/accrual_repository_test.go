@@ -0,0 +1,82 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccrualRepository_Accrue(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewAccrualRepository(logger, db)
+	clients := NewClientRepository(logger, db)
+	svc := domain.NewAccrualService(logger, repo)
+
+	t.Run("interest over the balance at the end of the date is posted once", func(t *testing.T) {
+		clientId := 1
+		code := "teste"
+		t.Cleanup(cleanUpAccrualRepository(t, db, clientId, code))
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+
+		_, err := svc.SetProduct(context.Background(), code, "0.001", 0)
+		assert.NoError(t, err)
+		assert.NoError(t, svc.SetClientProduct(context.Background(), clientId, code))
+
+		debit, _ := domain.NewTransaction(clientId, 50000, "d", "debito")
+		_, err = clients.ExecuteTransaction(context.Background(), debit)
+		assert.NoError(t, err)
+
+		today := time.Now().UTC()
+		summary, err := svc.Accrue(context.Background(), today)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, summary.Posted)
+		version, err := clients.GetClientVersion(context.Background(), clientId)
+		assert.NoError(t, err)
+
+		summary, err = svc.Accrue(context.Background(), today)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, summary.Posted)
+
+		// The period already posted is skipped before the client is touched.
+		unchanged, err := clients.GetClientVersion(context.Background(), clientId)
+		assert.NoError(t, err)
+		assert.Equal(t, version, unchanged)
+
+		// The debit was made after the end of yesterday, so there is no interest to back-fill.
+		summary, err = svc.Accrue(context.Background(), today.AddDate(0, 0, -1))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, summary.Posted)
+
+		client, err := clients.GetClientBalance(context.Background(), clientId)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.Money(-50050), client.Balance)
+	})
+
+	t.Run("set unexisting product", func(t *testing.T) {
+		err := svc.SetClientProduct(context.Background(), 1, "inexistente")
+		assert.ErrorIs(t, err, domain.ErrProductNotFound)
+	})
+}
+
+func cleanUpAccrualRepository(t *testing.T, db *pgxpool.Pool, clientId int, code string) func() {
+	return func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM accruals WHERE clientId = $1", clientId)
+		assert.NoError(t, err)
+
+		_, err = db.Exec(context.Background(), "UPDATE clients SET product = $1 WHERE id = $2", domain.DefaultProduct, clientId)
+		assert.NoError(t, err)
+
+		_, err = db.Exec(context.Background(), "DELETE FROM products WHERE code = $1", code)
+		assert.NoError(t, err)
+	}
+}
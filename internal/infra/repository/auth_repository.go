@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuthRepository struct {
+	logger *slog.Logger
+	db     *pgxpool.Pool
+}
+
+func NewAuthRepository(logger *slog.Logger, db *pgxpool.Pool) *AuthRepository {
+	return &AuthRepository{logger: logger, db: db}
+}
+
+func (r *AuthRepository) CreateAPIKey(ctx context.Context, clientID int, hash string) (*domain.APIKey, error) {
+	key := &domain.APIKey{ClientID: clientID, Hash: hash}
+	query := `
+	INSERT INTO api_keys (clientId, keyHash)
+	VALUES ($1, $2)
+	RETURNING id, CreatedAt;
+	`
+	err := r.db.QueryRow(ctx, query, clientID, hash).Scan(&key.ID, &key.CreatedAt)
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23503" {
+		return nil, domain.ErrClientDoesntExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (r *AuthRepository) GetAPIKey(ctx context.Context, id int) (*domain.APIKey, error) {
+	key := &domain.APIKey{ID: id}
+	query := `
+	SELECT clientId, keyHash, CreatedAt
+	FROM api_keys
+	WHERE id = $1;
+	`
+	err := r.db.QueryRow(ctx, query, id).Scan(&key.ClientID, &key.Hash, &key.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, domain.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// RegisterNonce relies on the primary key to detect a replayed request,
+// so it works across all the API replicas sharing the database.
+func (r *AuthRepository) RegisterNonce(ctx context.Context, apiKeyID int, nonce string) error {
+	query := `
+	INSERT INTO request_nonces (apiKeyId, nonce)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING;
+	`
+	result, err := r.db.Exec(ctx, query, apiKeyID, nonce)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return domain.ErrRequestReplayed
+	}
+
+	return nil
+}
+
+func (r *AuthRepository) PurgeNonces(ctx context.Context, olderThan time.Duration) error {
+	query := `DELETE FROM request_nonces WHERE CreatedAt < NOW() - $1::interval;`
+	_, err := r.db.Exec(ctx, query, olderThan)
+	return err
+}
@@ -0,0 +1,79 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthRepository_APIKey(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewAuthRepository(logger, db)
+
+	t.Run("create and get api key by id", func(t *testing.T) {
+		clientId := 1
+		hash := domain.HashAPIKey("test-key")
+
+		created, err := repo.CreateAPIKey(context.Background(), clientId, hash)
+		assert.NoError(t, err)
+
+		key, err := repo.GetAPIKey(context.Background(), created.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, hash, key.Hash)
+		assert.Equal(t, clientId, key.ClientID)
+
+		t.Cleanup(cleanUpAuthRepository(t, db, clientId))
+	})
+
+	t.Run("create api key to unexisting client", func(t *testing.T) {
+		_, err := repo.CreateAPIKey(context.Background(), 10000, domain.HashAPIKey("test-key"))
+		assert.ErrorIs(t, err, domain.ErrClientDoesntExist)
+	})
+
+	t.Run("get unexisting api key", func(t *testing.T) {
+		_, err := repo.GetAPIKey(context.Background(), -1)
+		assert.ErrorIs(t, err, domain.ErrAPIKeyNotFound)
+	})
+}
+
+func TestAuthRepository_RegisterNonce(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewAuthRepository(logger, db)
+
+	t.Run("replayed nonce is rejected", func(t *testing.T) {
+		clientId := 1
+		key, err := repo.CreateAPIKey(context.Background(), clientId, domain.HashAPIKey("test-key"))
+		assert.NoError(t, err)
+
+		err = repo.RegisterNonce(context.Background(), key.ID, "nonce")
+		assert.NoError(t, err)
+
+		err = repo.RegisterNonce(context.Background(), key.ID, "nonce")
+		assert.ErrorIs(t, err, domain.ErrRequestReplayed)
+
+		err = repo.PurgeNonces(context.Background(), time.Minute)
+		assert.NoError(t, err)
+
+		t.Cleanup(cleanUpAuthRepository(t, db, clientId))
+	})
+}
+
+func cleanUpAuthRepository(t *testing.T, db *pgxpool.Pool, clientId int) func() {
+	return func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM api_keys WHERE clientId = $1", clientId)
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+)
+
+// BatchingClientRepository coalesces the concurrent transactions of the same client that arrive
+// within the window into a single database transaction, so the client's row is locked and
+// committed once per batch instead of once per request. The limit is checked in arrival order
+// and each caller receives the outcome of its own transaction.
+//
+// The batch is executed with the values of the context of its first transaction, like its
+// logger, but with its own deadline. A transaction whose caller is done before the batch is
+// executed is removed from it, otherwise the caller waits for its outcome, so it is never
+// told a transaction failed when it was applied.
+type BatchingClientRepository struct {
+	domain.ClientRepository
+	logger  *slog.Logger
+	window  time.Duration
+	maxSize int
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[int]*pendingBatch
+	stats   batchStats
+}
+
+type pendingBatch struct {
+	ctx   context.Context
+	items []domain.BatchItem
+	done  []chan batchResult
+}
+
+type batchResult struct {
+	client *domain.Client
+	err    error
+}
+
+type batchStats struct {
+	batches      atomic.Int64
+	transactions atomic.Int64
+	maxSize      atomic.Int64
+	cancelled    atomic.Int64
+}
+
+// BatchStats counts the batches executed since the start, the transactions include the
+// cancelled ones, which were removed from their batch.
+type BatchStats struct {
+	Batches      int64 `json:"lotes"`
+	Transactions int64 `json:"transacoes"`
+	MaxSize      int64 `json:"tamanho_maximo"`
+	Cancelled    int64 `json:"canceladas"`
+}
+
+// AverageSize is the mean number of transactions per batch.
+func (s BatchStats) AverageSize() float64 {
+	if s.Batches == 0 {
+		return 0
+	}
+	return float64(s.Transactions) / float64(s.Batches)
+}
+
+func NewBatchingClientRepository(
+	logger *slog.Logger,
+	repo domain.ClientRepository,
+	window time.Duration,
+	maxSize int,
+) *BatchingClientRepository {
+	return &BatchingClientRepository{
+		ClientRepository: repo,
+		logger:           logger,
+		window:           window,
+		maxSize:          maxSize,
+		timeout:          time.Second * 30,
+		pending:          map[int]*pendingBatch{},
+	}
+}
+
+func (r *BatchingClientRepository) ExecuteTransaction(ctx context.Context, t *domain.Transaction) (*domain.Client, error) {
+	done := make(chan batchResult, 1)
+
+	r.mu.Lock()
+	batch, ok := r.pending[t.ClientID]
+	if !ok {
+		batch = &pendingBatch{ctx: context.WithoutCancel(ctx)}
+		r.pending[t.ClientID] = batch
+		time.AfterFunc(r.window, func() { r.flush(t.ClientID, batch) })
+	}
+	index := len(batch.items)
+	batch.items = append(batch.items, domain.BatchItem{Transaction: t})
+	batch.done = append(batch.done, done)
+	full := len(batch.items) >= r.maxSize
+	r.mu.Unlock()
+
+	if full {
+		r.flush(t.ClientID, batch)
+	}
+
+	select {
+	case result := <-done:
+		return result.client, result.err
+	case <-ctx.Done():
+	}
+
+	// The items failed before the batch is executed are skipped by it.
+	r.mu.Lock()
+	if r.pending[t.ClientID] == batch {
+		batch.items[index].Err = ctx.Err()
+		r.mu.Unlock()
+		r.stats.cancelled.Add(1)
+		return nil, ctx.Err()
+	}
+	r.mu.Unlock()
+
+	// The batch is being executed, it ends within the timeout of the batch.
+	result := <-done
+	return result.client, result.err
+}
+
+func (r *BatchingClientRepository) Stats() BatchStats {
+	return BatchStats{
+		Batches:      r.stats.batches.Load(),
+		Transactions: r.stats.transactions.Load(),
+		MaxSize:      r.stats.maxSize.Load(),
+		Cancelled:    r.stats.cancelled.Load(),
+	}
+}
+
+// flush executes the batch once, either when the window ends or when it is full.
+func (r *BatchingClientRepository) flush(clientID int, batch *pendingBatch) {
+	r.mu.Lock()
+	if r.pending[clientID] != batch {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.pending, clientID)
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(batch.ctx, r.timeout)
+	defer cancel()
+
+	err := r.ClientRepository.ExecuteTransactions(ctx, clientID, batch.items, false)
+	if err != nil {
+		domain.LoggerFromContext(ctx, r.logger).DebugContext(ctx, "failed to execute the batch",
+			"clientID", clientID, "size", len(batch.items), "error", err)
+	}
+	r.record(len(batch.items))
+
+	for i, item := range batch.items {
+		if err != nil {
+			batch.done[i] <- batchResult{err: err}
+			continue
+		}
+		batch.done[i] <- batchResult{client: item.Client, err: item.Err}
+	}
+}
+
+func (r *BatchingClientRepository) record(size int) {
+	r.stats.batches.Add(1)
+	r.stats.transactions.Add(int64(size))
+
+	for {
+		current := r.stats.maxSize.Load()
+		if int64(size) <= current || r.stats.maxSize.CompareAndSwap(current, int64(size)) {
+			return
+		}
+	}
+}
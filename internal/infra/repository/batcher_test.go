@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClientRepository struct {
+	domain.ClientRepository
+	mu      sync.Mutex
+	client  domain.Client
+	batches [][]domain.BatchItem
+	started chan struct{}
+	release chan struct{}
+	ctx     context.Context
+}
+
+func (r *fakeClientRepository) ExecuteTransactions(ctx context.Context, clientID int, items []domain.BatchItem, atomic bool) error {
+	if r.started != nil {
+		close(r.started)
+		<-r.release
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ctx = ctx
+	if clientID != r.client.ID {
+		return domain.ErrClientDoesntExist
+	}
+
+	for i := range items {
+		if items[i].Err != nil {
+			continue
+		}
+		items[i].Err = r.client.Apply(items[i].Transaction)
+		if items[i].Err == nil {
+			snapshot := r.client
+			items[i].Client = &snapshot
+		}
+	}
+	r.batches = append(r.batches, items)
+	return nil
+}
+
+func TestBatchingClientRepository_ExecuteTransaction(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("concurrent transactions of a client are coalesced", func(t *testing.T) {
+		inner := &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000}}
+		repo := NewBatchingClientRepository(logger, inner, time.Millisecond*100, 100)
+		concurrentUpdates := 10
+
+		var wg sync.WaitGroup
+		errs := make([]error, concurrentUpdates)
+		for i := 0; i < concurrentUpdates; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				transaction, _ := domain.NewTransaction(1, 150, "d", "descricao")
+				_, errs[i] = repo.ExecuteTransaction(context.Background(), transaction)
+			}(i)
+		}
+		wg.Wait()
+
+		rejected := 0
+		for _, err := range errs {
+			if err != nil {
+				assert.ErrorIs(t, err, domain.ErrTransactionOverClientLimit)
+				rejected++
+			}
+		}
+
+		assert.Equal(t, 4, rejected)
+		assert.Equal(t, domain.Money(-900), inner.client.Balance)
+		assert.Len(t, inner.batches, 1)
+		assert.Equal(t, BatchStats{Batches: 1, Transactions: 10, MaxSize: 10}, repo.Stats())
+	})
+
+	t.Run("full batch is flushed before the window", func(t *testing.T) {
+		inner := &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000}}
+		repo := NewBatchingClientRepository(logger, inner, time.Hour, 1)
+
+		transaction, _ := domain.NewTransaction(1, 150, "c", "descricao")
+		client, err := repo.ExecuteTransaction(context.Background(), transaction)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.Money(150), client.Balance)
+		assert.Equal(t, domain.Money(150), inner.client.Balance)
+	})
+
+	t.Run("batch to unexisting client", func(t *testing.T) {
+		inner := &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000}}
+		repo := NewBatchingClientRepository(logger, inner, time.Millisecond, 100)
+
+		transaction, _ := domain.NewTransaction(10000, 150, "c", "descricao")
+		_, err := repo.ExecuteTransaction(context.Background(), transaction)
+		assert.ErrorIs(t, err, domain.ErrClientDoesntExist)
+	})
+	t.Run("transaction cancelled before the batch runs is removed from it", func(t *testing.T) {
+		inner := &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000}}
+		repo := NewBatchingClientRepository(logger, inner, time.Millisecond*50, 100)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		transaction, _ := domain.NewTransaction(1, 150, "c", "descricao")
+		_, err := repo.ExecuteTransaction(ctx, transaction)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		transaction, _ = domain.NewTransaction(1, 100, "c", "descricao")
+		client, err := repo.ExecuteTransaction(context.Background(), transaction)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.Money(100), client.Balance)
+		assert.Equal(t, domain.Money(100), inner.client.Balance)
+		assert.Equal(t, int64(1), repo.Stats().Cancelled)
+	})
+
+	t.Run("transaction cancelled while the batch runs waits for its outcome", func(t *testing.T) {
+		inner := &fakeClientRepository{
+			client:  domain.Client{ID: 1, Limit: 1000},
+			started: make(chan struct{}),
+			release: make(chan struct{}),
+		}
+		repo := NewBatchingClientRepository(logger, inner, time.Millisecond, 100)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-inner.started
+			cancel()
+			time.Sleep(time.Millisecond * 10)
+			close(inner.release)
+		}()
+
+		transaction, _ := domain.NewTransaction(1, 150, "c", "descricao")
+		client, err := repo.ExecuteTransaction(ctx, transaction)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.Money(150), client.Balance)
+		assert.Equal(t, int64(0), repo.Stats().Cancelled)
+	})
+
+	t.Run("batch runs with the values of the first context", func(t *testing.T) {
+		inner := &fakeClientRepository{client: domain.Client{ID: 1, Limit: 1000}}
+		repo := NewBatchingClientRepository(logger, inner, time.Millisecond, 100)
+		requestLogger := slog.New(slog.NewTextHandler(io.Discard, nil)).With("requestID", "abc")
+
+		ctx := domain.ContextWithLogger(context.Background(), requestLogger)
+		transaction, _ := domain.NewTransaction(1, 150, "c", "descricao")
+		_, err := repo.ExecuteTransaction(ctx, transaction)
+		assert.NoError(t, err)
+
+		assert.Same(t, requestLogger, domain.LoggerFromContext(inner.ctx, logger))
+		_, ok := inner.ctx.Deadline()
+		assert.True(t, ok)
+	})
+}
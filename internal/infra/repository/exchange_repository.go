@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ExchangeRateRepository struct {
+	logger *slog.Logger
+	db     *pgxpool.Pool
+}
+
+func NewExchangeRateRepository(logger *slog.Logger, db *pgxpool.Pool) *ExchangeRateRepository {
+	return &ExchangeRateRepository{logger: logger, db: db}
+}
+
+func (r *ExchangeRateRepository) SaveExchangeRate(ctx context.Context, rate *domain.ExchangeRate) error {
+	query := `
+	INSERT INTO exchange_rates (fromCurrency, toCurrency, rate)
+	VALUES ($1, $2, $3::numeric)
+	ON CONFLICT (fromCurrency, toCurrency)
+	DO UPDATE SET rate = EXCLUDED.rate, UpdatedAt = NOW()
+	RETURNING UpdatedAt;
+	`
+	return r.db.QueryRow(ctx, query, rate.From, rate.To, rate.Decimal()).Scan(&rate.UpdatedAt)
+}
+
+func (r *ExchangeRateRepository) GetExchangeRates(ctx context.Context) ([]domain.ExchangeRate, error) {
+	query := `
+	SELECT fromCurrency, toCurrency, rate::text, UpdatedAt
+	FROM exchange_rates
+	ORDER BY fromCurrency, toCurrency;
+	`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []domain.ExchangeRate
+	for rows.Next() {
+		var from, to, value string
+		var updatedAt time.Time
+		if err := rows.Scan(&from, &to, &value, &updatedAt); err != nil {
+			return nil, err
+		}
+
+		rate, err := domain.NewExchangeRate(from, to, value)
+		if err != nil {
+			return nil, err
+		}
+		rate.UpdatedAt = updatedAt
+
+		rates = append(rates, *rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func getExchangeRate(ctx context.Context, q querier, from string, to string) (*domain.ExchangeRate, error) {
+	var value string
+	query := `SELECT rate::text FROM exchange_rates WHERE fromCurrency = $1 AND toCurrency = $2;`
+	err := q.QueryRow(ctx, query, from, to).Scan(&value)
+	if err == pgx.ErrNoRows {
+		return nil, domain.ErrExchangeRateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.NewExchangeRate(from, to, value)
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PoolGauge tells when every connection of the pool is in use, so new queries would wait for one.
+type PoolGauge struct {
+	db *pgxpool.Pool
+}
+
+func NewPoolGauge(db *pgxpool.Pool) *PoolGauge {
+	return &PoolGauge{db: db}
+}
+
+func (g *PoolGauge) Saturated() bool {
+	stat := g.db.Stat()
+	return stat.AcquiredConns() >= stat.MaxConns()
+}
+
+// Wait acquires a connection, which waits in the queue of the pool until one is released,
+// and gives it back right away.
+func (g *PoolGauge) Wait(ctx context.Context) error {
+	conn, err := g.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	conn.Release()
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolGauge(t *testing.T) {
+	config := initializeDatabase(t).Config()
+	config.MaxConns = 1
+	db, err := pgxpool.NewWithConfig(context.Background(), config)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	gauge := NewPoolGauge(db)
+	assert.False(t, gauge.Saturated())
+
+	conn, err := db.Acquire(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, gauge.Saturated())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, gauge.Wait(ctx), context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conn.Release()
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, gauge.Wait(ctx))
+	assert.False(t, gauge.Saturated())
+}
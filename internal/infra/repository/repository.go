@@ -2,12 +2,16 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
+	"time"
 
 	"rinha-with-go-2024/internal/domain"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -20,22 +24,46 @@ func NewClientRepository(logger *slog.Logger, db *pgxpool.Pool) *ClientRepositor
 	return &ClientRepository{logger: logger, db: db}
 }
 
-func (r *ClientRepository) ExecuteTransaction(ctx context.Context, t *domain.Transaction) error {
+// ExecuteTransaction returns the client with the balance computed inside the transaction,
+// so it is exactly the balance right after this transaction.
+func (r *ClientRepository) ExecuteTransaction(ctx context.Context, t *domain.Transaction) (*domain.Client, error) {
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		r.logger.Debug("rolling back transaction",
+		return nil, err
+	}
+	if err := r.exchange(ctx, tx, t); err != nil {
+		domain.LoggerFromContext(ctx, r.logger).DebugContext(ctx, "rolling back transaction",
 			"error", err,
 			"rollback status", tx.Rollback(ctx))
-		return err
+		return nil, err
 	}
-	if err := r.updateClientBalance(ctx, tx, t.ClientID, t.Kind, t.Amount); err != nil {
-		r.logger.Debug("rolling back transaction",
+	client, err := r.updateClientBalance(ctx, tx, t)
+	if err != nil {
+		domain.LoggerFromContext(ctx, r.logger).DebugContext(ctx, "rolling back transaction",
 			"error", err,
 			"rollback status", tx.Rollback(ctx))
-		return err
+		return nil, err
 	}
 	if err := r.createTransaction(ctx, tx, t); err != nil {
-		r.logger.Debug("rolling back transaction",
+		domain.LoggerFromContext(ctx, r.logger).DebugContext(ctx, "rolling back transaction",
+			"error", err,
+			"rollback status", tx.Rollback(ctx))
+		return nil, err
+	}
+
+	return client, tx.Commit(ctx)
+}
+
+// ExecuteTransactions locks the client once and applies the batch in order, inserting
+// the accepted transactions with a single copy and updating the balance only once.
+func (r *ClientRepository) ExecuteTransactions(ctx context.Context, clientID int, items []domain.BatchItem, atomic bool) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := r.applyTransactions(ctx, tx, clientID, items, atomic); err != nil {
+		domain.LoggerFromContext(ctx, r.logger).DebugContext(ctx, "rolling back transaction batch",
 			"error", err,
 			"rollback status", tx.Rollback(ctx))
 		return err
@@ -44,69 +72,521 @@ func (r *ClientRepository) ExecuteTransaction(ctx context.Context, t *domain.Tra
 	return tx.Commit(ctx)
 }
 
-func (r *ClientRepository) createTransaction(ctx context.Context, tx pgx.Tx, t *domain.Transaction) error {
-	query := `
-	INSERT INTO transactions (clientId, amount, kind, description) 
-	VALUES ($1, $2, $3, $4);
+func (r *ClientRepository) applyTransactions(ctx context.Context, tx pgx.Tx, clientID int, items []domain.BatchItem, atomic bool) error {
+	query := `SELECT limitBalance, balance, currency FROM clients WHERE id = $1 FOR UPDATE;`
+	client := &domain.Client{ID: clientID}
+	err := tx.QueryRow(ctx, query, clientID).Scan(&client.Limit, &client.Balance, &client.Currency)
+	if err == pgx.ErrNoRows {
+		return domain.ErrClientDoesntExist
+	}
+	if err != nil {
+		return err
+	}
+
+	used, err := r.usedReferences(ctx, tx, clientID, items)
+	if err != nil {
+		return err
+	}
+
+	rates := map[string]*domain.ExchangeRate{}
+	rows := make([][]any, 0, len(items))
+	for i := range items {
+		item := &items[i]
+		if item.Err != nil {
+			continue
+		}
+
+		reference := item.Transaction.ExternalReference
+		if reference != "" && used[reference] {
+			item.Err = domain.ErrDuplicateReference
+			if atomic {
+				return domain.ErrBatchRejected
+			}
+			continue
+		}
+
+		if err := r.exchangeInBatch(ctx, tx, item.Transaction, client.Currency, rates); err != nil {
+			item.Err = err
+			if atomic {
+				return domain.ErrBatchRejected
+			}
+			continue
+		}
+
+		if err := client.Apply(item.Transaction); err != nil {
+			item.Err = err
+			if atomic {
+				return domain.ErrBatchRejected
+			}
+			continue
+		}
+
+		row, err := transactionRow(item.Transaction)
+		if err != nil {
+			return err
+		}
+
+		snapshot := *client
+		item.Client = &snapshot
+		rows = append(rows, row)
+		if reference != "" {
+			used[reference] = true
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	query = `
+	UPDATE clients
+	SET balance = $1,
+		version = version + 1,
+		UpdatedAt = NOW()
+	WHERE id = $2
+	RETURNING version, UpdatedAt;
 	`
-	_, err := tx.Exec(ctx, query, t.ClientID, t.Amount, t.Kind, t.Description)
+	var version int64
+	var updatedAt time.Time
+	err = tx.QueryRow(ctx, query, client.Balance, clientID).Scan(&version, &updatedAt)
+	if isMoneyOverflow(err) {
+		return domain.ErrMoneyOverflow
+	}
 	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23503" {
-			return domain.ErrClientDoesntExist
+		return err
+	}
+
+	ids, err := r.nextTransactionIDs(ctx, tx, len(rows))
+	if err != nil {
+		return err
+	}
+
+	accepted := 0
+	for i := range items {
+		if items[i].Client != nil {
+			items[i].Client.Version = version
+			items[i].Client.UpdatedAt = updatedAt
+			items[i].Transaction.TransactionID = ids[accepted]
+			rows[accepted] = append(rows[accepted], ids[accepted])
+			accepted++
 		}
 	}
 
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"transactions"},
+		[]string{"clientid", "amount", "kind", "description", "currency", "originalamount", "rate", "category", "metadata", "externalreference", "transactionid"},
+		pgx.CopyFromRows(rows),
+	)
+	if isMoneyOverflow(err) {
+		return domain.ErrMoneyOverflow
+	}
 	return err
 }
 
-func (r *ClientRepository) updateClientBalance(ctx context.Context, tx pgx.Tx, clientID int, kind string, amount uint) error {
-	query := `SELECT balance FROM clients WHERE id = $1 FOR UPDATE;`
-	row := tx.QueryRow(ctx, query, clientID)
-	var balance int
-	if err := row.Scan(&balance); err != nil {
+// isMoneyOverflow tells whether a money column would leave the int64 bounds, which are the only
+// checks of the clients and the transactions.
+func isMoneyOverflow(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23514"
+}
+
+// nextTransactionIDs takes the ids of the transactions copied in a batch, since the copy can't
+// return them. Taken with the client locked, they increase with the transactions of the client.
+func (r *ClientRepository) nextTransactionIDs(ctx context.Context, tx pgx.Tx, count int) ([]int, error) {
+	query := `
+	SELECT nextval(pg_get_serial_sequence('transactions', 'transactionid')) AS id
+	FROM generate_series(1, $1)
+	ORDER BY id;
+	`
+	rows, err := tx.Query(ctx, query, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// usedReferences returns the external references of the batch already used by the client. It
+// runs with the client locked, so no other transaction of the client can take them meanwhile.
+func (r *ClientRepository) usedReferences(ctx context.Context, tx pgx.Tx, clientID int, items []domain.BatchItem) (map[string]bool, error) {
+	var references []string
+	for _, item := range items {
+		if item.Err == nil && item.Transaction.ExternalReference != "" {
+			references = append(references, item.Transaction.ExternalReference)
+		}
+	}
+
+	used := map[string]bool{}
+	if len(references) == 0 {
+		return used, nil
+	}
+
+	query := `
+	SELECT externalReference
+	FROM transactions
+	WHERE clientId = $1 AND externalReference = ANY($2);
+	`
+	rows, err := tx.Query(ctx, query, clientID, references)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reference string
+		if err := rows.Scan(&reference); err != nil {
+			return nil, err
+		}
+		used[reference] = true
+	}
+
+	return used, rows.Err()
+}
+
+// exchange converts the amount to the client's currency, only the
+// transactions created with a currency pay for the extra queries.
+func (r *ClientRepository) exchange(ctx context.Context, tx pgx.Tx, t *domain.Transaction) error {
+	if t.Currency == "" {
+		return nil
+	}
+
+	// The lock keeps the currency from changing before the balance is updated.
+	var currency string
+	query := `SELECT currency FROM clients WHERE id = $1 FOR UPDATE;`
+	err := tx.QueryRow(ctx, query, t.ClientID).Scan(&currency)
+	if err == pgx.ErrNoRows {
+		return domain.ErrClientDoesntExist
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.exchangeInBatch(ctx, tx, t, currency, map[string]*domain.ExchangeRate{})
+}
+
+// exchangeInBatch converts the amount reusing the rates already read in the same batch.
+func (r *ClientRepository) exchangeInBatch(
+	ctx context.Context,
+	tx pgx.Tx,
+	t *domain.Transaction,
+	clientCurrency string,
+	rates map[string]*domain.ExchangeRate,
+) error {
+	if !t.NeedsExchange(clientCurrency) {
+		return nil
+	}
+
+	rate, ok := rates[t.Currency]
+	if !ok {
+		var err error
+		rate, err = getExchangeRate(ctx, tx, t.Currency, clientCurrency)
+		if err != nil {
+			return err
+		}
+		rates[t.Currency] = rate
+	}
+
+	return t.Exchange(rate)
+}
+
+// transactionRow has the values of the columns clientId, amount, kind, description, currency,
+// originalAmount, rate, category, metadata and externalReference, in this order.
+func transactionRow(t *domain.Transaction) ([]any, error) {
+	row := []any{
+		t.ClientID, t.Amount, t.Kind, t.Description, nil, nil, nil,
+		nullable(t.Category), nil, nullable(t.ExternalReference),
+	}
+	if t.Currency != "" {
+		row[4] = t.Currency
+	}
+
+	metadata, err := metadataValue(t.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	row[8] = metadata
+
+	if t.Rate != "" {
+		var rate pgtype.Numeric
+		if err := rate.Scan(t.Rate); err != nil {
+			return nil, err
+		}
+		row[5] = t.OriginalAmount
+		row[6] = rate
+	}
+
+	return row, nil
+}
+
+// nullable stores the empty strings as NULL.
+func nullable(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// metadataValue encodes the metadata for the JSONB columns, the empty metadata is stored as NULL.
+func metadataValue(metadata domain.Metadata) (any, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(encoded), nil
+}
+
+func (r *ClientRepository) createTransaction(ctx context.Context, tx pgx.Tx, t *domain.Transaction) error {
+	query := `
+	INSERT INTO transactions (clientId, amount, kind, description, currency, originalAmount, rate, category, metadata, externalReference)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING transactionId;
+	`
+	row, err := transactionRow(t)
+	if err != nil {
 		return err
 	}
 
-	newBalance := r.calculateNewBalance(balance, kind, amount)
+	err = tx.QueryRow(ctx, query, row...).Scan(&t.TransactionID)
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23503" {
+		return domain.ErrClientDoesntExist
+	}
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
+		return domain.ErrDuplicateReference
+	}
+	if isMoneyOverflow(err) {
+		return domain.ErrMoneyOverflow
+	}
 
+	return err
+}
+
+func (r *ClientRepository) updateClientBalance(ctx context.Context, tx pgx.Tx, t *domain.Transaction) (*domain.Client, error) {
 	// This query ensures the balance is not updated if it
 	// will be below the client's limit (like a credit in the bank).
-	// PS: This logic could be done in the app too.
-	query = `
+	// The update locks the row, so the balance returned is only
+	// changed by other transactions after this one commits.
+	query := `
 	UPDATE clients
-	SET balance = $1,
+	SET balance = balance + $1,
+		version = version + 1,
 		UpdatedAt = NOW()
 	WHERE id = $2
-	AND limitBalance + $1 > 0;
+	AND limitBalance + balance + $1 > 0
+	RETURNING limitBalance, balance, currency, version, UpdatedAt;
 	`
-	result, err := tx.Exec(ctx, query, newBalance, clientID)
+	client := &domain.Client{ID: t.ClientID}
+	err := tx.QueryRow(ctx, query, t.SignedAmount(), t.ClientID).
+		Scan(&client.Limit, &client.Balance, &client.Currency, &client.Version, &client.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, r.overLimitOrNotFound(ctx, tx, t.ClientID)
+	}
+	if isMoneyOverflow(err) {
+		return nil, domain.ErrMoneyOverflow
+	}
 	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (r *ClientRepository) overLimitOrNotFound(ctx context.Context, tx pgx.Tx, clientID int) error {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM clients WHERE id = $1);`
+	if err := tx.QueryRow(ctx, query, clientID).Scan(&exists); err != nil {
 		return err
 	}
 
-	if result.RowsAffected() == 0 {
-		return domain.ErrTransactionOverClientLimit
+	if !exists {
+		return domain.ErrClientDoesntExist
 	}
 
-	return nil
+	return domain.ErrTransactionOverClientLimit
+}
+
+// querier is implemented by both the pool and a transaction.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
 }
 
-func (r *ClientRepository) calculateNewBalance(balance int, kind string, amount uint) int {
-	if kind == "d" {
-		return balance - int(amount)
+func (r *ClientRepository) GetClientBalance(ctx context.Context, clientID int) (*domain.Client, error) {
+	return r.getClientBalance(ctx, r.db, clientID)
+}
+
+// GetClientVersion reads only the version of the client, to check a cached statement.
+func (r *ClientRepository) GetClientVersion(ctx context.Context, clientID int) (int64, error) {
+	var version int64
+	err := r.db.QueryRow(ctx, `SELECT version FROM clients WHERE id = $1;`, clientID).Scan(&version)
+	if err == pgx.ErrNoRows {
+		return 0, domain.ErrClientDoesntExist
+	}
+	if err != nil {
+		return 0, err
 	}
 
-	return balance + int(amount)
+	return version, nil
 }
 
-func (r *ClientRepository) GetClientBalance(ctx context.Context, clientID int) (*domain.Client, error) {
+func (r *ClientRepository) GetClientTransactions(ctx context.Context, clientID int) ([]domain.Transaction, error) {
+	return r.getClientTransactions(ctx, r.db, clientID)
+}
+
+// GetTransactions lists the transactions matching the filter, checking
+// the client exists only when none matches.
+func (r *ClientRepository) GetTransactions(ctx context.Context, clientID int, filter *domain.TransactionFilter) ([]domain.Transaction, error) {
+	var metadata any
+	if len(filter.Metadata) > 0 {
+		encoded, err := json.Marshal(filter.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		metadata = string(encoded)
+	}
+
+	query := `
+	SELECT amount, kind, description, currency, originalAmount, trim_scale(rate)::text, category, metadata, externalReference, UpdatedAt
+	FROM transactions
+	WHERE clientId = $1
+	AND ($2::text IS NULL OR category = $2)
+	AND ($3::jsonb IS NULL OR NOT EXISTS (
+		SELECT 1 FROM jsonb_each_text($3::jsonb) expected
+		WHERE metadata ->> expected.key IS DISTINCT FROM expected.value
+	))
+	ORDER BY UpdatedAt DESC, transactionId DESC
+	LIMIT $4;
+	`
+	rows, err := r.db.Query(ctx, query, clientID, nullable(filter.Category), metadata, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions, err := r.mapTransactions(rows)
+	if err != nil || len(transactions) > 0 {
+		return transactions, err
+	}
+
+	if _, err := r.getClientBalance(ctx, r.db, clientID); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+func (r *ClientRepository) GetTransactionByReference(ctx context.Context, clientID int, reference string) (*domain.Transaction, error) {
+	query := `
+	SELECT amount, kind, description, currency, originalAmount, trim_scale(rate)::text, category, metadata, externalReference, UpdatedAt
+	FROM transactions
+	WHERE clientId = $1 AND externalReference = $2;
+	`
+	rows, err := r.db.Query(ctx, query, clientID, reference)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions, err := r.mapTransactions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(transactions) == 0 {
+		return nil, domain.ErrTransactionNotFound
+	}
+
+	return &transactions[0], nil
+}
+
+// GetStatement reads the balance and the last transactions from the same snapshot,
+// so the balance always reflects exactly the transactions listed.
+func (r *ClientRepository) GetStatement(ctx context.Context, clientID int) (*domain.Statement, error) {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	client, err := r.getClientBalance(ctx, tx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := r.getClientTransactions(ctx, tx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &domain.Statement{Client: client, Transactions: transactions}, nil
+}
+
+// GetEventsAfter reverts the transactions after each event from the current balance, summing
+// them before the limit is applied, so the balances are right even when more events are left.
+func (r *ClientRepository) GetEventsAfter(ctx context.Context, clientID int, afterID int, limit int) ([]domain.TransactionEvent, error) {
+	query := `
+	SELECT t.transactionId, t.amount, t.kind, t.description, c.limitBalance,
+		c.balance - COALESCE(SUM(CASE WHEN t.kind = 'c' THEN t.amount ELSE -t.amount END) OVER (
+			ORDER BY t.transactionId DESC
+			ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING
+		), 0),
+		t.UpdatedAt
+	FROM transactions t
+	JOIN clients c ON c.id = t.clientId
+	WHERE t.clientId = $1 AND t.transactionId > $2
+	ORDER BY t.transactionId
+	LIMIT $3;
+	`
+	rows, err := r.db.Query(ctx, query, clientID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []domain.TransactionEvent
+	for rows.Next() {
+		e := domain.TransactionEvent{ClientID: clientID}
+		var description *string
+		if err := rows.Scan(&e.ID, &e.Amount, &e.Kind, &description, &e.Limit, &e.Balance, &e.OccurredAt); err != nil {
+			return nil, err
+		}
+		if description != nil {
+			e.Description = *description
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 {
+		if _, err := r.getClientBalance(ctx, r.db, clientID); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+func (r *ClientRepository) getClientBalance(ctx context.Context, q querier, clientID int) (*domain.Client, error) {
 	var client *domain.Client = &domain.Client{ID: clientID}
 	query := `
-	SELECT limitBalance, balance, UpdatedAt
+	SELECT limitBalance, balance, currency, version, UpdatedAt
 	FROM clients
 	WHERE id = $1;
 	`
-	err := r.db.QueryRow(ctx, query, clientID).Scan(&client.Limit, &client.Balance, &client.UpdatedAt)
+	err := q.QueryRow(ctx, query, clientID).Scan(&client.Limit, &client.Balance, &client.Currency, &client.Version, &client.UpdatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, domain.ErrClientDoesntExist
 	}
@@ -117,19 +597,20 @@ func (r *ClientRepository) GetClientBalance(ctx context.Context, clientID int) (
 	return client, nil
 }
 
-func (r *ClientRepository) GetClientTransactions(ctx context.Context, clientID int) ([]domain.Transaction, error) {
+func (r *ClientRepository) getClientTransactions(ctx context.Context, q querier, clientID int) ([]domain.Transaction, error) {
 	query := `
-	SELECT amount, kind, description, updatedat
+	SELECT amount, kind, description, currency, originalAmount, trim_scale(rate)::text, category, metadata, externalReference, updatedat
 	FROM public.transactions
 	WHERE transactions.clientId = $1
-	ORDER BY UpdatedAt DESC
+	ORDER BY UpdatedAt DESC, transactionId DESC
 	LIMIT 10;
 	`
 
-	rows, err := r.db.Query(ctx, query, clientID)
+	rows, err := q.Query(ctx, query, clientID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	return r.mapTransactions(rows)
 }
@@ -138,13 +619,84 @@ func (r *ClientRepository) mapTransactions(rows pgx.Rows) ([]domain.Transaction,
 	var transactions []domain.Transaction
 	for rows.Next() {
 		var t domain.Transaction
-		err := rows.Scan(&t.Amount, &t.Kind, &t.Description, &t.UpdatedAt)
+		var currency, rate, category, reference *string
+		var originalAmount *domain.Money
+		var metadata []byte
+		err := rows.Scan(
+			&t.Amount, &t.Kind, &t.Description, &currency, &originalAmount, &rate,
+			&category, &metadata, &reference, &t.UpdatedAt,
+		)
 		if err != nil {
 			return nil, err
 		}
 
+		if category != nil {
+			t.Category = *category
+		}
+		if metadata != nil {
+			if err := json.Unmarshal(metadata, &t.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		if reference != nil {
+			t.ExternalReference = *reference
+		}
+
+		if currency != nil {
+			t.Currency = *currency
+		}
+		if originalAmount != nil && rate != nil {
+			t.OriginalAmount = *originalAmount
+			t.Rate = *rate
+		}
+
 		transactions = append(transactions, t)
 	}
 
-	return transactions, nil
+	return transactions, rows.Err()
+}
+
+// SetClientCurrency locks the client before looking for its transactions, so none is created
+// in the former currency until it commits.
+func (r *ClientRepository) SetClientCurrency(ctx context.Context, clientID int, currency string) (*domain.Client, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var current string
+	query := `SELECT currency FROM clients WHERE id = $1 FOR UPDATE;`
+	err = tx.QueryRow(ctx, query, clientID).Scan(&current)
+	if err == pgx.ErrNoRows {
+		return nil, domain.ErrClientDoesntExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var used bool
+	query = `SELECT EXISTS (SELECT 1 FROM transactions WHERE clientId = $1);`
+	if err := tx.QueryRow(ctx, query, clientID).Scan(&used); err != nil {
+		return nil, err
+	}
+	if used && current != currency {
+		return nil, domain.ErrCurrencyInUse
+	}
+
+	query = `
+	UPDATE clients
+	SET currency = $1,
+		version = version + 1
+	WHERE id = $2
+	RETURNING limitBalance, balance, currency, version, UpdatedAt;
+	`
+	client := &domain.Client{ID: clientID}
+	err = tx.QueryRow(ctx, query, currency, clientID).
+		Scan(&client.Limit, &client.Balance, &client.Currency, &client.Version, &client.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, tx.Commit(ctx)
 }
@@ -4,12 +4,15 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
 	"rinha-with-go-2024/config/env"
 	"rinha-with-go-2024/internal/domain"
+	"rinha-with-go-2024/internal/infra/migrations"
+	"sort"
 	"strconv"
 	"sync"
 	"testing"
@@ -38,16 +41,16 @@ func TestClientRepository_ExecuteTransaction(t *testing.T) {
 
 	t.Run("valid credit transaction", func(t *testing.T) {
 		clientId := 1
-		amount := 1000
+		amount := domain.Money(1000)
 
 		transaction, err := domain.NewTransaction(
 			clientId,
-			uint(amount),
+			amount,
 			"c",
 			"descricao",
 		)
 		assert.NoError(t, err)
-		err = repo.ExecuteTransaction(context.Background(), transaction)
+		_, err = repo.ExecuteTransaction(context.Background(), transaction)
 		assert.NoError(t, err)
 
 		client := domain.Client{}
@@ -62,32 +65,32 @@ func TestClientRepository_ExecuteTransaction(t *testing.T) {
 
 	t.Run("valid credit transaction to unexisting client", func(t *testing.T) {
 		clientId := 10000
-		amount := 1000
+		amount := domain.Money(1000)
 
 		transaction, err := domain.NewTransaction(
 			clientId,
-			uint(amount),
+			amount,
 			"c",
 			"descricao",
 		)
 		assert.NoError(t, err)
-		err = repo.ExecuteTransaction(context.Background(), transaction)
-		assert.Error(t, err, domain.ErrClientDoesntExist)
+		_, err = repo.ExecuteTransaction(context.Background(), transaction)
+		assert.ErrorIs(t, err, domain.ErrClientDoesntExist)
 	})
 
 	t.Run("valid debit transaction within limit", func(t *testing.T) {
 		clientId := 1
-		amount := 1000
+		amount := domain.Money(1000)
 
 		transaction, err := domain.NewTransaction(
 			clientId,
-			uint(amount),
+			amount,
 			"d",
 			"descricao",
 		)
 
 		assert.NoError(t, err)
-		err = repo.ExecuteTransaction(context.Background(), transaction)
+		_, err = repo.ExecuteTransaction(context.Background(), transaction)
 		assert.NoError(t, err)
 
 		client := domain.Client{}
@@ -103,29 +106,29 @@ func TestClientRepository_ExecuteTransaction(t *testing.T) {
 
 	t.Run("valid debit transaction over the limit", func(t *testing.T) {
 		clientId := 1
-		amount := 1000000000
+		amount := domain.Money(1000000000)
 
 		transaction, err := domain.NewTransaction(
 			clientId,
-			uint(amount),
+			amount,
 			"d",
 			"descricao",
 		)
 
 		assert.NoError(t, err)
-		err = repo.ExecuteTransaction(context.Background(), transaction)
+		_, err = repo.ExecuteTransaction(context.Background(), transaction)
 		assert.ErrorIs(t, err, domain.ErrTransactionOverClientLimit)
 	})
 
 	t.Run("concorrent debit updates without race condition", func(t *testing.T) {
 		clientId := 2
-		amount := 5000
+		amount := domain.Money(5000)
 		amountAsNegative := -amount
 		concorrentUpdates := 10
 
 		transaction, err := domain.NewTransaction(
 			clientId,
-			uint(amount),
+			amount,
 			"d",
 			"descricao",
 		)
@@ -136,7 +139,7 @@ func TestClientRepository_ExecuteTransaction(t *testing.T) {
 			wg.Add(1)
 
 			go func(t *testing.T, transaction domain.Transaction) {
-				err := repo.ExecuteTransaction(context.Background(), &transaction)
+				_, err := repo.ExecuteTransaction(context.Background(), &transaction)
 				assert.NoError(t, err)
 				defer wg.Done()
 			}(t, *transaction)
@@ -148,8 +151,189 @@ func TestClientRepository_ExecuteTransaction(t *testing.T) {
 		err = db.QueryRow(context.Background(), "SELECT * FROM clients WHERE id = $1", clientId).Scan(&client.ID, &client.Limit, &client.Balance, &client.UpdatedAt)
 		assert.NoError(t, err)
 
-		assert.Equal(t, amountAsNegative*concorrentUpdates, client.Balance)
+		assert.Equal(t, amountAsNegative*domain.Money(concorrentUpdates), client.Balance)
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+	})
+
+	// Re-reading the balance after the commit could return a balance already changed by
+	// another request, the balance returned must be exactly the one after each transaction.
+	t.Run("concorrent credits return the balance right after each one", func(t *testing.T) {
+		clientId := 4
+		concorrentUpdates := 50
+
+		transaction, err := domain.NewTransaction(clientId, 1, "c", "descricao")
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		balances := make([]int, concorrentUpdates)
+		for i := 0; i < concorrentUpdates; i++ {
+			wg.Add(1)
+
+			go func(i int, transaction domain.Transaction) {
+				defer wg.Done()
+				client, err := repo.ExecuteTransaction(context.Background(), &transaction)
+				assert.NoError(t, err)
+				balances[i] = int(client.Balance)
+			}(i, *transaction)
+		}
+
+		wg.Wait()
+
+		sort.Ints(balances)
+		for i, balance := range balances {
+			assert.Equal(t, i+1, balance)
+		}
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+	})
+}
+
+func TestClientRepository_ExecuteTransactions(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewClientRepository(logger, db)
+
+	newBatch := func(clientId int, kinds ...string) []domain.BatchItem {
+		items := make([]domain.BatchItem, 0, len(kinds))
+		for _, kind := range kinds {
+			transaction, err := domain.NewTransaction(clientId, 60000, kind, "lote")
+			assert.NoError(t, err)
+			items = append(items, domain.BatchItem{Transaction: transaction})
+		}
+		return items
+	}
+
+	t.Run("best effort batch skips the items over the limit", func(t *testing.T) {
+		clientId := 1 // limit of 100000
+		items := newBatch(clientId, "d", "d", "c")
+		before, err := repo.GetClientBalance(context.Background(), clientId)
+		assert.NoError(t, err)
+
+		err = repo.ExecuteTransactions(context.Background(), clientId, items, false)
+		assert.NoError(t, err)
+
+		assert.Equal(t, domain.Money(-60000), items[0].Client.Balance)
+		assert.ErrorIs(t, items[1].Err, domain.ErrTransactionOverClientLimit)
+		assert.Equal(t, domain.Money(0), items[2].Client.Balance)
+
+		// The balance is updated once, so the version too.
+		assert.Equal(t, before.Version+1, items[0].Client.Version)
+		assert.Equal(t, before.Version+1, items[2].Client.Version)
+
+		tt, err := repo.GetClientTransactions(context.Background(), clientId)
+		assert.NoError(t, err)
+		assert.Len(t, tt, 2)
+
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+	})
+
+	t.Run("atomic batch is rolled back when an item is over the limit", func(t *testing.T) {
+		clientId := 1
+		items := newBatch(clientId, "d", "d")
+
+		err := repo.ExecuteTransactions(context.Background(), clientId, items, true)
+		assert.ErrorIs(t, err, domain.ErrBatchRejected)
+		assert.ErrorIs(t, items[1].Err, domain.ErrTransactionOverClientLimit)
+
+		client, err := repo.GetClientBalance(context.Background(), clientId)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.Money(0), client.Balance)
+
+		tt, err := repo.GetClientTransactions(context.Background(), clientId)
+		assert.NoError(t, err)
+		assert.Len(t, tt, 0)
+	})
+
+	t.Run("batch to unexisting client", func(t *testing.T) {
+		clientId := 10000
+		items := newBatch(clientId, "c")
+
+		err := repo.ExecuteTransactions(context.Background(), clientId, items, true)
+		assert.ErrorIs(t, err, domain.ErrClientDoesntExist)
+	})
+}
+
+func TestClientRepository_ExecuteTransaction_Exchange(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewClientRepository(logger, db)
+	rates := NewExchangeRateRepository(logger, db)
+
+	t.Run("transaction in another currency is converted", func(t *testing.T) {
+		clientId := 1
+		rate, err := domain.NewExchangeRate("USD", "BRL", "5.25")
+		assert.NoError(t, err)
+		assert.NoError(t, rates.SaveExchangeRate(context.Background(), rate))
+
+		transaction, err := domain.NewTransaction(clientId, 1000, "c", "cambio")
+		assert.NoError(t, err)
+		assert.NoError(t, transaction.SetCurrency("USD"))
+
+		client, err := repo.ExecuteTransaction(context.Background(), transaction)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.Money(5250), client.Balance)
+
+		statement, err := repo.GetStatement(context.Background(), clientId)
+		assert.NoError(t, err)
+		assert.Equal(t, "USD", statement.Transactions[0].Currency)
+		assert.Equal(t, domain.Money(1000), statement.Transactions[0].OriginalAmount)
+		assert.Equal(t, "5.25", statement.Transactions[0].Rate)
+
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+	})
+
+	t.Run("transaction in a currency without rate", func(t *testing.T) {
+		transaction, err := domain.NewTransaction(1, 1000, "c", "cambio")
+		assert.NoError(t, err)
+		assert.NoError(t, transaction.SetCurrency("JPY"))
+
+		_, err = repo.ExecuteTransaction(context.Background(), transaction)
+		assert.ErrorIs(t, err, domain.ErrExchangeRateNotFound)
+	})
+}
+
+func TestClientRepository_SetClientCurrency(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewClientRepository(logger, db)
+
+	t.Run("client without transactions", func(t *testing.T) {
+		clientId := 2
+		before, err := repo.GetClientBalance(context.Background(), clientId)
+		assert.NoError(t, err)
+
+		client, err := repo.SetClientCurrency(context.Background(), clientId, "USD")
+		assert.NoError(t, err)
+		assert.Equal(t, "USD", client.Currency)
+		assert.Greater(t, client.Version, before.Version)
+
+		_, err = repo.SetClientCurrency(context.Background(), clientId, domain.DefaultCurrency)
+		assert.NoError(t, err)
+	})
+
+	t.Run("client with transactions", func(t *testing.T) {
+		clientId := 2
+		transaction, err := domain.NewTransaction(clientId, 100, "c", "deposito")
+		assert.NoError(t, err)
+		_, err = repo.ExecuteTransaction(context.Background(), transaction)
+		assert.NoError(t, err)
 		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+
+		_, err = repo.SetClientCurrency(context.Background(), clientId, "USD")
+		assert.ErrorIs(t, err, domain.ErrCurrencyInUse)
+
+		_, err = repo.SetClientCurrency(context.Background(), clientId, domain.DefaultCurrency)
+		assert.NoError(t, err)
+	})
+
+	t.Run("client doesn't exist", func(t *testing.T) {
+		_, err := repo.SetClientCurrency(context.Background(), 999, "USD")
+		assert.ErrorIs(t, err, domain.ErrClientDoesntExist)
 	})
 }
 
@@ -162,7 +346,7 @@ func TestClientRepository_GetClientBalance(t *testing.T) {
 
 	t.Run("valid client check balance", func(t *testing.T) {
 		clientId := 1
-		expectedBalance := 0
+		expectedBalance := domain.Money(0)
 
 		client, err := repo.GetClientBalance(context.Background(), clientId)
 		assert.NoError(t, err)
@@ -179,6 +363,37 @@ func TestClientRepository_GetClientBalance(t *testing.T) {
 
 }
 
+func TestClientRepository_GetClientVersion(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewClientRepository(logger, db)
+
+	t.Run("version is increased by the transactions", func(t *testing.T) {
+		clientId := 1
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+
+		before, err := repo.GetClientVersion(context.Background(), clientId)
+		assert.NoError(t, err)
+
+		transaction, err := domain.NewTransaction(clientId, domain.Money(10), "c", "descricao")
+		assert.NoError(t, err)
+		client, err := repo.ExecuteTransaction(context.Background(), transaction)
+		assert.NoError(t, err)
+
+		after, err := repo.GetClientVersion(context.Background(), clientId)
+		assert.NoError(t, err)
+		assert.Greater(t, after, before)
+		assert.Equal(t, client.Version, after)
+	})
+
+	t.Run("invalid client version", func(t *testing.T) {
+		_, err := repo.GetClientVersion(context.Background(), 100)
+		assert.ErrorIs(t, err, domain.ErrClientDoesntExist)
+	})
+}
+
 func TestClientRepository_GetClientTransactions(t *testing.T) {
 	db := initializeDatabase(t)
 	logger := initializeLogger()
@@ -220,6 +435,211 @@ func TestClientRepository_GetClientTransactions(t *testing.T) {
 
 }
 
+func TestClientRepository_GetTransactions(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewClientRepository(logger, db)
+
+	t.Run("filter by category and metadata", func(t *testing.T) {
+		clientId := 1
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+
+		annotations := []struct {
+			category string
+			metadata domain.Metadata
+		}{
+			{"mercado", domain.Metadata{"canal": "pix", "parcelas": json.Number("3")}},
+			{"mercado", domain.Metadata{"canal": "cartao"}},
+			{"salario", nil},
+		}
+		for _, a := range annotations {
+			transaction, _ := domain.NewTransaction(clientId, 100, "c", "teste")
+			assert.NoError(t, transaction.SetAnnotations(a.category, a.metadata))
+			_, err := repo.ExecuteTransaction(context.Background(), transaction)
+			assert.NoError(t, err)
+		}
+
+		filter, _ := domain.NewTransactionFilter("mercado", nil, 10)
+		transactions, err := repo.GetTransactions(context.Background(), clientId, filter)
+		assert.NoError(t, err)
+		assert.Len(t, transactions, 2)
+
+		filter, _ = domain.NewTransactionFilter("", map[string]string{"canal": "pix", "parcelas": "3"}, 10)
+		transactions, err = repo.GetTransactions(context.Background(), clientId, filter)
+		assert.NoError(t, err)
+		assert.Len(t, transactions, 1)
+		assert.Equal(t, "mercado", transactions[0].Category)
+		assert.Equal(t, domain.Metadata{"canal": "pix", "parcelas": json.Number("3")}, transactions[0].Metadata)
+	})
+
+	t.Run("get transactions of unexisting client", func(t *testing.T) {
+		filter, _ := domain.NewTransactionFilter("", nil, 10)
+		_, err := repo.GetTransactions(context.Background(), 10000, filter)
+		assert.ErrorIs(t, err, domain.ErrClientDoesntExist)
+	})
+}
+
+func TestClientRepository_ExternalReference(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewClientRepository(logger, db)
+
+	newTransaction := func(clientId int, reference string) *domain.Transaction {
+		transaction, _ := domain.NewTransaction(clientId, 100, "c", "teste")
+		transaction.SetExternalReference(reference)
+		return transaction
+	}
+
+	t.Run("reused reference is rejected and the first is found", func(t *testing.T) {
+		clientId := 1
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+
+		_, err := repo.ExecuteTransaction(context.Background(), newTransaction(clientId, "pedido-1"))
+		assert.NoError(t, err)
+
+		_, err = repo.ExecuteTransaction(context.Background(), newTransaction(clientId, "pedido-1"))
+		assert.ErrorIs(t, err, domain.ErrDuplicateReference)
+
+		// The reference is unique per client.
+		_, err = repo.ExecuteTransaction(context.Background(), newTransaction(2, "pedido-1"))
+		assert.NoError(t, err)
+		t.Cleanup(cleanUpClientRepository(t, db, 2))
+
+		transaction, err := repo.GetTransactionByReference(context.Background(), clientId, "pedido-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "pedido-1", transaction.ExternalReference)
+
+		client, err := repo.GetClientBalance(context.Background(), clientId)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.Money(100), client.Balance)
+	})
+
+	t.Run("reused reference in a batch", func(t *testing.T) {
+		clientId := 3
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+
+		_, err := repo.ExecuteTransaction(context.Background(), newTransaction(clientId, "pedido-1"))
+		assert.NoError(t, err)
+
+		items := []domain.BatchItem{
+			{Transaction: newTransaction(clientId, "pedido-1")},
+			{Transaction: newTransaction(clientId, "pedido-2")},
+			{Transaction: newTransaction(clientId, "pedido-2")},
+		}
+		err = repo.ExecuteTransactions(context.Background(), clientId, items, false)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, items[0].Err, domain.ErrDuplicateReference)
+		assert.NoError(t, items[1].Err)
+		assert.ErrorIs(t, items[2].Err, domain.ErrDuplicateReference)
+	})
+
+	t.Run("unknown reference", func(t *testing.T) {
+		_, err := repo.GetTransactionByReference(context.Background(), 1, "inexistente")
+		assert.ErrorIs(t, err, domain.ErrTransactionNotFound)
+	})
+}
+
+func TestClientRepository_GetEventsAfter(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewClientRepository(logger, db)
+
+	t.Run("events of single and batched transactions with the balance after each", func(t *testing.T) {
+		clientId := 4
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+
+		first, _ := domain.NewTransaction(clientId, 100, "c", "primeira")
+		_, err := repo.ExecuteTransaction(context.Background(), first)
+		assert.NoError(t, err)
+		assert.NotZero(t, first.TransactionID)
+
+		second, _ := domain.NewTransaction(clientId, 30, "d", "segunda")
+		third, _ := domain.NewTransaction(clientId, 50, "c", "terceira")
+		items := []domain.BatchItem{{Transaction: second}, {Transaction: third}}
+		err = repo.ExecuteTransactions(context.Background(), clientId, items, true)
+		assert.NoError(t, err)
+		assert.Greater(t, second.TransactionID, first.TransactionID)
+		assert.Greater(t, third.TransactionID, second.TransactionID)
+
+		events, err := repo.GetEventsAfter(context.Background(), clientId, first.TransactionID, 1)
+		assert.NoError(t, err)
+		assert.Len(t, events, 1)
+		assert.Equal(t, second.TransactionID, events[0].ID)
+		assert.Equal(t, domain.Money(70), events[0].Balance)
+
+		events, err = repo.GetEventsAfter(context.Background(), clientId, 0, domain.MaxReplayEvents)
+		assert.NoError(t, err)
+		assert.Len(t, events, 3)
+		assert.Equal(t, domain.Money(100), events[0].Balance)
+		assert.Equal(t, domain.Money(120), events[2].Balance)
+	})
+
+	t.Run("events of unexisting client", func(t *testing.T) {
+		_, err := repo.GetEventsAfter(context.Background(), 10000, 0, 0)
+		assert.ErrorIs(t, err, domain.ErrClientDoesntExist)
+	})
+}
+
+func TestClientRepository_GetStatement(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewClientRepository(logger, db)
+
+	t.Run("invalid client statement", func(t *testing.T) {
+		statement, err := repo.GetStatement(context.Background(), 100)
+		assert.ErrorIs(t, err, domain.ErrClientDoesntExist)
+		assert.Nil(t, statement)
+	})
+
+	// Each credit of 1 is described with the balance it produces, so the newest transaction
+	// of a consistent statement always describes the statement's balance.
+	t.Run("balance matches the transactions under concurrent writes", func(t *testing.T) {
+		clientId := 3
+		writes := 200
+		readers := 5
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		for i := 0; i < readers; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				for ctx.Err() == nil {
+					statement, err := repo.GetStatement(context.Background(), clientId)
+					assert.NoError(t, err)
+
+					if statement.Client.Balance == 0 {
+						assert.Len(t, statement.Transactions, 0)
+						continue
+					}
+					assert.Equal(t, strconv.Itoa(int(statement.Client.Balance)), statement.Transactions[0].Description)
+				}
+			}()
+		}
+
+		for i := 1; i <= writes; i++ {
+			transaction, err := domain.NewTransaction(clientId, 1, "c", strconv.Itoa(i))
+			assert.NoError(t, err)
+			_, err = repo.ExecuteTransaction(context.Background(), transaction)
+			assert.NoError(t, err)
+		}
+
+		cancel()
+		wg.Wait()
+
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+	})
+}
+
 func createTransactions(t *testing.T, quantity int, db *pgxpool.Pool, transaction *domain.Transaction) {
 	t.Helper()
 
@@ -256,6 +676,15 @@ func initializeDatabase(t *testing.T) *pgxpool.Pool {
 		log.Fatalf("error loading database configuration: %v", err)
 	}
 
+	migrator, err := migrations.NewMigrator(initializeLogger(), pool)
+	if err != nil {
+		log.Fatalf("error loading migrations: %v", err)
+	}
+
+	if err := migrator.Up(context.Background()); err != nil {
+		log.Fatalf("error applying migrations: %v", err)
+	}
+
 	return pool
 }
 
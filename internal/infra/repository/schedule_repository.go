@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ScheduleRepository struct {
+	logger *slog.Logger
+	db     *pgxpool.Pool
+}
+
+func NewScheduleRepository(logger *slog.Logger, db *pgxpool.Pool) *ScheduleRepository {
+	return &ScheduleRepository{logger: logger, db: db}
+}
+
+const scheduleColumns = `id, clientId, amount, kind, description, currency, category, metadata, recurrence,
+	nextRunAt, status, runs, failures, lastRunAt, lastError, CreatedAt`
+
+func (r *ScheduleRepository) CreateSchedule(ctx context.Context, s *domain.ScheduledTransaction) error {
+	query := `
+	INSERT INTO scheduled_transactions (clientId, amount, kind, description, currency, category, metadata, recurrence, nextRunAt, status)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING id, CreatedAt;
+	`
+	t := s.Transaction
+	metadata, err := metadataValue(t.Metadata)
+	if err != nil {
+		return err
+	}
+
+	err = r.db.QueryRow(ctx, query,
+		t.ClientID, t.Amount, t.Kind, t.Description, nullable(t.Currency), nullable(t.Category), metadata,
+		nullable(s.Recurrence), s.NextRunAt, s.Status,
+	).Scan(&s.ID, &s.CreatedAt)
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23503" {
+		return domain.ErrClientDoesntExist
+	}
+
+	return err
+}
+
+func (r *ScheduleRepository) GetSchedules(ctx context.Context, clientID int) ([]domain.ScheduledTransaction, error) {
+	query := `
+	SELECT ` + scheduleColumns + `
+	FROM scheduled_transactions
+	WHERE clientId = $1
+	ORDER BY id;
+	`
+	rows, err := r.db.Query(ctx, query, clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []domain.ScheduledTransaction
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *s)
+	}
+
+	return schedules, rows.Err()
+}
+
+// CancelSchedule only cancels an active schedule, the finished ones are not found.
+func (r *ScheduleRepository) CancelSchedule(ctx context.Context, clientID int, scheduleID int) error {
+	query := `
+	UPDATE scheduled_transactions
+	SET status = $1
+	WHERE id = $2 AND clientId = $3 AND status = $4;
+	`
+	tag, err := r.db.Exec(ctx, query, domain.ScheduleCancelled, scheduleID, clientID, domain.ScheduleActive)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return domain.ErrScheduleNotFound
+	}
+
+	return nil
+}
+
+// RunNextDue keeps the schedule locked while the transaction is posted, so each occurrence
+// runs once across the replicas. The transaction is committed apart from the schedule, so
+// when the process stops between both the occurrence runs again, and its external reference
+// rejects the transaction posted again.
+func (r *ScheduleRepository) RunNextDue(
+	ctx context.Context,
+	now time.Time,
+	run func(ctx context.Context, s *domain.ScheduledTransaction) error,
+) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+	SELECT ` + scheduleColumns + `
+	FROM scheduled_transactions
+	WHERE status = $1 AND nextRunAt <= $2
+	ORDER BY nextRunAt
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED;
+	`
+	s, err := scanSchedule(tx.QueryRow(ctx, query, domain.ScheduleActive, now.UTC()))
+	if err == pgx.ErrNoRows {
+		return false, tx.Rollback(ctx)
+	}
+	if err != nil {
+		domain.LoggerFromContext(ctx, r.logger).DebugContext(ctx, "rolling back schedule claim",
+			"error", err,
+			"rollback status", tx.Rollback(ctx))
+		return false, err
+	}
+
+	if err := run(ctx, s); err != nil {
+		domain.LoggerFromContext(ctx, r.logger).DebugContext(ctx, "rolling back schedule claim",
+			"schedule", s.ID,
+			"error", err,
+			"rollback status", tx.Rollback(ctx))
+		return true, err
+	}
+
+	query = `
+	UPDATE scheduled_transactions
+	SET nextRunAt = $1, status = $2, runs = $3, failures = $4, lastRunAt = $5, lastError = $6
+	WHERE id = $7;
+	`
+	_, err = tx.Exec(ctx, query, s.NextRunAt, s.Status, s.Runs, s.Failures, s.LastRunAt, nullable(s.LastError), s.ID)
+	if err != nil {
+		domain.LoggerFromContext(ctx, r.logger).DebugContext(ctx, "rolling back schedule claim",
+			"schedule", s.ID,
+			"error", err,
+			"rollback status", tx.Rollback(ctx))
+		return true, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+func scanSchedule(row pgx.Row) (*domain.ScheduledTransaction, error) {
+	s := &domain.ScheduledTransaction{}
+	t := &s.Transaction
+	var currency, category, recurrence, lastError *string
+	var metadata []byte
+	var lastRunAt *time.Time
+
+	err := row.Scan(
+		&s.ID, &t.ClientID, &t.Amount, &t.Kind, &t.Description, &currency, &category, &metadata, &recurrence,
+		&s.NextRunAt, &s.Status, &s.Runs, &s.Failures, &lastRunAt, &lastError, &s.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if currency != nil {
+		t.Currency = *currency
+	}
+	if category != nil {
+		t.Category = *category
+	}
+	if metadata != nil {
+		if err := json.Unmarshal(metadata, &t.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	if recurrence != nil {
+		s.Recurrence = *recurrence
+	}
+	if lastRunAt != nil {
+		s.LastRunAt = *lastRunAt
+	}
+	if lastError != nil {
+		s.LastError = *lastError
+	}
+
+	return s, nil
+}
@@ -0,0 +1,154 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleRepository_CreateSchedule(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewScheduleRepository(logger, db)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	t.Run("create, get and cancel schedule", func(t *testing.T) {
+		clientId := 1
+		transaction := &domain.Transaction{ClientID: clientId, Amount: 100, Kind: "c", Description: "salario"}
+		schedule, err := domain.NewScheduledTransaction(transaction, now, "@monthly", now)
+		assert.NoError(t, err)
+		t.Cleanup(cleanUpScheduleRepository(t, db, clientId))
+
+		err = repo.CreateSchedule(context.Background(), schedule)
+		assert.NoError(t, err)
+		assert.NotZero(t, schedule.ID)
+
+		schedules, err := repo.GetSchedules(context.Background(), clientId)
+		assert.NoError(t, err)
+		assert.Len(t, schedules, 1)
+		assert.Equal(t, "@monthly", schedules[0].Recurrence)
+		assert.Equal(t, now, schedules[0].NextRunAt)
+		assert.Equal(t, domain.ScheduleActive, schedules[0].Status)
+
+		err = repo.CancelSchedule(context.Background(), clientId, schedule.ID)
+		assert.NoError(t, err)
+
+		err = repo.CancelSchedule(context.Background(), clientId, schedule.ID)
+		assert.ErrorIs(t, err, domain.ErrScheduleNotFound)
+	})
+
+	t.Run("create schedule to unexisting client", func(t *testing.T) {
+		transaction := &domain.Transaction{ClientID: 10000, Amount: 100, Kind: "c", Description: "salario"}
+		schedule, _ := domain.NewScheduledTransaction(transaction, now, "", now)
+
+		err := repo.CreateSchedule(context.Background(), schedule)
+		assert.ErrorIs(t, err, domain.ErrClientDoesntExist)
+	})
+}
+
+func TestScheduleRepository_RunNextDue(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewScheduleRepository(logger, db)
+	now := time.Now().UTC()
+
+	t.Run("each due schedule is claimed once by concurrent workers", func(t *testing.T) {
+		clientId := 2
+		t.Cleanup(cleanUpScheduleRepository(t, db, clientId))
+
+		transaction := &domain.Transaction{ClientID: clientId, Amount: 10, Kind: "c", Description: "salario"}
+		for i := 0; i < 20; i++ {
+			schedule, _ := domain.NewScheduledTransaction(transaction, now.Add(-time.Minute), "", now)
+			assert.NoError(t, repo.CreateSchedule(context.Background(), schedule))
+		}
+		future, _ := domain.NewScheduledTransaction(transaction, now.Add(time.Hour), "", now)
+		assert.NoError(t, repo.CreateSchedule(context.Background(), future))
+
+		var mu sync.Mutex
+		runs := map[int]int{}
+		run := func(ctx context.Context, s *domain.ScheduledTransaction) error {
+			mu.Lock()
+			runs[s.ID]++
+			mu.Unlock()
+
+			s.Complete(now, nil)
+			return nil
+		}
+
+		var wg sync.WaitGroup
+		for worker := 0; worker < 4; worker++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					ok, err := repo.RunNextDue(context.Background(), now, run)
+					assert.NoError(t, err)
+					if !ok {
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Len(t, runs, 20)
+		for id, count := range runs {
+			assert.Equal(t, 1, count, "schedule %d", id)
+		}
+
+		schedules, err := repo.GetSchedules(context.Background(), clientId)
+		assert.NoError(t, err)
+		for _, s := range schedules {
+			if s.ID == future.ID {
+				assert.Equal(t, domain.ScheduleActive, s.Status)
+				continue
+			}
+			assert.Equal(t, domain.ScheduleDone, s.Status)
+			assert.Equal(t, 1, s.Runs)
+		}
+	})
+
+	t.Run("over limit transaction is recorded", func(t *testing.T) {
+		clientId := 3
+		t.Cleanup(cleanUpScheduleRepository(t, db, clientId))
+		t.Cleanup(cleanUpClientRepository(t, db, clientId))
+
+		clients := domain.NewClientRepository(logger, NewClientRepository(logger, db))
+		svc := domain.NewScheduleService(logger, repo, clients)
+
+		transaction := &domain.Transaction{ClientID: clientId, Amount: 100000000, Kind: "d", Description: "aluguel"}
+		schedule, _ := domain.NewScheduledTransaction(transaction, now.Add(-time.Minute), "@daily", now)
+		assert.NoError(t, repo.CreateSchedule(context.Background(), schedule))
+
+		ran, err := svc.RunDue(context.Background(), now, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ran)
+
+		schedules, err := repo.GetSchedules(context.Background(), clientId)
+		assert.NoError(t, err)
+		assert.Len(t, schedules, 1)
+		assert.Equal(t, domain.ScheduleActive, schedules[0].Status)
+		assert.Equal(t, 1, schedules[0].Failures)
+		assert.Equal(t, domain.ErrTransactionOverClientLimit.Error(), schedules[0].LastError)
+		assert.True(t, schedules[0].NextRunAt.After(now))
+	})
+}
+
+func cleanUpScheduleRepository(t *testing.T, db *pgxpool.Pool, clientId int) func() {
+	return func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM scheduled_transactions WHERE clientId = $1", clientId)
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type WebhookRepository struct {
+	logger *slog.Logger
+	db     *pgxpool.Pool
+}
+
+func NewWebhookRepository(logger *slog.Logger, db *pgxpool.Pool) *WebhookRepository {
+	return &WebhookRepository{logger: logger, db: db}
+}
+
+const subscriptionColumns = `s.id, s.clientId, s.url, s.events, s.threshold, s.secret, s.CreatedAt`
+
+const deliveryColumns = `d.id, d.subscriptionId, d.event, d.payload, d.status, d.attempts, d.nextAttemptAt,
+	d.lastStatusCode, d.lastError, d.deliveredAt, d.CreatedAt`
+
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, s *domain.WebhookSubscription) error {
+	query := `
+	INSERT INTO webhook_subscriptions (clientId, url, events, threshold, secret)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, CreatedAt;
+	`
+	err := r.db.QueryRow(ctx, query, s.ClientID, s.URL, s.Events, s.Threshold, s.Secret).Scan(&s.ID, &s.CreatedAt)
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23503" {
+		return domain.ErrClientDoesntExist
+	}
+
+	return err
+}
+
+func (r *WebhookRepository) GetSubscriptions(ctx context.Context, clientID int) ([]domain.WebhookSubscription, error) {
+	query := `
+	SELECT ` + subscriptionColumns + `
+	FROM webhook_subscriptions s
+	WHERE s.clientId = $1
+	ORDER BY s.id;
+	`
+	rows, err := r.db.Query(ctx, query, clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []domain.WebhookSubscription
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *s)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+// DeleteSubscription also deletes the deliveries of the subscription, including the pending ones.
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, clientID int, subscriptionID int) error {
+	query := `DELETE FROM webhook_subscriptions WHERE id = $1 AND clientId = $2;`
+	tag, err := r.db.Exec(ctx, query, subscriptionID, clientID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return domain.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (r *WebhookRepository) GetDeliveries(
+	ctx context.Context,
+	clientID int,
+	subscriptionID int,
+	limit int,
+) ([]domain.WebhookDelivery, error) {
+	query := `
+	SELECT ` + deliveryColumns + `
+	FROM webhook_deliveries d
+	JOIN webhook_subscriptions s ON s.id = d.subscriptionId
+	WHERE s.id = $1 AND s.clientId = $2
+	ORDER BY d.id DESC
+	LIMIT $3;
+	`
+	rows, err := r.db.Query(ctx, query, subscriptionID, clientID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []domain.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(deliveries) == 0 {
+		var exists bool
+		query = `SELECT EXISTS (SELECT 1 FROM webhook_subscriptions WHERE id = $1 AND clientId = $2);`
+		if err := r.db.QueryRow(ctx, query, subscriptionID, clientID).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, domain.ErrWebhookNotFound
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) EnqueueDeliveries(ctx context.Context, deliveries []domain.WebhookDelivery) error {
+	rows := make([][]any, 0, len(deliveries))
+	for _, d := range deliveries {
+		rows = append(rows, []any{d.SubscriptionID, d.Event, d.Payload, d.Status, d.NextAttemptAt})
+	}
+
+	_, err := r.db.CopyFrom(ctx,
+		pgx.Identifier{"webhook_deliveries"},
+		[]string{"subscriptionid", "event", "payload", "status", "nextattemptat"},
+		pgx.CopyFromRows(rows),
+	)
+	return err
+}
+
+// RunNextDelivery claims the delivery until now plus the lease and commits the claim, so no
+// transaction, row lock or connection is held while it is sent. The lease must outlast the
+// send, otherwise another worker claims the delivery again and the result of the first one
+// is dropped. When the process stops after sending but before saving the delivery, the
+// attempt is made again once the lease expires, so the receivers should use the delivery
+// id to drop duplicates.
+func (r *WebhookRepository) RunNextDelivery(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+	run func(ctx context.Context, d *domain.WebhookDelivery, s *domain.WebhookSubscription) error,
+) (bool, error) {
+	now = now.UTC().Truncate(time.Microsecond)
+	lockedUntil := now.Add(lease)
+
+	query := `
+	WITH d AS (
+		UPDATE webhook_deliveries
+		SET lockedUntil = $3
+		WHERE id = (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = $1 AND nextAttemptAt <= $2 AND (lockedUntil IS NULL OR lockedUntil <= $2)
+			ORDER BY nextAttemptAt
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	)
+	SELECT ` + deliveryColumns + `, ` + subscriptionColumns + `
+	FROM d
+	JOIN webhook_subscriptions s ON s.id = d.subscriptionId;
+	`
+	d, s, err := scanDeliveryWithSubscription(r.db.QueryRow(ctx, query, domain.DeliveryPending, now, lockedUntil))
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := run(ctx, d, s); err != nil {
+		query = `UPDATE webhook_deliveries SET lockedUntil = NULL WHERE id = $1 AND lockedUntil = $2;`
+		_, releaseErr := r.db.Exec(ctx, query, d.ID, lockedUntil)
+		domain.LoggerFromContext(ctx, r.logger).DebugContext(ctx, "releasing delivery claim",
+			"delivery", d.ID,
+			"error", err,
+			"release status", releaseErr)
+		return true, err
+	}
+
+	query = `
+	UPDATE webhook_deliveries
+	SET status = $1, attempts = $2, nextAttemptAt = $3, lastStatusCode = $4, lastError = $5, deliveredAt = $6,
+		lockedUntil = NULL
+	WHERE id = $7 AND lockedUntil = $8;
+	`
+	var statusCode *int
+	if d.LastStatusCode != 0 {
+		statusCode = &d.LastStatusCode
+	}
+	var deliveredAt *time.Time
+	if !d.DeliveredAt.IsZero() {
+		deliveredAt = &d.DeliveredAt
+	}
+
+	tag, err := r.db.Exec(ctx, query,
+		d.Status, d.Attempts, d.NextAttemptAt, statusCode, nullable(d.LastError), deliveredAt, d.ID, lockedUntil,
+	)
+	if err != nil {
+		return true, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return true, domain.ErrDeliveryLeaseExpired
+	}
+
+	return true, nil
+}
+
+func scanSubscription(row pgx.Row) (*domain.WebhookSubscription, error) {
+	s := &domain.WebhookSubscription{}
+	if err := row.Scan(subscriptionDest(s)...); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func scanDelivery(row pgx.Row) (*domain.WebhookDelivery, error) {
+	d := &domain.WebhookDelivery{}
+	dest, finish := deliveryDest(d)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	finish()
+
+	return d, nil
+}
+
+func scanDeliveryWithSubscription(row pgx.Row) (*domain.WebhookDelivery, *domain.WebhookSubscription, error) {
+	d := &domain.WebhookDelivery{}
+	s := &domain.WebhookSubscription{}
+	dest, finish := deliveryDest(d)
+	if err := row.Scan(append(dest, subscriptionDest(s)...)...); err != nil {
+		return nil, nil, err
+	}
+	finish()
+
+	return d, s, nil
+}
+
+func subscriptionDest(s *domain.WebhookSubscription) []any {
+	return []any{&s.ID, &s.ClientID, &s.URL, &s.Events, &s.Threshold, &s.Secret, &s.CreatedAt}
+}
+
+// deliveryDest returns the destinations of the delivery columns, and a function
+// copying the nullable ones into the delivery after the scan.
+func deliveryDest(d *domain.WebhookDelivery) ([]any, func()) {
+	var statusCode *int
+	var lastError *string
+	var deliveredAt *time.Time
+
+	dest := []any{
+		&d.ID, &d.SubscriptionID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&statusCode, &lastError, &deliveredAt, &d.CreatedAt,
+	}
+
+	return dest, func() {
+		if statusCode != nil {
+			d.LastStatusCode = *statusCode
+		}
+		if lastError != nil {
+			d.LastError = *lastError
+		}
+		if deliveredAt != nil {
+			d.DeliveredAt = *deliveredAt
+		}
+	}
+}
@@ -0,0 +1,168 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookRepository_Subscriptions(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewWebhookRepository(logger, db)
+
+	t.Run("create, get and delete subscription", func(t *testing.T) {
+		clientId := 1
+		threshold := domain.Money(-500)
+		subscription, err := domain.NewWebhookSubscription(clientId, "http://localhost:9999",
+			[]string{domain.EventBalanceThreshold, domain.EventDebitRejected}, &threshold)
+		assert.NoError(t, err)
+		t.Cleanup(cleanUpWebhookRepository(t, db, clientId))
+
+		err = repo.CreateSubscription(context.Background(), subscription)
+		assert.NoError(t, err)
+		assert.NotZero(t, subscription.ID)
+
+		subscriptions, err := repo.GetSubscriptions(context.Background(), clientId)
+		assert.NoError(t, err)
+		assert.Len(t, subscriptions, 1)
+		assert.Equal(t, subscription.Events, subscriptions[0].Events)
+		assert.Equal(t, threshold, *subscriptions[0].Threshold)
+		assert.Equal(t, subscription.Secret, subscriptions[0].Secret)
+
+		err = repo.DeleteSubscription(context.Background(), clientId+1, subscription.ID)
+		assert.ErrorIs(t, err, domain.ErrWebhookNotFound)
+
+		err = repo.DeleteSubscription(context.Background(), clientId, subscription.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("create subscription to unexisting client", func(t *testing.T) {
+		subscription, _ := domain.NewWebhookSubscription(10000, "http://localhost:9999",
+			[]string{domain.EventDebitRejected}, nil)
+
+		err := repo.CreateSubscription(context.Background(), subscription)
+		assert.ErrorIs(t, err, domain.ErrClientDoesntExist)
+	})
+}
+
+func TestWebhookRepository_RunNextDelivery(t *testing.T) {
+	db := initializeDatabase(t)
+	logger := initializeLogger()
+	defer db.Close()
+
+	repo := NewWebhookRepository(logger, db)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	clientId := 2
+	t.Cleanup(cleanUpWebhookRepository(t, db, clientId))
+
+	subscription, _ := domain.NewWebhookSubscription(clientId, "http://localhost:9999",
+		[]string{domain.EventDebitRejected}, nil)
+	assert.NoError(t, repo.CreateSubscription(context.Background(), subscription))
+
+	payload := []byte(`{"evento":"debito_recusado"}`)
+	err := repo.EnqueueDeliveries(context.Background(), []domain.WebhookDelivery{
+		{SubscriptionID: subscription.ID, Event: domain.EventDebitRejected, Payload: payload,
+			Status: domain.DeliveryPending, NextAttemptAt: now.Add(-time.Second)},
+		{SubscriptionID: subscription.ID, Event: domain.EventDebitRejected, Payload: payload,
+			Status: domain.DeliveryPending, NextAttemptAt: now.Add(time.Hour)},
+	})
+	assert.NoError(t, err)
+
+	t.Run("the failed attempt is saved for the retry", func(t *testing.T) {
+		ok, err := repo.RunNextDelivery(context.Background(), now, time.Minute,
+			func(ctx context.Context, d *domain.WebhookDelivery, s *domain.WebhookSubscription) error {
+				assert.Equal(t, subscription.Secret, s.Secret)
+				assert.JSONEq(t, string(payload), string(d.Payload))
+				d.Complete(now, 500, nil)
+				return nil
+			})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = repo.RunNextDelivery(context.Background(), now, time.Minute,
+			func(ctx context.Context, d *domain.WebhookDelivery, s *domain.WebhookSubscription) error {
+				return nil
+			})
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("a failure to run leaves the delivery due", func(t *testing.T) {
+		later := now.Add(time.Minute)
+		failure := errors.New("connection refused")
+
+		_, err := repo.RunNextDelivery(context.Background(), later, time.Minute,
+			func(ctx context.Context, d *domain.WebhookDelivery, s *domain.WebhookSubscription) error {
+				return failure
+			})
+		assert.ErrorIs(t, err, failure)
+
+		ok, err := repo.RunNextDelivery(context.Background(), later, time.Minute,
+			func(ctx context.Context, d *domain.WebhookDelivery, s *domain.WebhookSubscription) error {
+				d.Complete(later, 200, nil)
+				return nil
+			})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("a claimed delivery isn't claimed again until its lease expires", func(t *testing.T) {
+		due := now.Add(2 * time.Hour)
+
+		ok, err := repo.RunNextDelivery(context.Background(), due, time.Minute,
+			func(ctx context.Context, d *domain.WebhookDelivery, s *domain.WebhookSubscription) error {
+				ok, err := repo.RunNextDelivery(ctx, due, time.Minute,
+					func(ctx context.Context, d *domain.WebhookDelivery, s *domain.WebhookSubscription) error {
+						return nil
+					})
+				assert.NoError(t, err)
+				assert.False(t, ok, "leased")
+
+				ok, err = repo.RunNextDelivery(ctx, due.Add(time.Minute), time.Minute,
+					func(ctx context.Context, d *domain.WebhookDelivery, s *domain.WebhookSubscription) error {
+						d.Complete(due.Add(time.Minute), 500, nil)
+						return nil
+					})
+				assert.NoError(t, err)
+				assert.True(t, ok, "lease expired")
+
+				d.Complete(due, 200, nil)
+				return nil
+			})
+		assert.ErrorIs(t, err, domain.ErrDeliveryLeaseExpired)
+		assert.True(t, ok)
+	})
+
+	t.Run("the deliveries are listed newest first", func(t *testing.T) {
+		deliveries, err := repo.GetDeliveries(context.Background(), clientId, subscription.ID, 10)
+		assert.NoError(t, err)
+		assert.Len(t, deliveries, 2)
+		assert.Equal(t, domain.DeliveryPending, deliveries[0].Status)
+		assert.Equal(t, 500, deliveries[0].LastStatusCode)
+		assert.Equal(t, domain.DeliveryDelivered, deliveries[1].Status)
+		assert.Equal(t, 2, deliveries[1].Attempts)
+		assert.Equal(t, 200, deliveries[1].LastStatusCode)
+
+		_, err = repo.GetDeliveries(context.Background(), clientId+1, subscription.ID, 10)
+		assert.ErrorIs(t, err, domain.ErrWebhookNotFound)
+	})
+}
+
+func cleanUpWebhookRepository(t *testing.T, db *pgxpool.Pool, clientId int) func() {
+	return func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM webhook_subscriptions WHERE clientId = $1", clientId)
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,104 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTValidator_HS256(t *testing.T) {
+	v, err := NewJWTValidator("secret", "", "")
+	assert.NoError(t, err)
+
+	t.Run("valid token", func(t *testing.T) {
+		tokenString := signHS256(t, "secret", newClaims(1, "extrato:read", time.Hour))
+
+		principal, err := v.Validate(tokenString)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, principal.ClientID)
+		assert.Equal(t, []string{domain.ScopeStatementRead}, principal.Scopes)
+	})
+
+	t.Run("token signed with another secret", func(t *testing.T) {
+		tokenString := signHS256(t, "another", newClaims(1, "extrato:read", time.Hour))
+
+		_, err := v.Validate(tokenString)
+		assert.ErrorIs(t, err, domain.ErrUnauthorized)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		tokenString := signHS256(t, "secret", newClaims(1, "extrato:read", -time.Hour))
+
+		_, err := v.Validate(tokenString)
+		assert.ErrorIs(t, err, domain.ErrUnauthorized)
+	})
+}
+
+func TestJWTValidator_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	path := writeJWKS(t, "key-1", &key.PublicKey)
+	v, err := NewJWTValidator("", path, "")
+	assert.NoError(t, err)
+
+	t.Run("valid token", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, newClaims(2, "transacoes:write extrato:read", time.Hour))
+		token.Header["kid"] = "key-1"
+		tokenString, err := token.SignedString(key)
+		assert.NoError(t, err)
+
+		principal, err := v.Validate(tokenString)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, principal.ClientID)
+		assert.Equal(t, domain.ClientScopes, principal.Scopes)
+	})
+
+	t.Run("HS256 token is not accepted without a secret", func(t *testing.T) {
+		tokenString := signHS256(t, "secret", newClaims(2, "admin", time.Hour))
+
+		_, err := v.Validate(tokenString)
+		assert.ErrorIs(t, err, domain.ErrUnauthorized)
+	})
+}
+
+func newClaims(clientID int, scope string, expiresIn time.Duration) *Claims {
+	return &Claims{
+		ClientID: clientID,
+		Scope:    scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+	}
+}
+
+func signHS256(t *testing.T, secret string, claims *Claims) string {
+	t.Helper()
+
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	assert.NoError(t, err)
+	return tokenString
+}
+
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	t.Helper()
+
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	content := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":%q,"alg":"RS256","n":%q,"e":%q}]}`, kid, n, e)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"rinha-with-go-2024/internal/domain"
+)
+
+var ErrAddressNotAllowed = errors.New("the webhook address isn't public")
+
+// HTTPSender posts the webhooks, checking the address of every connection, after the host
+// is resolved, so a host resolving to an internal address once subscribed is still refused.
+// The redirects aren't followed and the proxies of the environment aren't used, so a
+// subscription can't be used to reach another address.
+type HTTPSender struct {
+	client *http.Client
+}
+
+// NewHTTPSender only connects to the public addresses, unless allowPrivate, which is only
+// meant to try the webhooks locally.
+func NewHTTPSender(timeout time.Duration, allowPrivate bool) *HTTPSender {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = publicOnly
+	}
+
+	return &HTTPSender{
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:               nil,
+				DialContext:         dialer.DialContext,
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: timeout,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// publicOnly runs before each connection, with the address already resolved.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !domain.PublicAddress(addrPort.Addr()) {
+		return ErrAddressNotAllowed
+	}
+	return nil
+}
+
+func (s *HTTPSender) Send(ctx context.Context, url string, headers map[string]string, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Draining the body allows the connection to be reused.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	return res.StatusCode, nil
+}
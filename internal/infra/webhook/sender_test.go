@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSender_Send(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	defer receiver.Close()
+
+	t.Run("the internal addresses are refused when connecting", func(t *testing.T) {
+		sender := NewHTTPSender(time.Second, false)
+
+		_, err := sender.Send(context.Background(), receiver.URL, nil, []byte("{}"))
+		assert.ErrorIs(t, err, ErrAddressNotAllowed)
+
+		_, err = sender.Send(context.Background(), "http://localhost:1/", nil, []byte("{}"))
+		assert.ErrorIs(t, err, ErrAddressNotAllowed)
+	})
+
+	t.Run("the internal addresses when allowed", func(t *testing.T) {
+		sender := NewHTTPSender(time.Second, true)
+
+		status, err := sender.Send(context.Background(), receiver.URL, nil, []byte("{}"))
+		assert.NoError(t, err)
+		assert.Equal(t, 204, status)
+	})
+
+	t.Run("the redirects aren't followed", func(t *testing.T) {
+		redirect := httptest.NewServer(http.RedirectHandler("http://169.254.169.254/", http.StatusFound))
+		defer redirect.Close()
+		sender := NewHTTPSender(time.Second, true)
+
+		status, err := sender.Send(context.Background(), redirect.URL, nil, []byte("{}"))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusFound, status)
+	})
+}